@@ -3,21 +3,41 @@
 package eml
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strings"
+
+	"golang.org/x/net/idna"
 )
 
+// Address is a mailbox, group or unparseable address of a header. The
+// String method gives the RFC 5322 form of the address, with the display
+// names quoted or RFC 2047 encoded as needed.
 type Address interface {
 	String() string
 	Name() string
+	RawName() string
 	Email() string
+	Local() string
+	Domain() string
+	DomainUnicode() string
+	DomainASCII() string
+	Canonical(opts CanonicalOptions) string
+}
+
+// CanonicalOptions enables the provider specific normalizations done by
+// the Canonical method of the addresses
+type CanonicalOptions struct {
+	StripPlusTag  bool // remove the "+tag" suffix of the local part
+	FoldGmailDots bool // remove the dots of the local part at Gmail domains
 }
 
 type MailboxAddr struct {
-	name   string
-	local  string
-	domain string
+	name    string
+	rawName string
+	local   string
+	domain  string
 }
 
 func (ma MailboxAddr) Name() string {
@@ -27,47 +47,360 @@ func (ma MailboxAddr) Name() string {
 	return ma.name
 }
 
+// get the display name as written at the header, with its quotes and
+// encoded-words, empty when there's none
+func (ma MailboxAddr) RawName() string {
+	return ma.rawName
+}
+
 func (ma MailboxAddr) String() string {
 	if ma.name == "" {
 		return fmt.Sprintf("%s@%s", ma.local, ma.domain)
 	}
-	return fmt.Sprintf("%s <%s@%s>", ma.name, ma.local, ma.domain)
+	return fmt.Sprintf("%s <%s@%s>", formatPhrase(ma.name), ma.local, ma.domain)
 }
 
 func (ma MailboxAddr) Email() string {
 	return fmt.Sprintf("%s@%s", ma.local, ma.domain)
 }
 
+// get the local part, before the "@", as written at the header
+func (ma MailboxAddr) Local() string {
+	return ma.local
+}
+
+// get the domain, after the "@", as written at the header
+func (ma MailboxAddr) Domain() string {
+	return ma.domain
+}
+
+// get the domain converted to its unicode form (IDNA2008), for display
+func (ma MailboxAddr) DomainUnicode() string {
+	d, err := idna.Display.ToUnicode(ma.domain)
+	if err != nil {
+		return ma.domain
+	}
+	return d
+}
+
+// get the domain converted to its punycode form (IDNA2008), normalized for
+// comparison and lookups
+func (ma MailboxAddr) DomainASCII() string {
+	d, err := idna.Lookup.ToASCII(ma.domain)
+	if err != nil {
+		return ma.domain
+	}
+	return d
+}
+
+// get the normalized form of the address, used for comparisons: without
+// comments and with the domain lowercased
+func (ma MailboxAddr) Canonical(opts CanonicalOptions) string {
+	local := strings.TrimSpace(stripComments(ma.local))
+	domain := strings.TrimSpace(stripComments(ma.domain))
+
+	if d, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = d
+	} else {
+		domain = strings.ToLower(domain)
+	}
+
+	if opts.StripPlusTag && !strings.HasPrefix(local, `"`) {
+		local, _, _ = strings.Cut(local, "+")
+	}
+
+	// Gmail ignores the dots and the case of the local part
+	if opts.FoldGmailDots && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ToLower(strings.ReplaceAll(local, ".", ""))
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain
+}
+
 type GroupAddr struct {
-	name  string
-	boxes []MailboxAddr
+	name    string
+	rawName string
+	boxes   []MailboxAddr
 }
 
 func (ga GroupAddr) Name() string {
 	return ga.name
 }
 
+// get the group name as written at the header
+func (ga GroupAddr) RawName() string {
+	return ga.rawName
+}
+
 func (ga GroupAddr) String() string {
-	return ""
+	if len(ga.boxes) == 0 {
+		return formatPhrase(ga.name) + ":;"
+	}
+
+	boxes := []string{}
+	for _, b := range ga.boxes {
+		boxes = append(boxes, b.String())
+	}
+	return fmt.Sprintf("%s: %s;", formatPhrase(ga.name), strings.Join(boxes, ", "))
+}
+
+// get the mailboxes that are members of the group
+func (ga GroupAddr) Members() []MailboxAddr {
+	return ga.boxes
 }
 
 func (ga GroupAddr) Email() string {
 	return ""
 }
 
+func (ga GroupAddr) Local() string {
+	return ""
+}
+
+func (ga GroupAddr) Domain() string {
+	return ""
+}
+
+func (ga GroupAddr) DomainUnicode() string {
+	return ""
+}
+
+func (ga GroupAddr) DomainASCII() string {
+	return ""
+}
+
+func (ga GroupAddr) Canonical(opts CanonicalOptions) string {
+	return ""
+}
+
+// RawAddress holds an address that could not be parsed, like display names
+// out of the RFC syntax or "john at example dot com", keeping the original
+// text to be shown
+type RawAddress struct {
+	raw string
+}
+
+func (ra RawAddress) Name() string {
+	return ra.raw
+}
+
+func (ra RawAddress) RawName() string {
+	return ra.raw
+}
+
+func (ra RawAddress) String() string {
+	return ra.raw
+}
+
+func (ra RawAddress) Email() string {
+	return ""
+}
+
+func (ra RawAddress) Local() string {
+	return ""
+}
+
+func (ra RawAddress) Domain() string {
+	return ""
+}
+
+func (ra RawAddress) DomainUnicode() string {
+	return ""
+}
+
+func (ra RawAddress) DomainASCII() string {
+	return ""
+}
+
+func (ra RawAddress) Canonical(opts CanonicalOptions) string {
+	return ""
+}
+
+// format a display name as a RFC 5322 phrase: the names with non-ASCII
+// characters are encoded, the ones with specials are quoted
+func formatPhrase(name string) string {
+	if needsEncoding(name) {
+		return strings.ReplaceAll(string(EncodeHeader(name, "UTF-8")), "\r\n ", " ")
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != ' ' && !isAtext(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+		}
+	}
+
+	return name
+}
+
+// check if the ASCII character is allowed at an atom (RFC 5322 section 3.2.3)
+func isAtext(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// get the contents of a quoted-string token, without the quotes and the
+// escapes
+func unquote(t string) string {
+	if len(t) < 2 || t[0] != '"' || t[len(t)-1] != '"' {
+		return t
+	}
+
+	var b strings.Builder
+	t = t[1 : len(t)-1]
+	for i := 0; i < len(t); i++ {
+		if t[i] == '\\' && i+1 < len(t) {
+			i++
+		}
+		b.WriteByte(t[i])
+	}
+	return b.String()
+}
+
+// AddressesEqual reports whether both addresses point to the same mailbox,
+// comparing their canonical forms
+func AddressesEqual(a, b Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	ca, cb := a.Canonical(CanonicalOptions{}), b.Canonical(CanonicalOptions{})
+	return ca != "" && ca == cb
+}
+
+// remove the RFC 5322 comments (text between parentheses) from a value
+func stripComments(s string) string {
+	v, _ := splitComments(s)
+	return v
+}
+
+// split the RFC 5322 comments (text between parentheses) from a value,
+// returning the value without them and the text of each outer comment, in
+// order and without the escapes. The nested comments stay at the text of
+// their outer one.
+func splitComments(s string) (string, []string) {
+	var b, c strings.Builder
+	var comments []string
+	depth, quoted := 0, false
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s):
+			if depth == 0 {
+				b.WriteByte(ch)
+				b.WriteByte(s[i+1])
+			} else {
+				c.WriteByte(s[i+1])
+			}
+			i++
+			continue
+		case ch == '"' && depth == 0:
+			quoted = !quoted
+		case ch == '(' && !quoted:
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ch == ')' && !quoted && depth > 0:
+			depth--
+			if depth == 0 {
+				comments = append(comments, strings.TrimSpace(c.String()))
+				c.Reset()
+				continue
+			}
+		}
+
+		if depth == 0 {
+			b.WriteByte(ch)
+		} else {
+			c.WriteByte(ch)
+		}
+	}
+
+	// a comment left open runs to the end of the value
+	if depth > 0 {
+		comments = append(comments, strings.TrimSpace(c.String()))
+	}
+
+	return b.String(), comments
+}
+
 func ParseAddress(bs []byte) (Address, error) {
 
 	// UTF8 decode the address list
 	dd, e := decodeRFC2047(bs)
-	if e == nil {
-		bs = []byte(dd)
+	if e != nil {
+		dd = bs
 	}
 
-	toks, err := tokenize(bs)
+	toks, err := tokenize(dd)
 	if err != nil {
 		return nil, err
 	}
-	return parseAddress(toks)
+
+	a, err := parseAddress(toks)
+	if err != nil || bytes.Equal(dd, bs) {
+		return a, err
+	}
+
+	// the display names as written, before decoding
+	if toks, e := tokenize(bs); e == nil {
+		if r, e := parseAddress(toks); e == nil {
+			a = withRawName(a, r)
+		}
+	}
+	return a, nil
+}
+
+// copy the display names of an address parsed from the undecoded header
+func withRawName(a, raw Address) Address {
+	switch a := a.(type) {
+	case MailboxAddr:
+		if r, ok := raw.(MailboxAddr); ok {
+			a.rawName = r.rawName
+		}
+		return a
+	case GroupAddr:
+		r, ok := raw.(GroupAddr)
+		if !ok {
+			return a
+		}
+		a.rawName = r.rawName
+		if len(r.boxes) == len(a.boxes) {
+			boxes := make([]MailboxAddr, len(a.boxes))
+			for i, b := range a.boxes {
+				b.rawName = r.boxes[i].rawName
+				boxes[i] = b
+			}
+			a.boxes = boxes
+		}
+		return a
+	}
+	return a
+}
+
+// get the text covered by consecutive tokens, which are slices of the same
+// data, as it is written
+func tokensText(ts []token) []byte {
+	if len(ts) == 0 {
+		return nil
+	}
+
+	first, last := ts[0], ts[len(ts)-1]
+	n := cap(first) - cap(last) + len(last)
+	if n >= len(first) && n <= cap(first) {
+		return first[:n]
+	}
+
+	var b []byte
+	for i, t := range ts {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, t...)
+	}
+	return b
 }
 
 func parseAddress(toks []token) (Address, error) {
@@ -86,23 +419,25 @@ func parseAddress(toks []token) (Address, error) {
 			return nil, err
 		}
 		for _, nt := range nts {
-			ga.name += string(nt) + " "
+			ga.name += unquote(string(nt)) + " "
 		}
 		ga.name = strings.TrimSpace(ga.name)
+		ga.rawName = string(tokensText(nts))
 		ga.boxes = []MailboxAddr{}
 
 		last := 0
-		something := false
 		for i, t := range rest {
-			if len(t) == 1 && (t[0] == ',' || t[0] == ';') && something {
-				ma, err := parseMailboxAddr(rest[last:i])
-				if err != nil {
-					return nil, err
+			if len(t) == 1 && (t[0] == ',' || t[0] == ';') {
+				// skip the empty members, like at "undisclosed-recipients:;"
+				if i > last {
+					ma, err := parseMailboxAddr(rest[last:i])
+					if err != nil {
+						return nil, err
+					}
+					ga.boxes = append(ga.boxes, ma)
 				}
-				ga.boxes = append(ga.boxes, ma)
 				last = i + 1
 			}
-			something = true
 		}
 		return ga, nil
 	}
@@ -131,10 +466,11 @@ func parseMailboxAddr(ts []token) (ma MailboxAddr, err error) {
 			return
 		}
 		for _, nt := range nts {
-			ma.name += string(nt) + " "
+			ma.name += unquote(string(nt)) + " "
 		}
 		ma.name = strings.TrimSpace(ma.name)
-		ma.local, ma.domain, err = parseSimpleAddr(ats[:len(ats)-1])
+		ma.rawName = string(tokensText(nts))
+		ma.local, ma.domain, err = parseSimpleAddr(stripRoute(ats[:len(ats)-1]))
 		return
 	}
 	ma.local, ma.domain, err = parseSimpleAddr(ts)
@@ -147,14 +483,71 @@ func parseSimpleAddr(ts []token) (l, d string, e error) {
 		return
 	}
 
-	// The second token must be '@' - all further tokens are stuck in the domain.
-	l = string(ts[0])
-	if !(len(ts[1]) == 1 && ts[1][0] == '@') {
-		return "", "", errors.New("invalid simpleAddr")
-	}
-	for _, dp := range ts[2:] {
-		d += string(dp) + " "
+	// The local part ends at the first '@', all further tokens are stuck in
+	// the domain. The obsolete local parts (RFC 5322 section 4.4) are words
+	// separated by dots, like "john".smith or john . smith
+	at := 1
+	if !isObsoleteLocal(ts) {
+		if !(len(ts[1]) == 1 && ts[1][0] == '@') {
+			return "", "", errors.New("invalid simpleAddr")
+		}
+	} else {
+		for string(ts[at]) != "@" {
+			at++
+		}
 	}
-	d = strings.TrimSpace(d)
+
+	l = joinDotted(ts[:at])
+	d = joinDotted(ts[at+1:])
 	return
 }
+
+// drop the obsolete source route of an angle address (RFC 5322 section
+// 4.4), like the "@relay1,@relay2:" of <@relay1,@relay2:user@host>
+func stripRoute(ts []token) []token {
+	if len(ts) == 0 || string(ts[0]) != "@" {
+		return ts
+	}
+
+	for i, t := range ts {
+		if string(t) == ":" {
+			return ts[i+1:]
+		}
+	}
+	return ts
+}
+
+// check if the tokens before the '@' of an address are an obsolete local
+// part, made of several words separated by dots
+func isObsoleteLocal(ts []token) bool {
+	dot := true
+	for i, t := range ts {
+		switch {
+		case string(t) == "@":
+			return i > 1 && !dot
+		case string(t) == ".":
+			if dot {
+				return false
+			}
+			dot = true
+		case dot && (t[0] == '"' || t[0] >= 0x80 || isAtext(t[0])):
+			dot = false
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// join the tokens of a local part or domain, without spaces around the
+// dots of the obsolete forms
+func joinDotted(ts []token) string {
+	var b strings.Builder
+	for i, t := range ts {
+		if i > 0 && string(t) != "." && string(ts[i-1]) != "." {
+			b.WriteByte(' ')
+		}
+		b.Write(t)
+	}
+	return b.String()
+}
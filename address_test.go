@@ -0,0 +1,79 @@
+package eml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	tests := []struct {
+		in      string
+		emails  []string
+		invalid []string
+	}{
+		{`a@[192.0.2.1]`, []string{`a@[192.0.2.1]`}, nil},
+		{`user@[IPv6:::1]`, []string{`user@[IPv6:::1]`}, nil},
+		{`Bob <bob@[IPv6:2001:db8::1]>`, []string{`bob@[IPv6:2001:db8::1]`}, nil},
+		{`"a,b"@example.com`, []string{`"a,b"@example.com`}, nil},
+		{`"a@b"@example.com`, []string{`"a@b"@example.com`}, nil},
+		{`"a\"b"@example.com`, []string{`"a\"b"@example.com`}, nil},
+		{`John <"a,b"@example.com>, c@example.com`, []string{`"a,b"@example.com`, `c@example.com`}, nil},
+		{`"a,b"@example.com, user@[IPv6:::1], "x@y"@example.com`, []string{`"a,b"@example.com`, `user@[IPv6:::1]`, `"x@y"@example.com`}, nil},
+		{`G: "x@y"@example.com, z@example.com;`, []string{`"x@y"@example.com`, `z@example.com`}, nil},
+
+		// the bad entries are kept raw, without losing the others
+		{`"a,b"@example.com, "bad, c@example.com`, []string{`"a,b"@example.com`, `"bad, c@example.com`}, []string{`"bad, c@example.com`}},
+		{`<a@example.com, b@example.com`, []string{`<a@example.com, b@example.com`}, []string{`<a@example.com, b@example.com`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			al, err := parseAddressList([]byte(tt.in))
+
+			got := listEmails(al)
+			if !equalStrings(got, tt.emails) {
+				t.Errorf("addresses = %q, want %q", got, tt.emails)
+			}
+
+			var le *AddressListError
+			switch {
+			case tt.invalid == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.invalid != nil && !errors.As(err, &le):
+				t.Errorf("error = %v, want an AddressListError", err)
+			case tt.invalid != nil && !equalStrings(le.Invalid, tt.invalid):
+				t.Errorf("invalid = %q, want %q", le.Invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+// the emails of the list, with the groups expanded and the raw addresses
+// as written
+func listEmails(al []Address) (l []string) {
+	for _, a := range al {
+		switch a := a.(type) {
+		case GroupAddr:
+			for _, m := range a.Members() {
+				l = append(l, m.Email())
+			}
+		case RawAddress:
+			l = append(l, a.String())
+		default:
+			l = append(l, a.Email())
+		}
+	}
+	return
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+// AppleSingle and AppleDouble (RFC 1740) attachments handling.
+
+package eml
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	appleSingleMagic = 0x00051600
+	appleDoubleMagic = 0x00051607
+
+	// entry ids of the applefile header
+	appleDataFork     = 1
+	appleResourceFork = 2
+	appleRealName     = 3
+)
+
+// contents of an application/applefile part
+type appleFile struct {
+	double   bool   // AppleDouble header, the data fork is the next part
+	name     string // real name of the file
+	data     []byte // data fork, only present at AppleSingle
+	resource []byte // resource fork
+}
+
+// parse the header and entries of an AppleSingle or AppleDouble file
+func parseAppleFile(b []byte) (af appleFile, err error) {
+	if len(b) < 26 {
+		return af, errors.New("applefile: header too short")
+	}
+
+	switch binary.BigEndian.Uint32(b) {
+	case appleSingleMagic:
+	case appleDoubleMagic:
+		af.double = true
+	default:
+		return af, errors.New("applefile: invalid magic number")
+	}
+
+	n := int(binary.BigEndian.Uint16(b[24:]))
+	for i := 0; i < n; i++ {
+		e := 26 + i*12
+		if e+12 > len(b) {
+			return af, errors.New("applefile: truncated entries list")
+		}
+
+		id := binary.BigEndian.Uint32(b[e:])
+		off := int64(binary.BigEndian.Uint32(b[e+4:]))
+		length := int64(binary.BigEndian.Uint32(b[e+8:]))
+		if off+length > int64(len(b)) {
+			return af, errors.New("applefile: entry out of bounds")
+		}
+
+		v := b[off : off+length]
+		switch id {
+		case appleDataFork:
+			af.data = v
+		case appleResourceFork:
+			af.resource = v
+		case appleRealName:
+			af.name = string(v)
+		}
+	}
+
+	return af, nil
+}
@@ -0,0 +1,178 @@
+// Authenticated Received Chain (RFC 8617) parsing and validation.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ARCResult is the outcome of the ARC chain validation
+type ARCResult string
+
+const (
+	ARCNone ARCResult = "none"
+	ARCPass ARCResult = "pass"
+	ARCFail ARCResult = "fail"
+)
+
+// ARCSet holds the three headers added by a single ARC intermediary
+type ARCSet struct {
+	Instance              int               `json:"instance"`
+	Seal                  map[string]string `json:"seal"`                   // ARC-Seal tags
+	MessageSignature      map[string]string `json:"message_signature"`      // ARC-Message-Signature tags
+	AuthenticationResults string            `json:"authentication_results"` // ARC-Authentication-Results without the i= tag
+}
+
+// get the instance number and the remaining value of an ARC header
+func arcInstance(v []byte) (int, []byte, error) {
+	tags := parseTagList(v)
+
+	i, err := strconv.Atoi(tags["i"])
+	if err != nil || i < 1 || i > 50 {
+		return 0, v, fmt.Errorf("invalid ARC instance %q", tags["i"])
+	}
+
+	// the ARC-Authentication-Results payload follows the first ";"
+	_, rest, _ := bytes.Cut(v, []byte(";"))
+	return i, bytes.TrimSpace(rest), nil
+}
+
+// group the ARC headers into sets ordered by their instance
+func parseARCHeaders(headers []RawHeader) (sets []ARCSet, err error) {
+	found := make(map[int]*ARCSet)
+
+	get := func(i int) *ARCSet {
+		if _, ok := found[i]; !ok {
+			found[i] = &ARCSet{Instance: i}
+		}
+		return found[i]
+	}
+
+	for _, rh := range headers {
+		switch strings.ToLower(string(rh.Key)) {
+		case `arc-seal`:
+			i, _, e := arcInstance(rh.Value)
+			if e != nil {
+				err = e
+				continue
+			}
+			get(i).Seal = parseTagList(rh.Value)
+		case `arc-message-signature`:
+			i, _, e := arcInstance(rh.Value)
+			if e != nil {
+				err = e
+				continue
+			}
+			get(i).MessageSignature = parseTagList(rh.Value)
+		case `arc-authentication-results`:
+			i, rest, e := arcInstance(rh.Value)
+			if e != nil {
+				err = e
+				continue
+			}
+			get(i).AuthenticationResults = string(rest)
+		}
+	}
+
+	for _, s := range found {
+		sets = append(sets, *s)
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Instance < sets[j].Instance
+	})
+
+	return
+}
+
+// VerifyARC validates the ARC chain of the message, checking the structure
+// of the sets, the latest ARC-Message-Signature and every ARC-Seal. The
+// returned error describes the reason of a failed chain.
+func (msg Message) VerifyARC(r Resolver) (ARCResult, error) {
+	if len(msg.ARC) == 0 {
+		return ARCNone, nil
+	}
+
+	// the sets must be complete and numbered from 1 without gaps
+	for k, s := range msg.ARC {
+		if s.Instance != k+1 {
+			return ARCFail, fmt.Errorf("ARC: missing set for instance %d", k+1)
+		}
+
+		if s.Seal == nil || s.MessageSignature == nil {
+			return ARCFail, fmt.Errorf("ARC: incomplete set for instance %d", s.Instance)
+		}
+
+		cv := strings.ToLower(s.Seal["cv"])
+		if (k == 0 && cv != "none") || (k > 0 && cv != "pass") {
+			return ARCFail, fmt.Errorf("ARC: invalid chain validation status %q at instance %d", cv, s.Instance)
+		}
+	}
+
+	// pick the raw header fields of each set
+	fields := splitHeaderFields(msg.Headers)
+	raws := make(map[int]map[string][]byte)
+	for _, f := range fields {
+		name := headerFieldName(f)
+		if name != `arc-seal` && name != `arc-message-signature` && name != `arc-authentication-results` {
+			continue
+		}
+
+		_, v, _ := bytes.Cut(f, []byte(":"))
+		i, _, err := arcInstance(v)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := raws[i]; !ok {
+			raws[i] = make(map[string][]byte)
+		}
+
+		if _, ok := raws[i][name]; ok {
+			return ARCFail, fmt.Errorf("ARC: duplicated %s for instance %d", name, i)
+		}
+		raws[i][name] = f
+	}
+
+	for i := 1; i <= len(msg.ARC); i++ {
+		if len(raws[i]) != 3 {
+			return ARCFail, fmt.Errorf("ARC: incomplete set for instance %d", i)
+		}
+	}
+
+	// only the most recent message signature needs to be valid
+	last := len(msg.ARC)
+	if err := verifyHeaderSignature(r, raws[last][`arc-message-signature`], fields, msg.Body); err != nil {
+		return ARCFail, fmt.Errorf("ARC: message signature of instance %d: %v", last, err)
+	}
+
+	// each seal signs all the sets up to its own instance
+	for i := last; i > 0; i-- {
+		tags := msg.ARC[i-1].Seal
+
+		h, newHash, err := signatureHash(tags["a"])
+		if err != nil {
+			return ARCFail, fmt.Errorf("ARC: seal of instance %d: %v", i, err)
+		}
+
+		hh := newHash()
+		for j := 1; j <= i; j++ {
+			hh.Write(canonicalizeHeader(raws[j][`arc-authentication-results`], true))
+			hh.Write(canonicalizeHeader(raws[j][`arc-message-signature`], true))
+			if j < i {
+				hh.Write(canonicalizeHeader(raws[j][`arc-seal`], true))
+			}
+		}
+		hh.Write(bytes.TrimSuffix(canonicalizeHeader(stripSignatureValue(raws[i][`arc-seal`]), true), []byte("\r\n")))
+
+		if err := checkSignature(r, tags, h, hh.Sum(nil)); err != nil {
+			return ARCFail, fmt.Errorf("ARC: seal of instance %d: %v", i, err)
+		}
+	}
+
+	return ARCPass, nil
+}
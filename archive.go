@@ -0,0 +1,250 @@
+// Listing and extraction of the archive attachments.
+
+package eml
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrUnsupportedArchive is returned for the attachments which are not zip,
+// tar or gzip archives, like the 7z and rar ones
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+// ArchiveBombError is returned when an archive goes over the limits of
+// the ExpandOptions, the entries found until then being returned too
+type ArchiveBombError struct {
+	Reason string
+}
+
+func (e *ArchiveBombError) Error() string {
+	return "archive bomb: " + e.Reason
+}
+
+// ArchiveEntry is a file found inside an archive attachment
+type ArchiveEntry struct {
+	Name      string `json:"name"`      // path inside the archive
+	Size      int64  `json:"size"`      // uncompressed size, as declared unless extracted
+	Encrypted bool   `json:"encrypted"` // the contents can't be read without the password
+	SHA256    string `json:"sha256"`    // hex encoded hash of the contents, when extracted
+	Data      []byte `json:"data"`      // contents, when extracted
+}
+
+// ExpandOptions tunes ExpandArchive, the zero value listing the entries
+// with the default limits
+type ExpandOptions struct {
+	// Extract reads the contents of the entries, with their hashes
+	Extract bool
+
+	// limits against the archive bombs, the defaults being used when 0
+	MaxEntries int   // number of entries, 10000 by default
+	MaxSize    int64 // total uncompressed bytes read, 100MB by default
+	MaxRatio   int64 // compression ratio of an entry, 100 by default
+}
+
+func (o ExpandOptions) maxEntries() int {
+	if o.MaxEntries <= 0 {
+		return 10000
+	}
+	return o.MaxEntries
+}
+
+func (o ExpandOptions) maxSize() int64 {
+	if o.MaxSize <= 0 {
+		return 100 << 20
+	}
+	return o.MaxSize
+}
+
+func (o ExpandOptions) maxRatio() int64 {
+	if o.MaxRatio <= 0 {
+		return 100
+	}
+	return o.MaxRatio
+}
+
+// ExpandArchive lists the files of a zip, tar, tar.gz or gzip attachment,
+// told by its contents. The directories are skipped and the nested
+// archives are not expanded. The compressed streams are read up to the
+// limits of the options even when only listing, as a tar.gz can't be
+// listed otherwise.
+func (a Attachment) ExpandArchive(opts ExpandOptions) ([]ArchiveEntry, error) {
+	t := a.DetectedType
+	if t == "" {
+		t = DetectContentType(a.Data)
+	}
+
+	switch t {
+	case "application/zip":
+		return expandZip(a.Data, opts)
+	case "application/x-tar":
+		return expandTar(bytes.NewReader(a.Data), opts)
+	case "application/gzip":
+		return expandGzip(a.Data, a.Filename, opts)
+	}
+
+	// the Office Open XML documents are zip files too
+	if strings.HasPrefix(t, "application/vnd.openxmlformats-officedocument.") {
+		return expandZip(a.Data, opts)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedArchive, t)
+}
+
+// count the entries and bytes read against the limits
+type expandBudget struct {
+	opts    ExpandOptions
+	entries int
+	read    int64
+}
+
+func (b *expandBudget) entry() error {
+	b.entries++
+	if b.entries > b.opts.maxEntries() {
+		return &ArchiveBombError{Reason: fmt.Sprintf("more than %d entries", b.opts.maxEntries())}
+	}
+	return nil
+}
+
+// read an entry contents up to the remaining bytes of the budget
+func (b *expandBudget) readAll(r io.Reader) ([]byte, error) {
+	left := b.opts.maxSize() - b.read
+	data, err := io.ReadAll(io.LimitReader(r, left+1))
+	b.read += int64(len(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > left {
+		return nil, &ArchiveBombError{Reason: fmt.Sprintf("more than %d bytes uncompressed", b.opts.maxSize())}
+	}
+	return data, nil
+}
+
+func hashEntry(e *ArchiveEntry, data []byte) {
+	sum := sha256.Sum256(data)
+	e.Data, e.Size, e.SHA256 = data, int64(len(data)), hex.EncodeToString(sum[:])
+}
+
+func expandZip(data []byte, opts ExpandOptions) (entries []ArchiveEntry, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &expandBudget{opts: opts}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err = b.entry(); err != nil {
+			return
+		}
+
+		e := ArchiveEntry{Name: f.Name, Size: int64(f.UncompressedSize64), Encrypted: f.Flags&0x1 != 0}
+
+		// the declared sizes may lie, the real ones are checked on read
+		if f.CompressedSize64 > 0 && int64(f.UncompressedSize64)/int64(f.CompressedSize64) > opts.maxRatio() {
+			return entries, &ArchiveBombError{Reason: fmt.Sprintf("%q compressed over %d times", f.Name, opts.maxRatio())}
+		}
+
+		if opts.Extract && !e.Encrypted {
+			r, err := f.Open()
+			if err != nil {
+				return entries, err
+			}
+			d, err := b.readAll(r)
+			r.Close()
+			if err != nil {
+				return entries, err
+			}
+			if f.CompressedSize64 > 0 && int64(len(d))/int64(f.CompressedSize64) > opts.maxRatio() {
+				return entries, &ArchiveBombError{Reason: fmt.Sprintf("%q compressed over %d times", f.Name, opts.maxRatio())}
+			}
+			hashEntry(&e, d)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return
+}
+
+func expandTar(r io.Reader, opts ExpandOptions) (entries []ArchiveEntry, err error) {
+	return expandTarBudget(r, &expandBudget{opts: opts})
+}
+
+func expandTarBudget(r io.Reader, b *expandBudget) (entries []ArchiveEntry, err error) {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err = b.entry(); err != nil {
+			return entries, err
+		}
+
+		e := ArchiveEntry{Name: h.Name, Size: h.Size}
+		if b.opts.Extract {
+			d, err := b.readAll(tr)
+			if err != nil {
+				return entries, err
+			}
+			hashEntry(&e, d)
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+// expand a gzip stream, holding either a tar archive or a single file
+func expandGzip(data []byte, filename string, opts ExpandOptions) ([]ArchiveEntry, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// the whole stream is read to tell a tar from a single file, within
+	// the limits
+	b := &expandBudget{opts: opts}
+	d, err := b.readAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && int64(len(d))/int64(len(data)) > opts.maxRatio() {
+		return nil, &ArchiveBombError{Reason: fmt.Sprintf("compressed over %d times", opts.maxRatio())}
+	}
+
+	if DetectContentType(d) == "application/x-tar" {
+		b.read = 0
+		return expandTarBudget(bytes.NewReader(d), b)
+	}
+
+	name := zr.Name
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	}
+
+	e := ArchiveEntry{Name: name, Size: int64(len(d))}
+	if opts.Extract {
+		hashEntry(&e, d)
+	}
+	return []ArchiveEntry{e}, nil
+}
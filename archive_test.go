@@ -0,0 +1,194 @@
+package eml
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+func buildZip(t *testing.T, method uint16, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(f.data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildGzip(t *testing.T, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = name
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// incompressible contents
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func entryNames(entries []ArchiveEntry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestExpandArchive(t *testing.T) {
+	files := []archiveFile{{"a.txt", []byte("hello")}, {"dir/b.txt", []byte("world")}}
+
+	tests := []struct {
+		name     string
+		att      Attachment
+		want     string
+		filename string
+	}{
+		{"zip", Attachment{Data: buildZip(t, zip.Deflate, append(files[:1:1], archiveFile{"dir/", nil}, files[1])...)}, "a.txt dir/b.txt", ""},
+		{"tar", Attachment{Data: buildTar(t, files...)}, "a.txt dir/b.txt", ""},
+		{"tar.gz", Attachment{Data: buildGzip(t, "", buildTar(t, files...))}, "a.txt dir/b.txt", ""},
+		{"gzip", Attachment{Data: buildGzip(t, "inner.txt", []byte("hello")), Filename: "x.gz"}, "inner.txt", ""},
+		{"gzip without a name", Attachment{Data: buildGzip(t, "", []byte("hello")), Filename: "notes.txt.gz"}, "notes.txt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := tt.att.ExpandArchive(ExpandOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := entryNames(entries); got != tt.want {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+			for _, e := range entries {
+				if e.Data != nil || e.SHA256 != "" {
+					t.Errorf("%s extracted when listing", e.Name)
+				}
+			}
+
+			entries, err = tt.att.ExpandArchive(ExpandOptions{Extract: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if string(e.Data) != "hello" && string(e.Data) != "world" {
+					t.Errorf("%s data = %q", e.Name, e.Data)
+				}
+				if e.Size != 5 || len(e.SHA256) != 64 {
+					t.Errorf("%s size = %d, hash = %q", e.Name, e.Size, e.SHA256)
+				}
+			}
+		})
+	}
+
+	if _, err := (Attachment{Data: []byte("7z\xbc\xaf\x27\x1c\x00\x04")}).ExpandArchive(ExpandOptions{}); !errors.Is(err, ErrUnsupportedArchive) {
+		t.Errorf("7z: got %v, want ErrUnsupportedArchive", err)
+	}
+}
+
+func TestExpandArchiveBombs(t *testing.T) {
+	zeros := make([]byte, 1<<20)
+	small := []archiveFile{{"1", randomBytes(100)}, {"2", randomBytes(101)}, {"3", randomBytes(102)}}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    ExpandOptions
+		entries int // found before the limit
+	}{
+		{"zip ratio", buildZip(t, zip.Deflate, archiveFile{"zeros", zeros}), ExpandOptions{}, 0},
+		{"zip ratio extracting", buildZip(t, zip.Deflate, small[0], archiveFile{"zeros", zeros}), ExpandOptions{Extract: true}, 1},
+		{"zip entries", buildZip(t, zip.Store, small...), ExpandOptions{MaxEntries: 2}, 2},
+		{"zip size", buildZip(t, zip.Store, small...), ExpandOptions{Extract: true, MaxSize: 250}, 2},
+		{"tar entries", buildTar(t, small...), ExpandOptions{MaxEntries: 1}, 1},
+		{"tar size", buildTar(t, small...), ExpandOptions{Extract: true, MaxSize: 150}, 1},
+		{"gzip ratio", buildGzip(t, "zeros", zeros), ExpandOptions{}, 0},
+		{"gzip size", buildGzip(t, "random", randomBytes(1000)), ExpandOptions{MaxSize: 999}, 0},
+		{"tar.gz entries", buildGzip(t, "", buildTar(t, small...)), ExpandOptions{MaxEntries: 2}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Attachment{Data: tt.data}.ExpandArchive(tt.opts)
+
+			var be *ArchiveBombError
+			if !errors.As(err, &be) {
+				t.Fatalf("got %v, want an ArchiveBombError", err)
+			}
+			if len(entries) != tt.entries {
+				t.Errorf("got %d entries before the limit, want %d", len(entries), tt.entries)
+			}
+		})
+	}
+
+	// within the limits
+	for _, opts := range []ExpandOptions{{MaxEntries: 3}, {Extract: true, MaxSize: 303}, {MaxRatio: 10000}} {
+		data := buildZip(t, zip.Store, small...)
+		if opts.MaxRatio > 0 {
+			data = buildZip(t, zip.Deflate, archiveFile{"zeros", zeros})
+		}
+		if _, err := (Attachment{Data: data}).ExpandArchive(opts); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
+
+// the decompressed tar of a tar.gz is read twice, first as the gzip stream
+// and then by entries, counting once against the size limit
+func TestExpandTarGzBudget(t *testing.T) {
+	tarData := buildTar(t, archiveFile{"random", randomBytes(600)})
+	data := buildGzip(t, "", tarData)
+	size := int64(len(tarData))
+
+	entries, err := Attachment{Data: data}.ExpandArchive(ExpandOptions{Extract: true, MaxSize: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || len(entries[0].Data) != 600 {
+		t.Errorf("got %d entries", len(entries))
+	}
+
+	// the gzip stream is still limited as a whole
+	var be *ArchiveBombError
+	if _, err := (Attachment{Data: data}).ExpandArchive(ExpandOptions{Extract: true, MaxSize: size - 1}); !errors.As(err, &be) {
+		t.Errorf("got %v, want an ArchiveBombError", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Autocrypt (Level 1) headers parsing.
+
+package eml
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Autocrypt is the key announced by an Autocrypt or Autocrypt-Gossip header
+type Autocrypt struct {
+	Addr          string `json:"addr"`
+	PreferEncrypt string `json:"prefer_encrypt"` // "mutual" or "nopreference", never set at the gossip headers
+	KeyData       []byte `json:"key_data"`       // OpenPGP transferable public key, binary
+}
+
+// ParseAutocrypt parses the value of an Autocrypt or Autocrypt-Gossip
+// header. The headers with unknown critical attributes, not starting by
+// "_", are invalid.
+func ParseAutocrypt(v []byte) (ac Autocrypt, err error) {
+	for k, val := range parseTagList(v) {
+		switch strings.ToLower(k) {
+		case "addr":
+			ac.Addr = val
+		case "prefer-encrypt":
+			ac.PreferEncrypt = strings.ToLower(val)
+		case "keydata":
+			ac.KeyData, err = base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return ac, fmt.Errorf("invalid Autocrypt keydata [msg: %v]", err)
+			}
+		default:
+			if !strings.HasPrefix(k, "_") {
+				return ac, fmt.Errorf("unknown Autocrypt attribute %q", k)
+			}
+		}
+	}
+
+	if ac.Addr == "" || len(ac.KeyData) == 0 {
+		return ac, errors.New("Autocrypt header without addr or keydata")
+	}
+
+	if ac.PreferEncrypt != "mutual" {
+		ac.PreferEncrypt = "nopreference"
+	}
+
+	return
+}
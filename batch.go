@@ -0,0 +1,104 @@
+// Concurrent parsing of message streams.
+
+package eml
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Result is a message parsed by ParseBatch
+type Result struct {
+	Index   int // position of the data at the inputs channel
+	Message Message
+	Errors  []error
+}
+
+// ParseBatch parses the messages received from the inputs channel with a
+// pool of workers, runtime.NumCPU() when workers is not positive. The
+// results are sent as they are ready, not in the inputs order, and the
+// channel is closed once the inputs are closed and drained or the context
+// is done, the messages being parsed then ending with the context error.
+// A message panicking the parser gets an error as its result without
+// stopping the others.
+func ParseBatch(ctx context.Context, inputs <-chan []byte, workers int) <-chan Result {
+	return ParseBatchWithOptions(ctx, inputs, workers, ParseOptions{})
+}
+
+// ParseBatchWithOptions is ParseBatch with the given parser options
+func ParseBatchWithOptions(ctx context.Context, inputs <-chan []byte, workers int, opts ParseOptions) <-chan Result {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// the messages being parsed stop with the context too
+	opts.ctx = ctx
+
+	type job struct {
+		index int
+		data  []byte
+	}
+
+	jobs := make(chan job)
+	results := make(chan Result, workers)
+
+	// number the inputs in the order they are received
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case data, ok := <-inputs:
+				if !ok {
+					return
+				}
+				select {
+				case jobs <- job{i, data}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := parseIsolated(j.index, j.data, opts)
+				select {
+				case results <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// parse a message turning a panic of the parser into an error
+func parseIsolated(index int, data []byte, opts ParseOptions) (r Result) {
+	r.Index = index
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.Message = Message{}
+			r.Errors = append(r.Errors, fmt.Errorf("parser panic: %v", p))
+		}
+	}()
+
+	r.Message, r.Errors = ParseWithOptions(data, opts)
+	return
+}
@@ -0,0 +1,99 @@
+// Bcc handling when serializing the messages.
+
+package eml
+
+import (
+	"errors"
+	"strings"
+)
+
+// BccPolicy tells what Serialize does with the Bcc recipients, which must
+// not reach the other recipients
+type BccPolicy int
+
+const (
+	// BccExclude leaves out the Bcc field, the default
+	BccExclude BccPolicy = iota
+
+	// BccInclude writes the Bcc field, for the archival copies of the
+	// sender
+	BccInclude
+
+	// BccPerRecipient gives a copy without Bcc for the To and Cc
+	// recipients, and a copy for each Bcc recipient with a Bcc field
+	// holding only that recipient (RFC 5322 section 3.6.3)
+	BccPerRecipient
+)
+
+// SerializedMessage is a copy of the message to be delivered
+type SerializedMessage struct {
+	Recipients []Address // mailboxes the copy goes to, the groups expanded
+	Data       []byte
+}
+
+// Serialize composes the message from its fields, see Compose, handling
+// the Bcc recipients by the policy. A single copy for all the recipients
+// is returned, except with BccPerRecipient. The copies share the Date and
+// the Message-ID, generated when missing.
+func (msg Message) Serialize(policy BccPolicy) ([]SerializedMessage, error) {
+	switch policy {
+	case BccExclude, BccInclude, BccPerRecipient:
+	default:
+		return nil, errors.New("unknown Bcc policy")
+	}
+
+	if err := msg.setComposeDefaults(); err != nil {
+		return nil, err
+	}
+
+	visible := append(mailboxes(msg.To), mailboxes(msg.Cc)...)
+	if policy != BccPerRecipient {
+		var bcc []Address
+		if policy == BccInclude {
+			bcc = msg.Bcc
+		}
+
+		data, err := msg.composeData(bcc)
+		if err != nil {
+			return nil, err
+		}
+		return []SerializedMessage{{Recipients: append(visible, mailboxes(msg.Bcc)...), Data: data}}, nil
+	}
+
+	var l []SerializedMessage
+	if len(visible) > 0 {
+		data, err := msg.composeData(nil)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, SerializedMessage{Recipients: visible, Data: data})
+	}
+
+	for _, a := range mailboxes(msg.Bcc) {
+		data, err := msg.composeData([]Address{a})
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, SerializedMessage{Recipients: []Address{a}, Data: data})
+	}
+
+	return l, nil
+}
+
+// get the mailboxes of an address list, expanding the groups and skipping
+// the unparseable addresses
+func mailboxes(l []Address) (mbs []Address) {
+	for _, a := range l {
+		switch a := a.(type) {
+		case GroupAddr:
+			for _, m := range a.Members() {
+				mbs = append(mbs, m)
+			}
+		default:
+			if strings.Contains(a.Email(), "@") {
+				mbs = append(mbs, a)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSerializeBcc(t *testing.T) {
+	msg, errs := Parse([]byte("From: a@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Bcc: c@example.com, Group: d@example.com;\r\n" +
+		"Subject: old\r\n" +
+		"\r\n" +
+		"body\r\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the edited fields are the ones serialized
+	msg.Subject = "new"
+
+	tests := []struct {
+		policy BccPolicy
+		copies []string // recipients and Bcc field of each copy
+	}{
+		{BccExclude, []string{"b@example.com c@example.com d@example.com / "}},
+		{BccInclude, []string{"b@example.com c@example.com d@example.com / c@example.com d@example.com"}},
+		{BccPerRecipient, []string{
+			"b@example.com / ",
+			"c@example.com / c@example.com",
+			"d@example.com / d@example.com",
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := msg.Serialize(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		id := ""
+		for _, c := range l {
+			p, errs := Parse(c.Data)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if p.Subject != "new" || strings.TrimSpace(p.Text) != "body" {
+				t.Errorf("policy %d: subject %q, text %q", tt.policy, p.Subject, p.Text)
+			}
+			if id != "" && p.MessageID != id {
+				t.Errorf("policy %d: copies with different IDs", tt.policy)
+			}
+			id = p.MessageID
+
+			bcc := []Address{}
+			for _, a := range p.Bcc {
+				bcc = append(bcc, mailboxes([]Address{a})...)
+			}
+			got = append(got, emails(c.Recipients)+" / "+emails(bcc))
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.copies, "\n") {
+			t.Errorf("policy %d:\n%s\nwant\n%s", tt.policy, strings.Join(got, "\n"), strings.Join(tt.copies, "\n"))
+		}
+	}
+}
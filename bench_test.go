@@ -0,0 +1,86 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+// a message with several headers, an alternative body and an attachment
+var benchMessage = []byte("Received: from mx.example.com (mx.example.com [192.0.2.1]) by mail.example.org with ESMTPS id abc; Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+	"From: =?UTF-8?Q?J=C3=A9r=C3=B4me?= <jerome@example.com>\r\n" +
+	"To: Bob <bob@example.com>, carol@example.com, \"Dave, Jr.\" <dave@example.com>\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9?= =?ISO-8859-1?Q?_cr=E8me?=\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <bench@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"YY\"\r\n" +
+	"\r\n" +
+	"--YY\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	strings.Repeat("Caf=E9 cr=E8me, a plain text line of the body.\r\n", 50) +
+	"--YY\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<html><body>" + strings.Repeat("<p>Café crème, an HTML line.</p>\r\n", 50) + "</body></html>\r\n" +
+	"--YY--\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"doc.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"doc.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	strings.Repeat("JVBERi0xLjQKJcfsj6IKNSAwIG9iago8PC9MZW5ndGggNiAwIFI+PgpzdHJlYW0K\r\n", 100) +
+	"--XX--\r\n")
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchMessage)))
+	for i := 0; i < b.N; i++ {
+		Parse(benchMessage)
+	}
+}
+
+// the Parser reuses its buffers between the messages, like at bulk
+// ingestion
+func BenchmarkParser(b *testing.B) {
+	p := NewParser(ParseOptions{})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchMessage)))
+	for i := 0; i < b.N; i++ {
+		p.Parse(benchMessage)
+	}
+}
+
+func BenchmarkParseRaw(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ParseRaw(benchMessage)
+	}
+}
+
+func BenchmarkParseAddressList(b *testing.B) {
+	v := []byte(`=?UTF-8?Q?J=C3=A9r=C3=B4me?= <jerome@example.com>, Bob <bob@example.com>, "Dave, Jr." <dave@example.com>, carol@example.com`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parseAddressList(v)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	v := []byte("=?UTF-8?Q?Caf=C3=A9?= =?ISO-8859-1?Q?_cr=E8me?= plain text")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Decode(v)
+	}
+}
+
+func BenchmarkParseDate(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ParseDateErr("Mon, 2 Jan 2006 15:04:05 +0000 (UTC)")
+	}
+}
@@ -0,0 +1,64 @@
+// Brand Indicators for Message Identification (BIMI) headers parsing.
+
+package eml
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BIMI holds the brand indicator headers: the selector added by the sender
+// and the location and indicator added by the receiver after validating it
+type BIMI struct {
+	Selector  string `json:"selector"`  // s= of BIMI-Selector, "default" when missing
+	Location  string `json:"location"`  // l= of BIMI-Location, URL of the SVG indicator
+	Authority string `json:"authority"` // a= of BIMI-Location, URL of the mark certificate
+	Indicator []byte `json:"indicator"` // SVG document of BIMI-Indicator
+}
+
+// collect the BIMI headers, nil if none
+func parseBIMIHeaders(headers []RawHeader) (b *BIMI, err error) {
+	get := func() *BIMI {
+		if b == nil {
+			b = &BIMI{}
+		}
+		return b
+	}
+
+	for _, rh := range headers {
+		switch strings.ToLower(string(rh.Key)) {
+		case `bimi-selector`:
+			tags := parseTagList(rh.Value)
+			get().Selector = tags["s"]
+			if b.Selector == "" {
+				b.Selector = "default"
+			}
+		case `bimi-location`:
+			tags := parseTagList(rh.Value)
+			get().Location, b.Authority = tags["l"], tags["a"]
+		case `bimi-indicator`:
+			data, e := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(rh.Value)), ""))
+			if e != nil {
+				err = fmt.Errorf("invalid BIMI-Indicator [msg: %v]", e)
+				continue
+			}
+
+			// the indicators may be compressed SVG (SVGZ)
+			if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+				if zr, e := gzip.NewReader(bytes.NewReader(data)); e == nil {
+					if svg, e := io.ReadAll(zr); e == nil {
+						data = svg
+					}
+				}
+			}
+
+			get().Indicator = data
+		}
+	}
+
+	return
+}
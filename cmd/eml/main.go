@@ -0,0 +1,166 @@
+// Command eml inspects and extracts the contents of email messages.
+//
+// Usage:
+//
+//	eml headers [file]
+//	eml body [--html] [file]
+//	eml attachments [--extract-dir dir] [file]
+//	eml json [file]
+//
+// The message is read from the file, or from the standard input when no
+// file is passed. Outlook .msg files are also accepted.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncastellani/eml"
+	"github.com/ncastellani/eml/outlook"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: eml <headers|body|attachments|json> [options] [file]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	var html *bool
+	var dir *string
+
+	// each command has its own options
+	switch cmd {
+	case "headers", "json":
+	case "body":
+		html = fs.Bool("html", false, "print the HTML body instead of the plain text one")
+	case "attachments":
+		dir = fs.String("extract-dir", "", "save the attachments at this directory")
+	default:
+		usage()
+	}
+
+	fs.Parse(args)
+
+	msg, errs, err := load(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eml: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "eml: warning: %v\n", e)
+	}
+
+	switch cmd {
+	case "headers":
+		err = printHeaders(msg)
+	case "body":
+		if html != nil && *html {
+			_, err = fmt.Println(msg.Html)
+		} else {
+			_, err = fmt.Println(msg.Text)
+		}
+	case "attachments":
+		err = attachments(msg, *dir)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(msg)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eml: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// read and parse the message from a file or the standard input
+func load(path string) (eml.Message, []error, error) {
+	var data []byte
+	var err error
+
+	if path == "" || path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return eml.Message{}, nil, err
+	}
+
+	// Outlook messages are compound files
+	if bytes.HasPrefix(data, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}) {
+		msg, errs := outlook.Parse(data)
+		return msg, errs, nil
+	}
+
+	msg, errs := eml.Parse(data)
+	return msg, errs, nil
+}
+
+// print the decoded key headers followed by the raw header block
+func printHeaders(msg eml.Message) error {
+	list := func(al []eml.Address) string {
+		l := []string{}
+		for _, a := range al {
+			// show the display names decoded
+			if a.Email() != "" && a.Name() != a.Email() {
+				l = append(l, fmt.Sprintf("%s <%s>", a.Name(), a.Email()))
+				continue
+			}
+			l = append(l, a.String())
+		}
+		return strings.Join(l, ", ")
+	}
+
+	fmt.Printf("Message-ID: %s\n", msg.MessageID)
+	fmt.Printf("Date:       %s\n", msg.Date)
+	fmt.Printf("From:       %s\n", list(msg.From))
+	fmt.Printf("To:         %s\n", list(msg.To))
+	fmt.Printf("Cc:         %s\n", list(msg.Cc))
+	fmt.Printf("Subject:    %s\n", msg.Subject)
+	fmt.Println()
+
+	_, err := os.Stdout.Write(append(msg.Headers, '\n'))
+	return err
+}
+
+// list the attachments, saving them when a directory is given
+func attachments(msg eml.Message, dir string) error {
+	for i, a := range msg.Attachments {
+		fmt.Printf("%s\t%d bytes\n", a.Filename, len(a.Data))
+
+		if dir == "" {
+			continue
+		}
+
+		// never trust the paths sent at the filenames
+		name := a.SafeFilename()
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			name = fmt.Sprintf("%d-%s", i+1, name)
+		}
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), a.Data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+// Composition of the message data from the Message fields.
+
+package eml
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Compose builds the message data from the fields of the message, like the
+// ones made by Reply and Forward: the Date, Message-ID, From, Sender,
+// Reply-To, To, Cc, Subject, In-Reply-To and References headers, and a MIME
+// body with the Text, the Html and the Attachments. The inline attachments
+// with a Content-ID go along the Html at a multipart/related.
+//
+// The Bcc recipients are left out, see Serialize to include them. A Date
+// and a Message-ID are generated when missing, at each call. Unlike Raw,
+// the header fields not kept at the Message fields are not written.
+func (msg Message) Compose() ([]byte, error) {
+	if err := msg.setComposeDefaults(); err != nil {
+		return nil, err
+	}
+	return msg.composeData(nil)
+}
+
+// fill the Headers and Body of a built message with its composed data, so
+// Raw gives it. The Bcc recipients are kept, like at the parsed messages.
+func (msg *Message) compose() error {
+	if err := msg.setComposeDefaults(); err != nil {
+		return err
+	}
+
+	data, err := msg.composeData(msg.Bcc)
+	if err != nil {
+		return err
+	}
+
+	i := bytes.Index(data, []byte("\r\n\r\n"))
+	msg.Headers, msg.Body, msg.BodyOffset = data[:i], data[i+4:], i+4
+	return nil
+}
+
+// set the Date and Message-ID when missing, the ID at the domain of the
+// first From address
+func (msg *Message) setComposeDefaults() error {
+	if msg.Date.IsZero() {
+		msg.Date = time.Now()
+	}
+
+	if msg.MessageID == "" {
+		domain := ""
+		if len(msg.From) > 0 {
+			domain = msg.From[0].Domain()
+		}
+		id, err := GenerateMessageID(domain)
+		if err != nil {
+			return err
+		}
+		msg.MessageID = id
+	}
+
+	return nil
+}
+
+// build the message data, with a Bcc field for the given addresses
+func (msg Message) composeData(bcc []Address) ([]byte, error) {
+	var fields [][]byte
+	add := func(key, value string) error {
+		if value == "" {
+			return nil
+		}
+		f, err := newField(key, value, "\r\n")
+		if err != nil {
+			return err
+		}
+		fields = append(fields, f)
+		return nil
+	}
+
+	sender := ""
+	if msg.Sender != nil && (len(msg.From) != 1 || !AddressesEqual(msg.Sender, msg.From[0])) {
+		sender = msg.Sender.String()
+	}
+
+	body, err := msg.composeBody()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range []struct {
+		k string
+		v string
+	}{
+		{`Date`, msg.Date.Format(time.RFC1123Z)},
+		{`Message-ID`, formatMsgIDs([]string{msg.MessageID})},
+		{`From`, formatAddressList(msg.From)},
+		{`Sender`, sender},
+		{`Reply-To`, formatAddressList(msg.ReplyTo)},
+		{`To`, formatAddressList(msg.To)},
+		{`Cc`, formatAddressList(msg.Cc)},
+		{`Bcc`, formatAddressList(bcc)},
+		{`Subject`, string(EncodeHeader(msg.Subject, "UTF-8"))},
+		{`In-Reply-To`, formatMsgIDs(msg.InReply)},
+		{`References`, formatMsgIDs(msg.References)},
+		{`MIME-Version`, "1.0"},
+		{`Content-Type`, body.header.Get("Content-Type")},
+		{`Content-Transfer-Encoding`, body.header.Get("Content-Transfer-Encoding")},
+	} {
+		if err := add(h.k, h.v); err != nil {
+			return nil, err
+		}
+	}
+
+	data := append(bytes.Join(fields, nil), "\r\n"...)
+	return append(data, body.data...), nil
+}
+
+// join the addresses of a header, one by line
+func formatAddressList(al []Address) string {
+	l := make([]string, 0, len(al))
+	for _, a := range al {
+		l = append(l, a.String())
+	}
+	return strings.Join(l, ",\r\n ")
+}
+
+// join the message IDs of a header between angle brackets, one by line
+func formatMsgIDs(ids []string) string {
+	l := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id = strings.Trim(id, "<> "); id != "" {
+			l = append(l, "<"+id+">")
+		}
+	}
+	return strings.Join(l, "\r\n ")
+}
+
+// a body part being composed, with its encoded contents
+type composedPart struct {
+	header textproto.MIMEHeader
+	data   []byte
+}
+
+// build the MIME tree: the text versions as alternatives, the Html with its
+// inline images as related parts, and the attachments at a mixed multipart
+func (msg Message) composeBody() (composedPart, error) {
+	var related, attached []Attachment
+	for _, a := range msg.Attachments {
+		if a.Inline && a.ContentID != "" && msg.Html != "" {
+			related = append(related, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+
+	var html composedPart
+	if msg.Html != "" {
+		html = composeText("html", msg.Html)
+		if len(related) > 0 {
+			parts := []composedPart{html}
+			for _, a := range related {
+				parts = append(parts, composeAttachment(a))
+			}
+
+			var err error
+			if html, err = composeMultipart("related", parts); err != nil {
+				return composedPart{}, err
+			}
+		}
+	}
+
+	var body composedPart
+	switch {
+	case msg.Html != "" && msg.Text != "":
+		var err error
+		body, err = composeMultipart("alternative", []composedPart{composeText("plain", msg.Text), html})
+		if err != nil {
+			return composedPart{}, err
+		}
+	case msg.Html != "":
+		body = html
+	default:
+		body = composeText("plain", msg.Text)
+	}
+
+	if len(attached) == 0 {
+		return body, nil
+	}
+
+	parts := []composedPart{body}
+	for _, a := range attached {
+		parts = append(parts, composeAttachment(a))
+	}
+	return composeMultipart("mixed", parts)
+}
+
+// a UTF-8 text part, with CRLF line endings
+func composeText(subtype, text string) composedPart {
+	encoding, data := EncodeBody(normalizeLineEndings([]byte(text)), false)
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "text/"+subtype+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", encoding)
+	return composedPart{h, data}
+}
+
+// an attachment part, base64 encoded but the messages, which can't be
+// encoded (RFC 2046 section 5.2.1)
+func composeAttachment(a Attachment) composedPart {
+	ct := a.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	mt, ps, err := mime.ParseMediaType(ct)
+	if err != nil {
+		mt, ps = "application/octet-stream", map[string]string{}
+	}
+	if a.Filename != "" {
+		ps["name"] = a.Filename
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(mt, ps))
+
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+	}
+	if a.Filename != "" {
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	} else {
+		h.Set("Content-Disposition", disposition)
+	}
+	if a.ContentID != "" {
+		h.Set("Content-ID", "<"+strings.Trim(a.ContentID, "<>")+">")
+	}
+
+	if mt == "message/rfc822" {
+		data := normalizeLineEndings(a.Data)
+		h.Set("Content-Transfer-Encoding", DetectTransferEncoding(data))
+		return composedPart{h, data}
+	}
+
+	h.Set("Content-Transfer-Encoding", "base64")
+	return composedPart{h, EncodeBase64(a.Data)}
+}
+
+// a multipart holding the given parts
+func composeMultipart(subtype string, parts []composedPart) (composedPart, error) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	for _, p := range parts {
+		w, err := mw.CreatePart(p.header)
+		if err != nil {
+			return composedPart{}, err
+		}
+		if _, err := w.Write(p.data); err != nil {
+			return composedPart{}, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return composedPart{}, err
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": mw.Boundary()}))
+	return composedPart{h, b.Bytes()}, nil
+}
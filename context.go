@@ -0,0 +1,65 @@
+// Parsing bound to a context.
+
+package eml
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ParseContext is Parse stopping when the context is done, checked between
+// the headers processing, each MIME part and each part decoding. The
+// context error is returned along with the message parsed so far.
+func ParseContext(ctx context.Context, data []byte) (Message, []error) {
+	return ParseContextWithOptions(ctx, data, ParseOptions{})
+}
+
+// ParseContextWithOptions is ParseContext with the given parser options
+func ParseContextWithOptions(ctx context.Context, data []byte, opts ParseOptions) (Message, []error) {
+	if err := ctx.Err(); err != nil {
+		return Message{}, []error{fmt.Errorf("raw parsing: %w", err)}
+	}
+
+	opts.ctx = ctx
+	return ParseWithOptions(data, opts)
+}
+
+// ParseReader reads the whole message from r and parses it
+func ParseReader(r io.Reader) (Message, []error) {
+	return ParseReaderContext(context.Background(), r, ParseOptions{})
+}
+
+// ParseReaderContext reads the whole message from r, checking the context
+// between the reads, and parses it like ParseContextWithOptions
+func ParseReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) (Message, []error) {
+	data, err := readAllContext(ctx, r)
+	if err != nil {
+		return Message{}, []error{fmt.Errorf("raw parsing: %w", err)}
+	}
+
+	return ParseContextWithOptions(ctx, data, opts)
+}
+
+// read until EOF, stopping when the context is done
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	b := make([]byte, 0, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
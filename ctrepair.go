@@ -0,0 +1,116 @@
+// Repair of malformed Content-Type values.
+
+package eml
+
+import (
+	"mime"
+	"regexp"
+	"strings"
+)
+
+var boundaryR = regexp.MustCompile(`(?i)boundary\s*=\s*"?([^";\r\n]+)"?`)
+
+// split a header value at the semicolons that are out of quotes
+func splitParams(v string) (l []string) {
+	quoted, start := false, 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				l = append(l, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(l, v[start:])
+}
+
+// rebuild a Content-Type value that mime.ParseMediaType rejects: comments,
+// stray semicolons and parameters without value are dropped, only the
+// first of the duplicated parameters is kept, values are quoted again, a
+// bare charset means text/plain and the boundary is found even inside
+// garbage
+func repairContentType(ct string) string {
+	ct = strings.TrimSpace(stripComments(string(unfold([]byte(ct)))))
+	fields := splitParams(ct)
+
+	mt := strings.ToLower(strings.TrimSpace(fields[0]))
+	params := map[string]string{}
+
+	// a value starting by a parameter has no media type, while a missing
+	// semicolon glues the first parameter to it
+	if k, _, ok := strings.Cut(fields[0], "="); ok {
+		if t := strings.Fields(k); len(t) > 1 && strings.Contains(t[0], "/") {
+			fields = append([]string{t[0], strings.TrimPrefix(strings.TrimSpace(fields[0]), t[0])}, fields[1:]...)
+			mt = strings.ToLower(t[0])
+		} else {
+			fields = append([]string{""}, fields...)
+			mt = "text/plain"
+		}
+	}
+
+	// strip comments and garbage around the media type
+	if f := strings.Fields(stripComments(mt)); len(f) > 0 {
+		mt = strings.Trim(f[0], `"'`)
+	} else {
+		mt = ""
+	}
+	if !strings.Contains(mt, "/") {
+		switch mt {
+		case "text", "":
+			mt = "text/plain"
+		case "multipart":
+			mt = "multipart/mixed"
+		default:
+			mt = "application/octet-stream"
+		}
+	}
+
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok || k == "" || strings.ContainsAny(k, " \t\"") {
+			continue
+		}
+
+		if _, dup := params[k]; dup {
+			continue
+		}
+
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+		} else {
+			v = strings.Trim(v, `"`)
+		}
+
+		params[k] = v
+	}
+
+	if params["boundary"] == "" && strings.HasPrefix(mt, "multipart/") {
+		if m := boundaryR.FindStringSubmatch(ct); m != nil {
+			params["boundary"] = strings.TrimSpace(m[1])
+		}
+	}
+	if params["boundary"] == "" {
+		delete(params, "boundary")
+	}
+
+	if r := mime.FormatMediaType(mt, params); r != "" {
+		return r
+	}
+
+	// the parameters with values that can't be formatted are dropped
+	for k, v := range params {
+		if mime.FormatMediaType(mt, map[string]string{k: v}) == "" {
+			delete(params, k)
+		}
+	}
+
+	return mime.FormatMediaType(mt, params)
+}
@@ -1,37 +1,189 @@
 package eml
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// formats tried over the normalized date: without the day of week,
+// comments and with the zone converted to a numeric offset
 var dateFormats = []string{
-	`Mon, 02 Jan 2006 15:04 -0700`,
-	`02 Jan 2006 15:04 -0700`,
-	`Mon, 02 Jan 2006 15:04:05 -0700`,
-	`02 Jan 2006 15:04:05 -0700`,
+	`2 Jan 2006 15:04:05 -0700`,
+	`2 Jan 2006 15:04 -0700`,
+	`2 Jan 2006 15:04:05`,
+	`2 Jan 2006 15:04`,
 
-	`Mon, 02 Jan 2006 15:04 -0700 (MST)`,
-	`02 Jan 2006 15:04 -0700 (MST)`,
-	`Mon, 02 Jan 2006 15:04:05 -0700 (MST)`,
-	`02 Jan 2006 15:04:05 -0700 (MST)`,
+	`2 Jan 06 15:04:05 -0700`,
+	`2 Jan 06 15:04 -0700`,
+	`2 Jan 06 15:04:05`,
+	`2 Jan 06 15:04`,
 
-	`Mon, 2 Jan 2006 15:04 -0700`,
-	`2 Jan 2006 15:04 -0700`,
-	`Mon, 2 Jan 2006 15:04:05 -0700`,
-	`2 Jan 2006 15:04:05 -0700`,
+	`Jan 2 15:04:05 2006`,
+	`Jan 2 15:04:05 -0700 2006`,
+	`Jan 2 2006 15:04:05 -0700`,
+
+	`2006-01-02T15:04:05Z07:00`,
+	`2006-01-02 15:04:05 -0700`,
+	`2006-01-02 15:04:05`,
+}
 
-	`Mon, 2 Jan 2006 15:04 -0700 (MST)`,
-	`2 Jan 2006 15:04 -0700 (MST)`,
-	`Mon, 2 Jan 2006 15:04:05 -0700 (MST)`,
-	`2 Jan 2006 15:04:05 -0700 (MST)`,
+// obsolete zone names from RFC 5322 section 4.3, plus some common ones
+var obsoleteZones = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000",
+	"EST": "-0500", "EDT": "-0400",
+	"CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600",
+	"PST": "-0800", "PDT": "-0700",
+	"CET": "+0100", "CEST": "+0200",
+	"BST": "+0100", "IST": "+0530", "JST": "+0900",
 }
 
+// month names prefixes of common locales, mapped to the english ones
+var localeMonths = map[string]string{
+	"jan": "Jan", "janv": "Jan", "ene": "Jan", "gen": "Jan", "jän": "Jan",
+	"feb": "Feb", "fév": "Feb", "fev": "Feb", "févr": "Feb", "fevr": "Feb",
+	"mar": "Mar", "mär": "Mar", "mars": "Mar", "mrt": "Mar", "marz": "Mar",
+	"apr": "Apr", "avr": "Apr", "abr": "Apr",
+	"may": "May", "mai": "May", "mag": "May", "mei": "May", "mayo": "May",
+	"jun": "Jun", "juin": "Jun", "giu": "Jun", "juni": "Jun",
+	"jul": "Jul", "juil": "Jul", "lug": "Jul", "juli": "Jul",
+	"aug": "Aug", "août": "Aug", "aout": "Aug", "ago": "Aug",
+	"sep": "Sep", "sept": "Sep", "set": "Sep",
+	"oct": "Oct", "okt": "Oct", "ott": "Oct", "out": "Oct",
+	"nov": "Nov",
+	"dec": "Dec", "déc": "Dec", "dez": "Dec", "dic": "Dec",
+}
+
+var (
+	gmtOffsetR = regexp.MustCompile(`^(?:GMT|UTC|UT)?([+-])(\d{1,2}):?(\d{2})?$`)
+	weekdayR   = regexp.MustCompile(`^(?i)(mon|tue|wed|thu|fri|sat|sun)[a-z]*,?$`)
+
+	// obsolete times with whitespace around the colons, like "09 : 55"
+	obsTimeR = regexp.MustCompile(`(\d)\s*:\s*(\d)`)
+)
+
+// DateError is returned when a date header value can't be parsed
+type DateError struct {
+	Value string // the raw header value
+}
+
+func (e *DateError) Error() string {
+	return fmt.Sprintf("unparseable date %q", e.Value)
+}
+
+// ParseDate parses a date header value, returning the current time when
+// the value can't be parsed
 func ParseDate(s string) time.Time {
-	for _, fmt := range dateFormats {
-		t, e := time.Parse(fmt, s)
-		if e == nil {
-			return t
+	t, err := ParseDateErr(s)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// ParseDateErr parses a date header value, tolerating comments, obsolete
+// zone names, two digits years and localized month names. Dates without a
+// zone are taken as UTC.
+func ParseDateErr(s string) (time.Time, error) {
+	return parseDate(s, time.UTC)
+}
+
+// parse a date taking the ones without zone at the given location
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	n := normalizeDate(s)
+
+	for _, f := range dateFormats {
+		t, e := time.ParseInLocation(f, n, loc)
+		if e != nil {
+			continue
+		}
+
+		// two digits years from 00 to 49 are at the 2000s and from 50
+		// to 99 at the 1900s (RFC 5322 section 4.3)
+		if strings.Contains(f, " 06 ") && t.Year() >= 2050 {
+			t = t.AddDate(-100, 0, 0)
 		}
+
+		return t, nil
 	}
-	return time.Now()
+
+	return time.Time{}, &DateError{Value: s}
+}
+
+// rewrite a date value into the shape expected by the dateFormats
+func normalizeDate(s string) string {
+	s = obsTimeR.ReplaceAllString(stripComments(s), "$1:$2")
+	fields := strings.Fields(strings.ReplaceAll(s, ",", ", "))
+
+	var out []string
+	zone := ""
+	for i, f := range fields {
+		f = strings.TrimSuffix(f, ",")
+		if f == "" {
+			continue
+		}
+
+		// drop the day of week, in any locale when followed by a comma
+		if i == 0 && (weekdayR.MatchString(f) || strings.HasSuffix(fields[0], ",")) {
+			continue
+		}
+
+		// numeric offsets, also as +hh:mm or GMT+h
+		if m := gmtOffsetR.FindStringSubmatch(f); m != nil {
+			if zone == "" {
+				h, mm := m[2], m[3]
+				if len(h) == 1 {
+					h = "0" + h
+				}
+				if mm == "" {
+					mm = "00"
+				}
+				zone = m[1] + h + mm
+				out = append(out, zone)
+			}
+			continue
+		}
+
+		if z, ok := obsoleteZones[strings.ToUpper(f)]; ok {
+			if zone == "" {
+				zone = z
+				out = append(out, zone)
+			}
+			continue
+		}
+
+		// military zones are unreliable, RFC 5322 says to treat them as
+		// -0000
+		if len(f) == 1 && ((f[0] >= 'A' && f[0] <= 'Z') || (f[0] >= 'a' && f[0] <= 'z')) {
+			if zone == "" {
+				zone = "-0000"
+				out = append(out, zone)
+			}
+			continue
+		}
+
+		if m, ok := localeMonths[strings.ToLower(strings.TrimSuffix(f, "."))]; ok {
+			f = m
+		}
+
+		// three digits years are added to 1900 (RFC 5322 section 4.3)
+		if len(f) == 3 && i > 0 && len(out) > 0 && isMonth(out[len(out)-1]) {
+			if y, err := strconv.Atoi(f); err == nil {
+				f = strconv.Itoa(1900 + y)
+			}
+		}
+
+		out = append(out, f)
+	}
+
+	return strings.Join(out, " ")
+}
+
+// check if a normalized date field is an english month name
+func isMonth(f string) bool {
+	_, err := time.Parse("Jan", f)
+	return err == nil
 }
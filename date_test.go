@@ -0,0 +1,41 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+// the military zones are unreliable and taken as -0000, an unknown local
+// zone (RFC 5322 section 4.3), unlike UT and GMT
+func TestDateZones(t *testing.T) {
+	tests := []struct {
+		in     string
+		zone   string
+		offset int // seconds east of UTC
+	}{
+		{"Mon, 2 Jan 2006 15:04:05 A", "-0000", 0},
+		{"Mon, 2 Jan 2006 15:04:05 m", "-0000", 0},
+		{"Mon, 2 Jan 2006 15:04:05 Y", "-0000", 0},
+		{"Mon, 2 Jan 2006 15:04:05 UT", "+0000", 0},
+		{"Mon, 2 Jan 2006 15:04:05 GMT", "+0000", 0},
+		{"Mon, 2 Jan 2006 15:04:05 EST", "-0500", -5 * 3600},
+		{"Mon, 2 Jan 2006 15:04:05 -0000", "-0000", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			n := normalizeDate(tt.in)
+			if !strings.HasSuffix(n, " "+tt.zone) {
+				t.Errorf("normalized = %q, want the %s zone", n, tt.zone)
+			}
+
+			d, err := ParseDateErr(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, offset := d.Zone(); offset != tt.offset || d.Hour() != 15 {
+				t.Errorf("date = %v", d)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package eml
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
-	"mime"
+	"regexp"
 	"strings"
 
 	"github.com/paulrosania/go-charset/charset"
@@ -12,51 +13,157 @@ import (
 	goCharset "golang.org/x/net/html/charset"
 )
 
+// an RFC 2047 encoded-word, tolerating whitespace inside the encoded text
+// left by mailers that fold the header in the middle of a word
+var encodedWordR = regexp.MustCompile(`=\?([^?\s]+)\?([bBqQ])\?([^?]*)\?=`)
+
 func UTF8(cs string, data []byte) ([]byte, error) {
-	if strings.ToUpper(cs) == "UTF-8" {
+	switch strings.ToUpper(strings.TrimSpace(cs)) {
+	case "UTF-8", "UTF8", "US-ASCII":
 		return data, nil
 	}
 
 	r, err := charset.NewReader(cs, bytes.NewReader(data))
 	if err != nil {
-		return []byte{}, err
+		// fallback to the WHATWG encodings list, which knows more aliases
+		enc, _ := goCharset.Lookup(cs)
+		if enc == nil {
+			return []byte{}, err
+		}
+		r = enc.NewDecoder().Reader(bytes.NewReader(data))
 	}
 
 	return io.ReadAll(r)
 }
 
+// Decode decodes the RFC 2047 encoded-words of a header value. The words
+// that can't be decoded are kept as they are, so the error is always nil,
+// kept for compatibility.
 func Decode(bstr []byte) (p []byte, err error) {
-	header, err := decodeRFC2047(bstr)
-	if err != nil {
-		return bstr, nil
-	}
-
-	return header, err
+	header, _ := decodeRFC2047(bstr)
+	return header, nil
 }
 
+// decode the encoded-words of a header value following RFC 2047 section
+// 6.2: the whitespace between adjacent encoded-words is dropped and the
+// bytes of adjacent words in the same charset are joined before the charset
+// conversion, so multibyte characters split between words are kept. The
+// words that can't be decoded are kept as they are, and the first failure
+// is returned along with the best effort result.
 func decodeRFC2047(d []byte) (r []byte, err error) {
-	dec := new(mime.WordDecoder)
-	p, err := dec.DecodeHeader(string(d))
-	if err != nil {
-		return d, nil
+	d = unfold(d)
+	if !bytes.Contains(d, []byte("=?")) {
+		return append([]byte{}, d...), nil
+	}
+
+	var pending, pendingRaw []byte
+	pendingCharset := ""
+
+	flush := func() {
+		if pendingRaw == nil {
+			return
+		}
+
+		data, e := UTF8(pendingCharset, pending)
+		if e != nil {
+			if err == nil {
+				err = fmt.Errorf("unknown charset %q: %v", pendingCharset, e)
+			}
+			r = append(r, pendingRaw...)
+		} else {
+			r = append(r, data...)
+		}
+
+		pending, pendingRaw = nil, nil
+	}
+
+	last := 0
+	for _, m := range encodedWordR.FindAllSubmatchIndex(d, -1) {
+		// the whitespace between two encoded-words is ignored
+		text := d[last:m[0]]
+		if pendingRaw == nil || len(bytes.TrimSpace(text)) > 0 {
+			flush()
+			r = append(r, text...)
+		}
+		last = m[1]
+
+		// the charset may carry an RFC 2231 language suffix (utf-8*en)
+		cs, _, _ := strings.Cut(string(d[m[2]:m[3]]), "*")
+		data, e := decodeEncodedText(string(d[m[4]:m[5]]), string(d[m[6]:m[7]]))
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			flush()
+			r = append(r, d[m[0]:m[1]]...)
+			continue
+		}
+
+		if pendingRaw != nil && !strings.EqualFold(cs, pendingCharset) {
+			flush()
+		}
+
+		pendingCharset = cs
+		pending = append(pending, data...)
+		pendingRaw = append(pendingRaw, d[m[0]:m[1]]...)
 	}
 
-	return []byte(p), err
+	flush()
+	r = append(r, d[last:]...)
+
+	return r, err
 }
 
-func DecodeString(s string) (o string, err error) {
-	CharsetReader := func(label string, input io.Reader) (io.Reader, error) {
-		label = strings.Replace(label, "windows-", "cp", -1)
-		enc, _ := goCharset.Lookup(label)
-		return enc.NewDecoder().Reader(input), nil
+// decode the text of an encoded-word with the B or Q encoding
+func decodeEncodedText(enc, text string) ([]byte, error) {
+	// encoded text never has whitespace, it comes from a bad folding
+	text = strings.Join(strings.Fields(text), "")
+
+	if strings.ToUpper(enc) == "B" {
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(text, "="))
+		if err != nil {
+			return nil, fmt.Errorf("failed decode encoded-word [msg: %v]", err)
+		}
+		return data, nil
+	}
+
+	// Q encoding, invalid escapes are kept as they are
+	var data []byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '_':
+			data = append(data, ' ')
+		case c == '=' && i+2 < len(text) && isHex(text[i+1]) && isHex(text[i+2]):
+			data = append(data, unhex(text[i+1])<<4|unhex(text[i+2]))
+			i += 2
+		default:
+			data = append(data, c)
+		}
 	}
 
-	mimeDecoder := mime.WordDecoder{CharsetReader: CharsetReader}
-	decodedHeader, err := mimeDecoder.DecodeHeader(s)
+	return data, nil
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
 
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func DecodeString(s string) (o string, err error) {
+	decodedHeader, err := decodeRFC2047([]byte(s))
 	if err != nil {
-		return decodedHeader, fmt.Errorf("cannot decode MIME-word-encoded header %q: %w", s, err)
+		return string(decodedHeader), fmt.Errorf("cannot decode MIME-word-encoded header %q: %w", s, err)
 	}
 
-	return decodedHeader, nil
+	return string(decodedHeader), nil
 }
@@ -0,0 +1,58 @@
+package eml
+
+import (
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		fail bool // decodeRFC2047 reports an error
+	}{
+		{"plain text", "plain text", false},
+		{"=?UTF-8?Q?Caf=C3=A9?=", "Café", false},
+		{"=?UTF-8?Q?hello_world?=", "hello world", false},
+		{"=?UTF-8?B?w6k=?=", "é", false},
+		{"=?utf-8*fr?q?caf=C3=A9?=", "café", false},
+
+		// the whitespace between adjacent words is dropped, folded or not
+		{"=?ISO-8859-1?Q?a?= =?ISO-8859-1?Q?b?=", "ab", false},
+		{"=?utf-8?q?a?=\r\n\t=?utf-8?q?b?=", "ab", false},
+		{"=?UTF-8?Q?a?= x =?UTF-8?Q?b?=", "a x b", false},
+
+		// a character split between two words
+		{"=?UTF-8?B?4oI=?==?UTF-8?B?rA==?=", "€", false},
+		{"=?UTF-8?Q?=E2=82?= =?UTF-8?Q?=AC?=", "€", false},
+
+		// other charsets, mixed in the same value
+		{"=?ISO-8859-1?Q?caf=E9?= =?UTF-8?Q?_=E2=82=AC?=", "café €", false},
+		{"=?windows-1252?Q?=93q=94?=", "“q”", false},
+		{"=?koi8-r?B?8NLJ18XU?=", "Привет", false},
+
+		// a folded word, split by the mailer
+		{"=?UTF-8?Q?a b?=", "ab", false},
+
+		// the words that can't be decoded are kept
+		{"=?x-unknown?Q?abc?= ok", "=?x-unknown?Q?abc?= ok", true},
+		{"=?UTF-8?B?bad*?=", "=?UTF-8?B?bad*?=", true},
+		{"plain =?", "plain =?", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := decodeRFC2047([]byte(tt.in))
+			if string(r) != tt.want {
+				t.Errorf("decodeRFC2047 = %q, want %q", r, tt.want)
+			}
+			if (err != nil) != tt.fail {
+				t.Errorf("decodeRFC2047 error = %v", err)
+			}
+
+			d, err := Decode([]byte(tt.in))
+			if string(d) != tt.want || err != nil {
+				t.Errorf("Decode = %q, %v, want %q", d, err, tt.want)
+			}
+		})
+	}
+}
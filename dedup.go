@@ -0,0 +1,97 @@
+// Attachments deduplication by the hash of their contents.
+
+package eml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// get the hex encoded SHA-256 of the contents of an attachment
+func attachmentHash(a Attachment) string {
+	if a.SHA256 != "" || a.Skipped {
+		return a.SHA256
+	}
+	sum := sha256.Sum256(a.Data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DedupAttachments gives the attachments of the message without the
+// repeated contents, the first of each one being kept, in order. The
+// hashes missing because of ParseOptions.HashAttachments being off are
+// computed. The skipped attachments are always kept.
+func (msg Message) DedupAttachments() (l []Attachment) {
+	seen := make(map[string]bool)
+	for _, a := range msg.Attachments {
+		a.SHA256 = attachmentHash(a)
+		if a.SHA256 != "" && seen[a.SHA256] {
+			continue
+		}
+		seen[a.SHA256] = true
+		l = append(l, a)
+	}
+	return
+}
+
+// AttachmentStore keeps the attachments of many messages storing each
+// content once, like the same file attached to a whole thread of replies.
+// It is safe for concurrent use.
+type AttachmentStore struct {
+	mu    sync.Mutex
+	files map[string]Attachment
+	refs  map[string]int
+}
+
+// NewAttachmentStore makes an empty store
+func NewAttachmentStore() *AttachmentStore {
+	return &AttachmentStore{files: make(map[string]Attachment), refs: make(map[string]int)}
+}
+
+// Add stores the attachments of a message which were not seen before,
+// returning the hash of each attachment in order, empty for the skipped
+// ones, so the message can refer to them
+func (s *AttachmentStore) Add(msg Message) (hashes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range msg.Attachments {
+		h := attachmentHash(a)
+		hashes = append(hashes, h)
+		if h == "" {
+			continue
+		}
+
+		if _, ok := s.files[h]; !ok {
+			a.SHA256 = h
+			s.files[h] = a
+		}
+		s.refs[h]++
+	}
+	return
+}
+
+// Get gives the first attachment stored with the given hash
+func (s *AttachmentStore) Get(hash string) (Attachment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.files[hash]
+	return a, ok
+}
+
+// Refs gives the number of times a content was added
+func (s *AttachmentStore) Refs(hash string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refs[hash]
+}
+
+// Len gives the number of different contents stored
+func (s *AttachmentStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.files)
+}
@@ -0,0 +1,171 @@
+// Comparison of two copies of a message.
+
+package eml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// DiffKind tells how a header field or part differs between the messages
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// Difference is a header field or leaf part that differs between the
+// messages. The values are the unfolded header values, or the type and
+// SHA-256 of the decoded contents for the parts.
+type Difference struct {
+	Kind   DiffKind `json:"kind"`
+	Header string   `json:"header,omitempty"` // lowercase name of the header field
+	Part   string   `json:"part,omitempty"`   // IMAP section of the part, like "1.2"
+	Old    string   `json:"old"`              // empty when added
+	New    string   `json:"new"`              // empty when removed
+}
+
+// DiffOptions tunes DiffWithOptions
+type DiffOptions struct {
+	// IgnoreTransport leaves out the header fields added by the servers on
+	// the way, like Received or DKIM-Signature
+	IgnoreTransport bool
+
+	// IgnoreHeaders are other header fields left out
+	IgnoreHeaders []string
+}
+
+// Diff compares the header fields and the leaf parts of the messages, like
+// two copies taken before and after a gateway, see DiffWithOptions
+func Diff(a, b Message) []Difference {
+	return DiffWithOptions(a, b, DiffOptions{})
+}
+
+// DiffWithOptions compares the messages, the header fields first, in the
+// order of a, then the parts. The fields with the same name are compared
+// by position. The parts are matched by the hash of their decoded contents,
+// so the moved ones are not reported, and the others by section.
+func DiffWithOptions(a, b Message, opts DiffOptions) (l []Difference) {
+	ha, names := diffHeaders(a, opts)
+	hb, namesB := diffHeaders(b, opts)
+	for _, n := range namesB {
+		if _, ok := ha[n]; !ok {
+			names = append(names, n)
+		}
+	}
+
+	for _, n := range names {
+		va, vb := ha[n], hb[n]
+		for i := 0; i < len(va) || i < len(vb); i++ {
+			switch {
+			case i >= len(vb):
+				l = append(l, Difference{Kind: DiffRemoved, Header: n, Old: va[i]})
+			case i >= len(va):
+				l = append(l, Difference{Kind: DiffAdded, Header: n, New: vb[i]})
+			case va[i] != vb[i]:
+				l = append(l, Difference{Kind: DiffChanged, Header: n, Old: va[i], New: vb[i]})
+			}
+		}
+	}
+
+	return append(l, diffParts(a, b)...)
+}
+
+// get the unfolded values of the header fields by lowercase name, and the
+// names in order
+func diffHeaders(msg Message, opts DiffOptions) (values map[string][]string, names []string) {
+	values = make(map[string][]string)
+	for _, f := range splitHeaderFields(msg.Headers) {
+		name := headerFieldName(f)
+		if name == "" || (opts.IgnoreTransport && isTransportHeader(name)) || containsFold(opts.IgnoreHeaders, name) {
+			continue
+		}
+
+		_, v, _ := bytes.Cut(f, []byte(":"))
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], strings.TrimSpace(string(unfold(v))))
+	}
+	return
+}
+
+// leaf part of a message being compared
+type diffPart struct {
+	section string
+	value   string // type and hash
+	matched bool
+}
+
+// compare the leaf parts, by hash and then by section
+func diffParts(a, b Message) (l []Difference) {
+	pa, pb := diffLeaves(a.Root, ""), diffLeaves(b.Root, "")
+
+	// the same contents at any position
+	for i := range pa {
+		for j := range pb {
+			if !pb[j].matched && pa[i].value == pb[j].value {
+				pa[i].matched, pb[j].matched = true, true
+				break
+			}
+		}
+	}
+
+	// the contents changed at the same position
+	for i := range pa {
+		if pa[i].matched {
+			continue
+		}
+		for j := range pb {
+			if !pb[j].matched && pa[i].section == pb[j].section {
+				pa[i].matched, pb[j].matched = true, true
+				l = append(l, Difference{Kind: DiffChanged, Part: pa[i].section, Old: pa[i].value, New: pb[j].value})
+				break
+			}
+		}
+		if !pa[i].matched {
+			l = append(l, Difference{Kind: DiffRemoved, Part: pa[i].section, Old: pa[i].value})
+		}
+	}
+
+	for _, p := range pb {
+		if !p.matched {
+			l = append(l, Difference{Kind: DiffAdded, Part: p.section, New: p.value})
+		}
+	}
+
+	return
+}
+
+// list the leaf parts numbered as the IMAP sections
+func diffLeaves(p Part, section string) (l []diffPart) {
+	if p.Children == nil {
+		if p.Type == "" {
+			return nil
+		}
+		if section == "" {
+			section = "1"
+		}
+
+		t := p.MediaType.String()
+		if t == "" {
+			t = p.Type
+		}
+		sum := sha256.Sum256(p.Data)
+		return []diffPart{{section: section, value: t + " sha256:" + hex.EncodeToString(sum[:])}}
+	}
+
+	for i, c := range p.Children {
+		sub := strconv.Itoa(i + 1)
+		if section != "" {
+			sub = section + "." + sub
+		}
+		l = append(l, diffLeaves(c, sub)...)
+	}
+	return
+}
@@ -0,0 +1,423 @@
+// DKIM signatures handling, also shared by the ARC chain validation.
+
+package eml
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Resolver looks up the DNS TXT records that hold the signers public keys.
+// A *net.Resolver satisfies this interface.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// parse a tag=value; tag=value list as used by the DKIM-Signature header
+func parseTagList(v []byte) map[string]string {
+	tags := make(map[string]string)
+
+	for _, t := range strings.Split(string(v), ";") {
+		k, val, ok := strings.Cut(t, "=")
+		if !ok {
+			continue
+		}
+
+		// folding whitespace is allowed anywhere inside the values
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(val), "")
+	}
+
+	return tags
+}
+
+// split the raw header block into its fields, keeping the folding and line
+// endings of each one untouched
+func splitHeaderFields(h []byte) (fields [][]byte) {
+	start := 0
+	for i := 0; i < len(h); i++ {
+		if h[i] != '\n' {
+			continue
+		}
+
+		// a line starting with whitespace continues the current field
+		if i+1 < len(h) && isWSP(h[i+1]) {
+			continue
+		}
+
+		fields = append(fields, h[start:i+1])
+		start = i + 1
+	}
+
+	if start < len(h) {
+		fields = append(fields, h[start:])
+	}
+
+	return
+}
+
+// get the lowercase name of a raw header field
+func headerFieldName(f []byte) string {
+	k, _, _ := bytes.Cut(f, []byte(":"))
+	return strings.ToLower(string(bytes.TrimSpace(k)))
+}
+
+// canonicalize a single header field with the simple or relaxed algorithm
+// from RFC 6376 section 3.4
+func canonicalizeHeader(f []byte, relaxed bool) []byte {
+	if !relaxed {
+		// the simple algorithm only fixes the line endings, which were
+		// CRLF at the wire
+		f = bytes.TrimRight(f, "\r\n")
+		f = bytes.ReplaceAll(bytes.ReplaceAll(f, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+		return append(f, '\r', '\n')
+	}
+
+	k, v, _ := bytes.Cut(f, []byte(":"))
+
+	// unfold the value and compress the whitespace runs
+	v = bytes.ReplaceAll(v, []byte("\r"), nil)
+	v = bytes.ReplaceAll(v, []byte("\n"), nil)
+	v = []byte(strings.Join(strings.FieldsFunc(string(v), func(r rune) bool {
+		return r == ' ' || r == '\t'
+	}), " "))
+
+	out := []byte(strings.ToLower(string(bytes.TrimSpace(k))))
+	out = append(out, ':')
+	out = append(out, v...)
+	return append(out, '\r', '\n')
+}
+
+// canonicalize the message body with the simple or relaxed algorithm from
+// RFC 6376 section 3.4
+func canonicalizeBody(b []byte, relaxed bool) []byte {
+	// work over CRLF lines regardless of the stored line endings
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	lines := strings.Split(string(b), "\n")
+
+	if relaxed {
+		for i, l := range lines {
+			l = strings.TrimRight(l, " \t")
+			lines[i] = strings.Join(strings.FieldsFunc(l, func(r rune) bool {
+				return r == ' ' || r == '\t'
+			}), " ")
+			if strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") {
+				lines[i] = " " + lines[i]
+			}
+		}
+	}
+
+	// ignore all the empty lines at the end of the body
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		if relaxed {
+			return []byte{}
+		}
+		return []byte("\r\n")
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// Canonicalization is a DKIM canonicalization algorithm (RFC 6376 section
+// 3.4), as named at the c= tag
+type Canonicalization string
+
+const (
+	CanonicalizationSimple  Canonicalization = "simple"
+	CanonicalizationRelaxed Canonicalization = "relaxed"
+)
+
+// CanonicalizeHeaders canonicalizes each field of a raw header block, in
+// order, with CRLF line endings. The blank line ending the block, if
+// present, is left out.
+func CanonicalizeHeaders(raw []byte, mode Canonicalization) []byte {
+	var out []byte
+	for _, f := range splitHeaderFields(raw) {
+		if len(bytes.TrimRight(f, "\r\n")) == 0 {
+			continue
+		}
+		out = append(out, canonicalizeHeader(f, mode == CanonicalizationRelaxed)...)
+	}
+	return out
+}
+
+// CanonicalizeBody canonicalizes a raw message body, with CRLF line
+// endings, as hashed by the DKIM signatures
+func CanonicalizeBody(raw []byte, mode Canonicalization) []byte {
+	return canonicalizeBody(raw, mode == CanonicalizationRelaxed)
+}
+
+// parse the c= tag into the header and body algorithms
+func parseCanonicalization(c string) (header, body bool) {
+	h, b, _ := strings.Cut(strings.ToLower(c), "/")
+	return h == "relaxed", b == "relaxed"
+}
+
+// return a copy of a signature header field with the b= value removed
+func stripSignatureValue(f []byte) []byte {
+	tags := bytes.Split(f, []byte(";"))
+	for i, t := range tags {
+		k, _, ok := bytes.Cut(t, []byte("="))
+		if !ok {
+			continue
+		}
+
+		// the first tag also carries the header name
+		if j := bytes.IndexByte(k, ':'); j >= 0 && i == 0 {
+			k = k[j+1:]
+		}
+
+		if string(bytes.TrimSpace(k)) == "b" {
+			tags[i] = t[:bytes.IndexByte(t, '=')+1]
+		}
+	}
+
+	return bytes.Join(tags, []byte(";"))
+}
+
+// select the header fields listed at h= the way RFC 6376 section 5.4.2
+// describes: from the bottom up, each field being used only once
+func selectHeaderFields(fields [][]byte, names []string) (selected [][]byte) {
+	used := make(map[int]bool)
+
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && headerFieldName(fields[i]) == n {
+				used[i] = true
+				selected = append(selected, fields[i])
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// get the hash function for a signature algorithm
+func signatureHash(a string) (crypto.Hash, func() hash.Hash, error) {
+	switch strings.ToLower(a) {
+	case "rsa-sha256", "ed25519-sha256":
+		return crypto.SHA256, sha256.New, nil
+	case "rsa-sha1":
+		return crypto.SHA1, sha1.New, nil
+	}
+
+	return 0, nil, fmt.Errorf("unsupported signature algorithm %q", a)
+}
+
+// fetch and parse the public key published at selector._domainkey.domain
+func lookupPublicKey(r Resolver, selector, domain string) (crypto.PublicKey, error) {
+	txts, err := r.LookupTXT(context.Background(), selector+"._domainkey."+domain)
+	if err != nil {
+		return nil, fmt.Errorf("public key lookup: %v", err)
+	}
+
+	if len(txts) == 0 {
+		return nil, errors.New("public key lookup: no record found")
+	}
+
+	tags := parseTagList([]byte(strings.Join(txts, "")))
+	if tags["p"] == "" {
+		return nil, errors.New("public key lookup: key revoked")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, fmt.Errorf("public key lookup: failed decode key [msg: %v]", err)
+	}
+
+	if strings.ToLower(tags["k"]) == "ed25519" {
+		if len(data) != ed25519.PublicKeySize {
+			return nil, errors.New("public key lookup: invalid ed25519 key")
+		}
+		return ed25519.PublicKey(data), nil
+	}
+
+	// RSA keys are usually PKIX encoded, but some signers publish PKCS1
+	if k, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return k, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(data)
+}
+
+// check a signature over the given digest
+func verifySignature(key crypto.PublicKey, h crypto.Hash, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, h, digest, sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest, sig) {
+			return errors.New("ed25519: verification error")
+		}
+		return nil
+	}
+
+	return errors.New("unsupported public key type")
+}
+
+// verify a DKIM style signature header (DKIM-Signature or
+// ARC-Message-Signature) against the message header fields and body
+func verifyHeaderSignature(r Resolver, sigField []byte, fields [][]byte, body []byte) error {
+	_, v, _ := bytes.Cut(sigField, []byte(":"))
+	tags := parseTagList(v)
+
+	h, newHash, err := signatureHash(tags["a"])
+	if err != nil {
+		return err
+	}
+
+	headerRelaxed, bodyRelaxed := parseCanonicalization(tags["c"])
+
+	// check the body hash first, it's cheaper than a DNS lookup
+	bh := newHash()
+	bh.Write(canonicalizeBody(body, bodyRelaxed))
+	if base64.StdEncoding.EncodeToString(bh.Sum(nil)) != tags["bh"] {
+		return errors.New("body hash mismatch")
+	}
+
+	hh := newHash()
+	for _, f := range selectHeaderFields(fields, strings.Split(tags["h"], ":")) {
+		hh.Write(canonicalizeHeader(f, headerRelaxed))
+	}
+
+	// the signature header itself is hashed without b= and the final CRLF
+	hh.Write(bytes.TrimSuffix(canonicalizeHeader(stripSignatureValue(sigField), headerRelaxed), []byte("\r\n")))
+
+	return checkSignature(r, tags, h, hh.Sum(nil))
+}
+
+// resolve the signer key and check the b= value over the digest
+func checkSignature(r Resolver, tags map[string]string, h crypto.Hash, digest []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("failed decode signature [msg: %v]", err)
+	}
+
+	key, err := lookupPublicKey(r, tags["s"], tags["d"])
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(key, h, digest, sig)
+}
+
+// DKIMOptions configures the DKIM-Signature generated by Sign
+type DKIMOptions struct {
+	Domain        string        // d= signing domain
+	Selector      string        // s= key selector
+	Key           crypto.Signer // *rsa.PrivateKey or ed25519.PrivateKey
+	HeadersToSign []string      // h= list, defaults to the common ones present at the message
+
+	// c= algorithms of the header fields and the body, relaxed when empty
+	HeaderCanonicalization Canonicalization
+	BodyCanonicalization   Canonicalization
+}
+
+// headers signed when no list is passed at the DKIMOptions
+var defaultSignedHeaders = []string{
+	"from", "sender", "reply-to", "subject", "date", "message-id", "to", "cc",
+	"in-reply-to", "references", "mime-version", "content-type",
+	"content-transfer-encoding",
+}
+
+// Sign composes the message, see Compose, and returns its data with a
+// DKIM-Signature field (RFC 6376) prepended to the headers
+func Sign(msg Message, opts DKIMOptions) ([]byte, error) {
+	data, err := msg.Compose()
+	if err != nil {
+		return nil, err
+	}
+	return SignData(data, opts)
+}
+
+// SignData returns the serialized message data with a DKIM-Signature field
+// prepended to the headers, like for the messages composed elsewhere or
+// the parsed ones sent again as they are (see Message.Raw)
+func SignData(data []byte, opts DKIMOptions) ([]byte, error) {
+	if opts.Domain == "" || opts.Selector == "" || opts.Key == nil {
+		return nil, errors.New("DKIM: domain, selector and key are required")
+	}
+
+	var algorithm string
+	var hashing crypto.Hash
+
+	switch opts.Key.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm, hashing = "rsa-sha256", crypto.SHA256
+	case ed25519.PublicKey:
+		// ed25519 signs the digest itself instead of a prehashed value
+		algorithm, hashing = "ed25519-sha256", crypto.Hash(0)
+	default:
+		return nil, errors.New("DKIM: unsupported key type")
+	}
+
+	hc, bc := opts.HeaderCanonicalization, opts.BodyCanonicalization
+	for _, c := range []*Canonicalization{&hc, &bc} {
+		switch *c {
+		case "":
+			*c = CanonicalizationRelaxed
+		case CanonicalizationSimple, CanonicalizationRelaxed:
+		default:
+			return nil, fmt.Errorf("DKIM: unknown canonicalization %q", *c)
+		}
+	}
+
+	raw, err := ParseRaw(data)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM: %v", err)
+	}
+	fields := splitHeaderFields(extractHeaders(data, raw.BodyOffset))
+
+	// sign only the default headers present on the message
+	names := opts.HeadersToSign
+	if len(names) == 0 {
+		for _, n := range defaultSignedHeaders {
+			if len(selectHeaderFields(fields, []string{n})) > 0 {
+				names = append(names, n)
+			}
+		}
+	}
+
+	bh := sha256.Sum256(canonicalizeBody(raw.Body, bc == CanonicalizationRelaxed))
+
+	sig := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=%s/%s; d=%s; s=%s;\r\n\th=%s;\r\n\tbh=%s;\r\n\tb=",
+		algorithm, hc, bc, opts.Domain, opts.Selector,
+		strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bh[:]))
+
+	hh := sha256.New()
+	for _, f := range selectHeaderFields(fields, names) {
+		hh.Write(canonicalizeHeader(f, hc == CanonicalizationRelaxed))
+	}
+	hh.Write(bytes.TrimSuffix(canonicalizeHeader([]byte(sig), hc == CanonicalizationRelaxed), []byte("\r\n")))
+
+	b, err := opts.Key.Sign(rand.Reader, hh.Sum(nil), hashing)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM: failed sign [msg: %v]", err)
+	}
+
+	// fold the signature value to keep the lines short
+	enc := base64.StdEncoding.EncodeToString(b)
+	for len(enc) > 64 {
+		sig += enc[:64] + "\r\n\t "
+		enc = enc[64:]
+	}
+
+	return append([]byte(sig+enc+"\r\n"), data...), nil
+}
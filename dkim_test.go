@@ -0,0 +1,72 @@
+package eml
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+)
+
+// resolver giving the same key record for every selector
+type staticResolver string
+
+func (r staticResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return []string{string(r)}, nil
+}
+
+func TestSign(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	keys := []struct {
+		key    crypto.Signer
+		record string
+	}{
+		{edKey, "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey))},
+		{rsaKey, "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(rsaPub)},
+	}
+
+	orig, _ := Parse([]byte(replyOriginal))
+	reply, err := orig.Reply(ReplyOptions{From: orig.To[0], Text: "ça va"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply.Headers, reply.Body = nil, nil // only the fields are signed
+
+	for _, k := range keys {
+		for _, c := range []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed} {
+			data, err := Sign(reply, DKIMOptions{
+				Domain: "example.com", Selector: "test", Key: k.key,
+				HeaderCanonicalization: c, BodyCanonicalization: c,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, errs := Parse(data)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if signed.Subject != "Re: Café test" {
+				t.Errorf("subject = %q", signed.Subject)
+			}
+
+			fields := splitHeaderFields(signed.Headers)
+			if err := verifyHeaderSignature(staticResolver(k.record), fields[0], fields, signed.Body); err != nil {
+				t.Errorf("%T %s: %v", k.key, c, err)
+			}
+		}
+	}
+
+	if _, err := Sign(reply, DKIMOptions{Domain: "example.com", Selector: "test", Key: edKey, BodyCanonicalization: "nowsp"}); err == nil {
+		t.Errorf("unknown canonicalization accepted")
+	}
+}
@@ -0,0 +1,208 @@
+// DMARC (RFC 7489) policy evaluation.
+
+package eml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DMARCPolicy is a DMARC record published by a domain
+type DMARCPolicy struct {
+	Policy          string `json:"policy"`           // p=, "none", "quarantine" or "reject"
+	SubdomainPolicy string `json:"subdomain_policy"` // sp=, the policy when empty
+	DKIMAlignment   string `json:"dkim_alignment"`   // adkim=, "r" (relaxed) or "s" (strict)
+	SPFAlignment    string `json:"spf_alignment"`    // aspf=, "r" (relaxed) or "s" (strict)
+	Percent         int    `json:"percent"`          // pct=, share of the failing messages the policy applies to
+}
+
+// DMARCLookup gets the DMARC policy published by a domain, nil when there
+// is none
+type DMARCLookup func(domain string) (*DMARCPolicy, error)
+
+// DKIMResult is the outcome of a DKIM signature verification
+type DKIMResult struct {
+	Domain string // the d= tag of the signature
+	Pass   bool
+}
+
+// SPFResult is the outcome of the SPF check of the envelope sender
+type SPFResult struct {
+	Domain string // domain of the MAIL FROM, or of the HELO for the null sender
+	Pass   bool
+}
+
+// DMARCResult is the outcome of the DMARC evaluation of a message
+type DMARCResult struct {
+	Result      string       `json:"result"`      // "pass", "fail" or "none" without policy
+	Disposition string       `json:"disposition"` // policy to apply: "none", "quarantine" or "reject"
+	Domain      string       `json:"domain"`      // the From domain
+	Policy      *DMARCPolicy `json:"policy"`      // the policy found, nil if none
+	DKIMAligned bool         `json:"dkim_aligned"`
+	SPFAligned  bool         `json:"spf_aligned"`
+}
+
+// ParseDMARCRecord parses the TXT record of a DMARC policy
+func ParseDMARCRecord(txt string) (*DMARCPolicy, error) {
+	tags := parseTagList([]byte(txt))
+	if !strings.EqualFold(tags["v"], "DMARC1") {
+		return nil, errors.New("DMARC: invalid record version")
+	}
+
+	p := &DMARCPolicy{
+		Policy:          strings.ToLower(tags["p"]),
+		SubdomainPolicy: strings.ToLower(tags["sp"]),
+		DKIMAlignment:   strings.ToLower(tags["adkim"]),
+		SPFAlignment:    strings.ToLower(tags["aspf"]),
+		Percent:         100,
+	}
+
+	if p.SubdomainPolicy == "" {
+		if _, ok := tags["sp"]; !ok {
+			p.SubdomainPolicy = p.Policy
+		}
+	}
+
+	// a record without a valid policy but with a valid report address is
+	// taken as p=none (RFC 7489 section 6.6.3)
+	if !validDMARCPolicy(p.Policy) || !validDMARCPolicy(p.SubdomainPolicy) {
+		if !validReportURIs(tags["rua"]) {
+			return nil, fmt.Errorf("DMARC: invalid policy %q", tags["p"])
+		}
+		return &DMARCPolicy{Policy: "none", SubdomainPolicy: "none", DKIMAlignment: "r", SPFAlignment: "r", Percent: 100}, nil
+	}
+
+	if p.DKIMAlignment != "s" {
+		p.DKIMAlignment = "r"
+	}
+	if p.SPFAlignment != "s" {
+		p.SPFAlignment = "r"
+	}
+
+	if v, ok := tags["pct"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 100 {
+			p.Percent = n
+		}
+	}
+
+	return p, nil
+}
+
+func validDMARCPolicy(p string) bool {
+	return p == "none" || p == "quarantine" || p == "reject"
+}
+
+// check for a syntactically valid URI at a list of report addresses, each
+// one with an optional "!size" suffix
+func validReportURIs(list string) bool {
+	for _, u := range strings.Split(list, ",") {
+		u, _, _ = strings.Cut(strings.TrimSpace(u), "!")
+		if v, err := url.Parse(u); err == nil && v.Scheme != "" && v.Opaque+v.Host+v.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolverDMARCLookup looks up the policies at the "_dmarc" TXT records
+func ResolverDMARCLookup(r Resolver) DMARCLookup {
+	return func(domain string) (*DMARCPolicy, error) {
+		txts, err := r.LookupTXT(context.Background(), "_dmarc."+domain)
+		var de *net.DNSError
+		if errors.As(err, &de) && de.IsNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range txts {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(t)), "v=dmarc1") {
+				return ParseDMARCRecord(t)
+			}
+		}
+
+		return nil, nil
+	}
+}
+
+// EvaluateDMARC checks the alignment of the authenticated domains, by the
+// DKIM signatures and SPF, with the From domain, and picks the disposition
+// of the message from the policy of its domain or its organizational
+// domain. The sampling by the policy percent is left to the caller.
+func (msg Message) EvaluateDMARC(dkim []DKIMResult, spf SPFResult, lookup DMARCLookup) (res DMARCResult, err error) {
+	res.Result, res.Disposition = "none", "none"
+
+	// the messages must have a single author (RFC 7489 section 6.6.1)
+	if len(msg.From) != 1 || msg.From[0].Email() == "" {
+		return res, errors.New("DMARC: the message must have a single From mailbox")
+	}
+
+	res.Domain = strings.ToLower(msg.From[0].DomainASCII())
+	org := organizationalDomain(res.Domain)
+
+	// look up the policy of the domain, then of the organizational one
+	subdomain := false
+	res.Policy, err = lookup(res.Domain)
+	if err == nil && res.Policy == nil && org != res.Domain {
+		res.Policy, err = lookup(org)
+		subdomain = true
+	}
+	if err != nil {
+		return res, fmt.Errorf("DMARC: policy lookup: %v", err)
+	}
+
+	for _, d := range dkim {
+		if d.Pass && domainsAligned(d.Domain, res.Domain, res.Policy == nil || res.Policy.DKIMAlignment != "s") {
+			res.DKIMAligned = true
+		}
+	}
+	res.SPFAligned = spf.Pass && domainsAligned(spf.Domain, res.Domain, res.Policy == nil || res.Policy.SPFAlignment != "s")
+
+	if res.Policy == nil {
+		return
+	}
+
+	if res.DKIMAligned || res.SPFAligned {
+		res.Result = "pass"
+		return
+	}
+
+	res.Result, res.Disposition = "fail", res.Policy.Policy
+	if subdomain {
+		res.Disposition = res.Policy.SubdomainPolicy
+	}
+
+	return
+}
+
+// get the registered domain under a public suffix
+func organizationalDomain(domain string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return org
+}
+
+// check the alignment of an authenticated domain with the From domain, the
+// relaxed mode accepting any domain of the same organization
+func domainsAligned(d, from string, relaxed bool) bool {
+	d = strings.ToLower(strings.TrimSuffix(d, "."))
+	if d == "" {
+		return false
+	}
+
+	if d == from {
+		return true
+	}
+
+	return relaxed && organizationalDomain(d) == organizationalDomain(from)
+}
@@ -0,0 +1,118 @@
+package eml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDMARCRecord(t *testing.T) {
+	tests := []struct {
+		txt  string
+		want *DMARCPolicy // nil for an error
+	}{
+		{"v=DMARC1; p=reject", &DMARCPolicy{"reject", "reject", "r", "r", 100}},
+		{"v=DMARC1; p=Quarantine; sp=none; adkim=s; aspf=s; pct=20", &DMARCPolicy{"quarantine", "none", "s", "s", 20}},
+		{"v=DMARC1; p=none; adkim=x; pct=200", &DMARCPolicy{"none", "none", "r", "r", 100}},
+		{"v=DMARC1; rua=mailto:dmarc@example.com", &DMARCPolicy{"none", "none", "r", "r", 100}},
+		{"v=DMARC1; p=bogus; adkim=s; rua=mailto:dmarc@example.com!10m", &DMARCPolicy{"none", "none", "r", "r", 100}},
+		{"v=DMARC1; p=reject; sp=bogus; rua=bogus, mailto:dmarc@example.com", &DMARCPolicy{"none", "none", "r", "r", 100}},
+		{"v=DMARC1", nil},
+		{"v=DMARC1; rua=bogus", nil},
+		{"v=DMARC1; p=reject; sp=bogus", nil},
+		{"v=DMARC2; p=reject", nil},
+		{"p=reject", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDMARCRecord(tt.txt)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: no error", tt.txt)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.txt, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.txt, *got, *tt.want)
+		}
+	}
+}
+
+// lookup of the records by domain
+func dmarcRecords(records map[string]string) DMARCLookup {
+	return func(domain string) (*DMARCPolicy, error) {
+		txt, ok := records[domain]
+		if !ok {
+			return nil, nil
+		}
+		return ParseDMARCRecord(txt)
+	}
+}
+
+func TestEvaluateDMARC(t *testing.T) {
+	records := map[string]string{
+		"example.com":        "v=DMARC1; p=reject; sp=quarantine",
+		"strict.example.net": "v=DMARC1; p=reject; adkim=s; aspf=s",
+		"example.net":        "v=DMARC1; p=quarantine",
+	}
+
+	tests := []struct {
+		name        string
+		from        string
+		dkim        []DKIMResult
+		spf         SPFResult
+		result      string
+		disposition string
+	}{
+		{"domain policy", "a@example.com", nil, SPFResult{}, "fail", "reject"},
+		{"organizational sp", "a@mail.example.com", nil, SPFResult{}, "fail", "quarantine"},
+		{"organizational without sp", "a@mail.example.net", nil, SPFResult{}, "fail", "quarantine"},
+		{"relaxed dkim", "a@example.com", []DKIMResult{{"mail.example.com", true}}, SPFResult{}, "pass", "none"},
+		{"relaxed spf", "a@mail.example.com", nil, SPFResult{"bounces.example.com", true}, "pass", "none"},
+		{"failed dkim", "a@example.com", []DKIMResult{{"example.com", false}}, SPFResult{"example.com", false}, "fail", "reject"},
+		{"other organization", "a@example.com", []DKIMResult{{"example.org", true}}, SPFResult{"example.org", true}, "fail", "reject"},
+		{"strict dkim", "a@strict.example.net", []DKIMResult{{"example.net", true}}, SPFResult{}, "fail", "reject"},
+		{"strict spf", "a@strict.example.net", nil, SPFResult{"mail.strict.example.net", true}, "fail", "reject"},
+		{"strict exact", "a@strict.example.net", []DKIMResult{{"Strict.Example.Net.", true}}, SPFResult{}, "pass", "none"},
+		{"no policy", "a@example.org", nil, SPFResult{}, "none", "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, errs := Parse([]byte("From: " + tt.from + "\r\n\r\nbody\r\n"))
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			res, err := msg.EvaluateDMARC(tt.dkim, tt.spf, dmarcRecords(records))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Result != tt.result || res.Disposition != tt.disposition {
+				t.Errorf("got %s %s, want %s %s", res.Result, res.Disposition, tt.result, tt.disposition)
+			}
+		})
+	}
+}
+
+func TestEvaluateDMARCErrors(t *testing.T) {
+	lookup := dmarcRecords(map[string]string{"example.com": "v=DMARC1; p=reject"})
+
+	// a single author is required
+	for _, from := range []string{"a@example.com, b@example.com", "a@example.com, a@example.com", "undisclosed:;"} {
+		msg, _ := Parse([]byte("From: " + from + "\r\n\r\nbody\r\n"))
+		if _, err := msg.EvaluateDMARC(nil, SPFResult{}, lookup); err == nil {
+			t.Errorf("%q: no error", from)
+		}
+	}
+
+	msg, _ := Parse([]byte("From: a@example.com\r\n\r\nbody\r\n"))
+	failing := func(string) (*DMARCPolicy, error) { return nil, errors.New("timeout") }
+	if _, err := msg.EvaluateDMARC(nil, SPFResult{}, failing); err == nil {
+		t.Errorf("no error for a failed lookup")
+	}
+}
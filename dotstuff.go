@@ -0,0 +1,87 @@
+// SMTP dot-stuffing (RFC 5321 section 4.5.2) of the message data.
+
+package eml
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+type dotStuffer struct {
+	w   io.Writer
+	bol bool // at the beginning of a line
+}
+
+// DotStuff returns a writer doubling the dots at the beginning of the
+// lines, like done for the SMTP DATA command. The line endings are kept
+// and the terminating line is not written.
+func DotStuff(w io.Writer) io.Writer {
+	return &dotStuffer{w: w, bol: true}
+}
+
+func (d *dotStuffer) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+8)
+	for _, c := range p {
+		if d.bol && c == '.' {
+			out = append(out, '.')
+		}
+		out = append(out, c)
+		d.bol = c == '\n'
+	}
+
+	if _, err := d.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type dotUnstuffer struct {
+	r    *bufio.Reader
+	line []byte // rest of the line being read
+	err  error  // set once the end is reached
+}
+
+// DotUnstuff returns a reader removing the SMTP dot-stuffing, the first
+// dot of the lines starting by one. The reading ends at the terminating
+// line, a single dot, or at the end of r. The line endings are kept.
+func DotUnstuff(r io.Reader) io.Reader {
+	return &dotUnstuffer{r: bufio.NewReader(r)}
+}
+
+func (d *dotUnstuffer) Read(p []byte) (int, error) {
+	for len(d.line) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		line, err := d.r.ReadBytes('\n')
+		if err != nil {
+			d.err = err
+		}
+
+		if len(line) > 0 && line[0] == '.' {
+			if isDotLine(line) {
+				d.err, line = io.EOF, nil
+			} else {
+				line = line[1:]
+			}
+		}
+		d.line = line
+	}
+
+	n := copy(p, d.line)
+	d.line = d.line[n:]
+	return n, nil
+}
+
+// check if the line is the terminating one of the SMTP data
+func isDotLine(line []byte) bool {
+	return string(line) == ".\r\n" || string(line) == ".\n" || string(line) == "."
+}
+
+// remove the dot-stuffing and the terminating line of the data
+func dotUnstuff(data []byte) []byte {
+	out, _ := io.ReadAll(DotUnstuff(bytes.NewReader(data)))
+	return out
+}
@@ -0,0 +1,53 @@
+package eml
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDotStuff(t *testing.T) {
+	for _, s := range []string{"", ".", ".a\r\nb\r\n..c\r\n", "a\n.b\n", "no dots\r\n"} {
+		var b bytes.Buffer
+		w := DotStuff(&b)
+		// split the writes to check the line starts across them
+		for i := 0; i < len(s); i++ {
+			w.Write([]byte{s[i]})
+		}
+
+		for _, l := range strings.SplitAfter(b.String(), "\n") {
+			if strings.HasPrefix(l, ".") && !strings.HasPrefix(l, "..") {
+				t.Errorf("%q: unstuffed line %q", s, l)
+			}
+		}
+
+		out, err := io.ReadAll(DotUnstuff(&b))
+		if err != nil || string(out) != s {
+			t.Errorf("%q: round trip gave %q, %v", s, out, err)
+		}
+	}
+
+	out, _ := io.ReadAll(DotUnstuff(strings.NewReader("..a\r\n.\r\nafter\r\n")))
+	if string(out) != ".a\r\n" {
+		t.Errorf("read past the terminating line: %q", out)
+	}
+}
+
+func TestParseDotStuffed(t *testing.T) {
+	data := []byte("From: a@example.com\r\n\r\n..hidden\r\nend\r\n.\r\n")
+
+	// the data is kept as it is by default, the offsets indexing it
+	msg, _ := Parse(data)
+	if msg.Text != "..hidden\r\nend\r\n.\r\n" {
+		t.Errorf("text = %q", msg.Text)
+	}
+	if !bytes.Equal(data[msg.BodyOffset:], msg.Body) {
+		t.Errorf("body offset %d doesn't index the data", msg.BodyOffset)
+	}
+
+	msg, _ = ParseWithOptions(data, ParseOptions{DotStuffed: true})
+	if msg.Text != ".hidden\r\nend\r\n" {
+		t.Errorf("unstuffed text = %q", msg.Text)
+	}
+}
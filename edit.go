@@ -0,0 +1,159 @@
+// Header edition over the raw message data.
+
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// Raw rebuilds the message data from the header block and the body. The
+// header fields and the body are kept byte by byte, so the untouched ones
+// keep their DKIM signatures valid. The Bcc fields are kept too, see
+// Serialize to send the message.
+func (msg Message) Raw() []byte {
+	eol := msg.lineEnding()
+
+	b := append([]byte{}, bytes.TrimRight(msg.Headers, "\r\n")...)
+	b = append(b, eol+eol...)
+	return append(b, msg.Body...)
+}
+
+// SetHeader replaces the first field with the given name by a new one, in
+// place, removing the other fields with that name. The field is added at
+// the end of the header block when missing. The value is written as it is,
+// EncodeHeader is needed for the non-ASCII text.
+//
+// Only the raw headers and ParsedHeaders are changed, the message must be
+// parsed again from Raw to update the other fields and the offsets.
+func (msg *Message) SetHeader(key, value string) error {
+	field, err := newField(key, value, msg.lineEnding())
+	if err != nil {
+		return err
+	}
+
+	msg.setHeaderFields(setField(msg.headerFields(), key, field))
+	msg.removeParsedHeader(key)
+	msg.ParsedHeaders[key] = []string{string(unfold([]byte(value)))}
+
+	return nil
+}
+
+// AddHeader adds a field at the end of the header block, keeping the ones
+// with the same name. See SetHeader for the value.
+func (msg *Message) AddHeader(key, value string) error {
+	field, err := newField(key, value, msg.lineEnding())
+	if err != nil {
+		return err
+	}
+
+	msg.setHeaderFields(append(msg.headerFields(), field))
+
+	if msg.ParsedHeaders == nil {
+		msg.ParsedHeaders = make(map[string][]string)
+	}
+	msg.ParsedHeaders[key] = append(msg.ParsedHeaders[key], string(unfold([]byte(value))))
+
+	return nil
+}
+
+// RemoveHeader removes all the fields with the given name
+func (msg *Message) RemoveHeader(key string) {
+	msg.setHeaderFields(removeField(msg.headerFields(), key))
+	msg.removeParsedHeader(key)
+}
+
+// replace the first field with the given name by a new one, removing the
+// others, or add it at the end when missing
+func setField(fields [][]byte, key string, field []byte) [][]byte {
+	found := false
+	kept := fields[:0]
+	for _, f := range fields {
+		if headerFieldName(f) == strings.ToLower(key) {
+			if found {
+				continue
+			}
+			f, found = field, true
+		}
+		kept = append(kept, f)
+	}
+	if !found {
+		kept = append(kept, field)
+	}
+	return kept
+}
+
+// remove the fields with the given name
+func removeField(fields [][]byte, key string) [][]byte {
+	kept := fields[:0]
+	for _, f := range fields {
+		if headerFieldName(f) != strings.ToLower(key) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// get the line ending used by the message, CRLF by default
+func (msg Message) lineEnding() string {
+	for _, b := range [][]byte{msg.Headers, msg.Body} {
+		if bytes.Contains(b, []byte("\r\n")) {
+			return "\r\n"
+		}
+		if bytes.Contains(b, []byte("\n")) {
+			return "\n"
+		}
+	}
+	return "\r\n"
+}
+
+// split the header block into its fields, each one ending by a line break
+func (msg Message) headerFields() [][]byte {
+	fields := splitHeaderFields(bytes.TrimRight(msg.Headers, "\r\n"))
+	if n := len(fields); n > 0 && !bytes.HasSuffix(fields[n-1], []byte("\n")) {
+		fields[n-1] = append(append([]byte{}, fields[n-1]...), msg.lineEnding()...)
+	}
+	return fields
+}
+
+// rebuild the header block from its fields, without the last line break
+// like the parsed ones
+func (msg *Message) setHeaderFields(fields [][]byte) {
+	msg.Headers = bytes.TrimRight(bytes.Join(fields, nil), "\r\n")
+}
+
+// build a header field checking its name and that the value can't break
+// out of it
+func newField(key, value, eol string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("empty header name")
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] > '~' || key[i] == ':' {
+			return nil, errors.New("invalid header name")
+		}
+	}
+
+	// the line breaks are only allowed for folding
+	v := strings.ReplaceAll(value, "\r\n", "\n")
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\r' || (v[i] == '\n' && (i+1 >= len(v) || (v[i+1] != ' ' && v[i+1] != '\t'))) {
+			return nil, errors.New("invalid line break at the header value")
+		}
+	}
+
+	return []byte(key + ": " + strings.ReplaceAll(v, "\n", eol) + eol), nil
+}
+
+// remove a header, in any case, from the parsed headers
+func (msg *Message) removeParsedHeader(key string) {
+	if msg.ParsedHeaders == nil {
+		msg.ParsedHeaders = make(map[string][]string)
+	}
+	for k := range msg.ParsedHeaders {
+		if strings.EqualFold(k, key) {
+			delete(msg.ParsedHeaders, k)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditHeaders(t *testing.T) {
+	for _, eol := range []string{"\r\n", "\n"} {
+		data := strings.ReplaceAll("From: a@example.com\r\n"+
+			"X-Tag: one\r\n"+
+			"Subject: hello\r\n"+
+			"x-tag: two\r\n"+
+			"\r\n"+
+			"body\r\n", "\r\n", eol)
+
+		t.Run(strings.NewReplacer("\r", "CR", "\n", "LF").Replace(eol), func(t *testing.T) {
+			msg, errs := Parse([]byte(data))
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			if err := msg.SetHeader("X-Tag", "three"); err != nil {
+				t.Fatal(err)
+			}
+			if err := msg.AddHeader("X-Folded", "a\r\n b"); err != nil {
+				t.Fatal(err)
+			}
+			msg.RemoveHeader("subject")
+
+			want := strings.ReplaceAll("From: a@example.com\r\n"+
+				"X-Tag: three\r\n"+
+				"X-Folded: a\r\n b\r\n"+
+				"\r\n"+
+				"body\r\n", "\r\n", eol)
+			if got := string(msg.Raw()); got != want {
+				t.Errorf("raw = %q, want %q", got, want)
+			}
+
+			if v := msg.ParsedHeaders["X-Tag"]; len(v) != 1 || v[0] != "three" {
+				t.Errorf("parsed X-Tag = %q", v)
+			}
+			if _, ok := msg.ParsedHeaders["Subject"]; ok {
+				t.Errorf("parsed Subject kept")
+			}
+		})
+	}
+}
+
+func TestNewField(t *testing.T) {
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{"Subject", "hello", true},
+		{"Subject", "folded\r\n line", true},
+		{"Subject", "folded\n\tline", true},
+		{"", "empty name", false},
+		{"Bad Name", "space", false},
+		{"Bad:Name", "colon", false},
+		{"Subject", "injected\r\nBcc: x@example.com", false},
+		{"Subject", "bare\rcr", false},
+		{"Subject", "trailing\r\n", false},
+	}
+
+	for _, tt := range tests {
+		f, err := newField(tt.key, tt.value, "\r\n")
+		if (err == nil) != tt.ok {
+			t.Errorf("newField(%q, %q) = %q, %v", tt.key, tt.value, f, err)
+		}
+	}
+}
+
+func TestSetRemoveField(t *testing.T) {
+	fields := func() [][]byte {
+		return [][]byte{[]byte("A: 1\r\n"), []byte("B: 2\r\n"), []byte("a: 3\r\n")}
+	}
+	join := func(l [][]byte) string {
+		var b strings.Builder
+		for _, f := range l {
+			b.Write(f)
+		}
+		return b.String()
+	}
+
+	if got := join(setField(fields(), "a", []byte("A: x\r\n"))); got != "A: x\r\nB: 2\r\n" {
+		t.Errorf("setField = %q", got)
+	}
+	if got := join(setField(fields(), "C", []byte("C: x\r\n"))); got != "A: 1\r\nB: 2\r\na: 3\r\nC: x\r\n" {
+		t.Errorf("setField missing = %q", got)
+	}
+	if got := join(removeField(fields(), "A")); got != "B: 2\r\n" {
+		t.Errorf("removeField = %q", got)
+	}
+}
@@ -0,0 +1,258 @@
+package eml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	goCharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// maximum length of an encoded-word (RFC 2047 section 2)
+const maxEncodedWordLen = 75
+
+// EncodeHeader encodes a header value into RFC 2047 encoded-words of the
+// given charset (UTF-8 when empty or unknown). The Q encoding is picked for
+// mostly ASCII values and B otherwise, and each word is kept under the 75
+// characters limit without splitting characters, being folded by CRLF SP.
+// Values that don't need encoding are returned as they are.
+func EncodeHeader(value string, charset string) []byte {
+	if !needsEncoding(value) {
+		return []byte(value)
+	}
+
+	// get the encoder to the target charset, the value is always UTF-8
+	var enc *encoding.Encoder
+	if charset != "" && !strings.EqualFold(charset, "UTF-8") {
+		if e, name := goCharset.Lookup(charset); e != nil && name != "utf-8" {
+			enc = e.NewEncoder()
+		}
+	}
+	if enc == nil {
+		charset = "UTF-8"
+	}
+
+	nonASCII := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 {
+			nonASCII++
+		}
+	}
+
+	q := nonASCII*3 < len(value)
+	prefix := fmt.Sprintf("=?%s?B?", charset)
+	if q {
+		prefix = fmt.Sprintf("=?%s?Q?", charset)
+	}
+	max := maxEncodedWordLen - len(prefix) - 2
+
+	var words []string
+	var raw []byte  // raw bytes of the current B word
+	var text []byte // encoded text of the current Q word
+
+	for _, r := range value {
+		b := []byte(string(r))
+		if enc != nil {
+			if eb, err := enc.Bytes(b); err == nil {
+				b = eb
+			} else {
+				b = []byte("?")
+			}
+		}
+
+		if q {
+			e := encodeQ(b)
+			if len(text)+len(e) > max && len(text) > 0 {
+				words = append(words, prefix+string(text)+"?=")
+				text = nil
+			}
+			text = append(text, e...)
+			continue
+		}
+
+		if base64.StdEncoding.EncodedLen(len(raw)+len(b)) > max && len(raw) > 0 {
+			words = append(words, prefix+base64.StdEncoding.EncodeToString(raw)+"?=")
+			raw = nil
+		}
+		raw = append(raw, b...)
+	}
+
+	if len(text) > 0 {
+		words = append(words, prefix+string(text)+"?=")
+	}
+	if len(raw) > 0 {
+		words = append(words, prefix+base64.StdEncoding.EncodeToString(raw)+"?=")
+	}
+
+	return []byte(strings.Join(words, "\r\n "))
+}
+
+// check if a header value has characters that must be encoded
+func needsEncoding(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] >= 0x80 || (v[i] < ' ' && v[i] != '\t') {
+			return true
+		}
+	}
+
+	// text looking like an encoded-word must be encoded to be preserved
+	return strings.Contains(v, "=?")
+}
+
+// encode bytes with the Q encoding, keeping literal only the characters
+// allowed anywhere, including display names (RFC 2047 section 5)
+func encodeQ(b []byte) []byte {
+	const hex = "0123456789ABCDEF"
+
+	var e []byte
+	for _, c := range b {
+		switch {
+		case c == ' ':
+			e = append(e, '_')
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!*+-/", c) >= 0:
+			e = append(e, c)
+		default:
+			e = append(e, '=', hex[c>>4], hex[c&0x0f])
+		}
+	}
+
+	return e
+}
+
+// maximum length of the encoded body lines, soft break included (RFC 2045
+// section 6.7)
+const maxEncodedLineLen = 76
+
+// maximum length of the lines at the 7bit and 8bit bodies, without the CRLF
+// (RFC 5322 section 2.1.1)
+const maxBodyLineLen = 998
+
+// EncodeQuotedPrintable encodes a text body with the quoted-printable
+// transfer encoding (RFC 2045 section 6.7). The line breaks of the text
+// become CRLF hard breaks, longer lines are split by soft breaks at 76
+// characters, and the whitespace at the end of the lines is encoded to
+// survive the transport.
+func EncodeQuotedPrintable(data []byte) []byte {
+	const hex = "0123456789ABCDEF"
+
+	var out []byte
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for i, l := range lines {
+		n := 0 // length of the current output line
+		for j := 0; j < len(l); j++ {
+			c := l[j]
+
+			var e []byte
+			switch {
+			case (c == ' ' || c == '\t') && j == len(l)-1:
+				e = []byte{'=', hex[c>>4], hex[c&0x0f]}
+			case c == ' ' || c == '\t' || (c >= 33 && c <= 126 && c != '='):
+				e = []byte{c}
+			default:
+				e = []byte{'=', hex[c>>4], hex[c&0x0f]}
+			}
+
+			// leave room for the "=" of the soft break, unless this is the
+			// last character of the line
+			limit := maxEncodedLineLen - 1
+			if j == len(l)-1 {
+				limit = maxEncodedLineLen
+			}
+			if n+len(e) > limit {
+				out = append(out, "=\r\n"...)
+				n = 0
+			}
+
+			out = append(out, e...)
+			n += len(e)
+		}
+
+		if i < len(lines)-1 {
+			out = append(out, "\r\n"...)
+		}
+	}
+
+	return out
+}
+
+// EncodeBase64 encodes a body with the base64 transfer encoding, split into
+// lines of 76 characters separated by CRLF
+func EncodeBase64(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+
+	out := make([]byte, 0, len(enc)+len(enc)/maxEncodedLineLen*2+2)
+	for len(enc) > maxEncodedLineLen {
+		out = append(out, enc[:maxEncodedLineLen]...)
+		out = append(out, "\r\n"...)
+		enc = enc[maxEncodedLineLen:]
+	}
+
+	return append(out, enc...)
+}
+
+// DetectTransferEncoding analyses a body and returns the identity encoding
+// it fits: "7bit" for ASCII text, "8bit" for text with non-ASCII bytes and
+// "binary" for the data with NUL bytes, bare CR or lines over 998 octets
+func DetectTransferEncoding(data []byte) string {
+	encoding := "7bit"
+
+	n := 0 // length of the current line
+	for i, c := range data {
+		switch {
+		case c == 0:
+			return "binary"
+		case c == '\r':
+			if i+1 >= len(data) || data[i+1] != '\n' {
+				return "binary"
+			}
+			continue
+		case c == '\n':
+			n = 0
+			continue
+		case c >= 0x80:
+			encoding = "8bit"
+		}
+
+		if n++; n > maxBodyLineLen {
+			return "binary"
+		}
+	}
+
+	return encoding
+}
+
+// EncodeBody picks the transfer encoding for a body by its contents and
+// encodes it. The data is sent as it is when it fits 7bit, or 8bit when
+// allowed by the transport (8BITMIME). Otherwise it's quoted-printable for
+// mostly ASCII text and base64 for everything else.
+func EncodeBody(data []byte, allow8bit bool) (encoding string, encoded []byte) {
+	switch DetectTransferEncoding(data) {
+	case "7bit":
+		return "7bit", data
+	case "8bit":
+		if allow8bit {
+			return "8bit", data
+		}
+	}
+
+	// the NUL bytes and bare CR don't survive the quoted-printable line
+	// breaks normalization
+	text, nonASCII := true, 0
+	for i, c := range data {
+		if c == 0 || (c == '\r' && (i+1 >= len(data) || data[i+1] != '\n')) {
+			text = false
+			break
+		}
+		if c >= 0x80 {
+			nonASCII++
+		}
+	}
+
+	if text && nonASCII*6 < len(data) {
+		return "quoted-printable", EncodeQuotedPrintable(data)
+	}
+
+	return "base64", EncodeBase64(data)
+}
@@ -0,0 +1,92 @@
+// Package enmime converts the parsed messages to and from the envelopes
+// and parts of github.com/jhillyerd/enmime. It is a module of its own, so
+// the users of the parser alone don't depend on enmime.
+package enmime
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/jhillyerd/enmime/v2"
+	"github.com/ncastellani/eml"
+)
+
+// ToEnvelope reads the original message data as an enmime envelope
+func ToEnvelope(msg eml.Message) (*enmime.Envelope, error) {
+	return enmime.ReadEnvelope(bytes.NewReader(msg.Raw()))
+}
+
+// FromEnvelope writes the root part of an envelope and parses it back as a
+// message. The text parts were converted to UTF-8 by enmime when read, so
+// they are written as UTF-8. The envelope is left untouched.
+func FromEnvelope(e *enmime.Envelope) (eml.Message, []error) {
+	root := e.Root.Clone(nil)
+	utf8Texts(root)
+	return FromPart(root)
+}
+
+// set the charset of the text parts of a tree read by enmime to UTF-8
+func utf8Texts(p *enmime.Part) {
+	for ; p != nil; p = p.NextSibling {
+		if p.TextContent() && p.Charset != "" {
+			p.Charset = "utf-8"
+		}
+		utf8Texts(p.FirstChild)
+	}
+}
+
+// FromPart writes an enmime part tree, like the ones made by its Builder,
+// and parses it back as a message. Writing the tree sets its headers.
+func FromPart(p *enmime.Part) (eml.Message, []error) {
+	var b bytes.Buffer
+	if err := p.Encode(&b); err != nil {
+		return eml.Message{}, []error{err}
+	}
+
+	return eml.Parse(b.Bytes())
+}
+
+// PartToEnmime builds the enmime part of a part of the MIME tree, with its
+// children, from its decoded contents. The text parts are sent as UTF-8,
+// and enmime picks the transfer encoding when writing them.
+func PartToEnmime(p eml.Part) *enmime.Part {
+	t := p.MediaType.String()
+	if t == "" {
+		t = p.Type
+	}
+
+	ep := enmime.NewPart(t)
+	for k, v := range p.Headers {
+		ep.Header[k] = append([]string{}, v...)
+	}
+
+	// the contents are already decoded
+	ep.Header.Del("Content-Transfer-Encoding")
+
+	for k, v := range p.MediaType.Params {
+		switch k {
+		case "boundary":
+			ep.Boundary = v
+		case "charset", "name":
+		default:
+			ep.ContentTypeParams[k] = v
+		}
+	}
+	if strings.HasPrefix(t, "text/") {
+		ep.Charset = "utf-8"
+	}
+
+	ep.Disposition = p.Disposition
+	ep.FileName = p.Filename
+	ep.ContentID = p.ContentID
+
+	if p.Children == nil {
+		ep.Content = p.Data
+		return ep
+	}
+
+	for _, c := range p.Children {
+		ep.AddChild(PartToEnmime(c))
+	}
+	return ep
+}
@@ -0,0 +1,58 @@
+package enmime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ncastellani/eml"
+)
+
+const sample = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9?=\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=E9\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"doc.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"doc.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--XX--\r\n"
+
+func TestRoundTrip(t *testing.T) {
+	msg, errs := eml.Parse([]byte(sample))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	env, err := ToEnvelope(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.GetHeader("Subject") != "Café" || strings.TrimSpace(env.Text) != "Café" || len(env.Attachments) != 1 {
+		t.Errorf("envelope: subject %q, text %q, %d attachments", env.GetHeader("Subject"), env.Text, len(env.Attachments))
+	}
+
+	back, errs := FromEnvelope(env)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if back.Subject != "Café" || strings.TrimSpace(back.Text) != "Café" || len(back.Attachments) != 1 {
+		t.Errorf("message: subject %q, text %q, %d attachments", back.Subject, back.Text, len(back.Attachments))
+	}
+
+	// the tree built from the decoded parts is encoded again by enmime
+	tree, errs := FromPart(PartToEnmime(msg.Root))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if strings.TrimSpace(tree.Text) != "Café" || len(tree.Attachments) != 1 || string(tree.Attachments[0].Data) != "%PDF-1.4\n" {
+		t.Errorf("tree: text %q, attachments %+v", tree.Text, tree.Attachments)
+	}
+}
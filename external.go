@@ -0,0 +1,99 @@
+// message/external-body (RFC 2046 section 5.2.3) references.
+
+package eml
+
+import (
+	"mime"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExternalBody is the reference to a body stored outside the message
+type ExternalBody struct {
+	AccessType string    `json:"access_type"` // lowercase, like "url", "anon-ftp" or "mail-server"
+	URL        string    `json:"url"`         // for the "url" access type (RFC 2017)
+	Site       string    `json:"site"`        // host of the ftp and tftp access types
+	Directory  string    `json:"directory"`
+	Name       string    `json:"name"`
+	Mode       string    `json:"mode"`
+	Server     string    `json:"server"`     // address of the "mail-server" access type
+	Subject    string    `json:"subject"`    // subject of the mail-server request
+	Command    string    `json:"command"`    // body of the mail-server request
+	Permission string    `json:"permission"` // "read" or "read-write"
+	Size       int64     `json:"size"`
+	Expiration time.Time `json:"expiration"`
+
+	// headers of the referenced body, stored at the part
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id"`
+	Encoding    string `json:"encoding"`
+}
+
+// ExternalFetcher retrieves the contents of an external body
+type ExternalFetcher func(ref ExternalBody) ([]byte, error)
+
+// parse the Content-Type parameters and the phantom headers of an
+// external-body part
+func parseExternalBody(ct string, data []byte) *ExternalBody {
+	_, ps, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil
+	}
+
+	ref := &ExternalBody{
+		AccessType: strings.ToLower(ps["access-type"]),
+		Site:       ps["site"],
+		Directory:  ps["directory"],
+		Name:       ps["name"],
+		Mode:       ps["mode"],
+		Server:     ps["server"],
+		Subject:    ps["subject"],
+		Permission: strings.ToLower(ps["permission"]),
+	}
+
+	// the URLs may be split by whitespace to fit the lines
+	ref.URL = strings.Join(strings.Fields(ps["url"]), "")
+
+	ref.Size, _ = strconv.ParseInt(ps["size"], 10, 64)
+	if e := ps["expiration"]; e != "" {
+		ref.Expiration, _ = parseDate(e, time.UTC)
+	}
+
+	// the part holds the headers of the referenced body, followed by the
+	// mail-server command, the blank line being often missing when there's
+	// no command
+	raw, err := ParseRaw(append(append([]byte{}, data...), "\r\n\r\n"...))
+	if err == nil {
+		h := textproto.MIMEHeader{}
+		for _, rh := range raw.RawHeaders {
+			h.Add(string(rh.Key), string(unfold(rh.Value)))
+		}
+
+		ref.ContentType = h.Get("Content-Type")
+		ref.ContentID = strings.Trim(h.Get("Content-Id"), "<> ")
+		ref.Encoding = strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding")))
+		ref.Command = strings.TrimSpace(string(raw.Body))
+	}
+
+	return ref
+}
+
+// get the filename of the referenced body
+func (ref ExternalBody) filename() string {
+	if ref.Name != "" {
+		return path.Base(ref.Name)
+	}
+
+	u := ref.URL
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	if i := strings.LastIndex(u, "/"); i >= 0 && i < len(u)-1 {
+		return u[i+1:]
+	}
+
+	return ""
+}
@@ -0,0 +1,139 @@
+// Attachments filename sanitization.
+
+package eml
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maximum length of the sanitized filenames, in bytes, the limit of most
+// filesystems
+const maxFilenameLen = 255
+
+// extensions of the common attachment types, checked before the system
+// table of mime.ExtensionsByType so the result does not depend on the host
+var typeExtensions = map[string]string{
+	"application/pdf":               ".pdf",
+	"application/zip":               ".zip",
+	"application/gzip":              ".gz",
+	"application/json":              ".json",
+	"application/xml":               ".xml",
+	"application/rtf":               ".rtf",
+	"application/msword":            ".doc",
+	"application/vnd.ms-excel":      ".xls",
+	"application/vnd.ms-powerpoint": ".ppt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.rar":         ".rar",
+	"application/x-7z-compressed": ".7z",
+	"application/x-tar":           ".tar",
+	"image/png":                   ".png",
+	"image/jpeg":                  ".jpg",
+	"image/gif":                   ".gif",
+	"image/bmp":                   ".bmp",
+	"image/tiff":                  ".tif",
+	"image/webp":                  ".webp",
+	"image/heic":                  ".heic",
+	"image/svg+xml":               ".svg",
+	"text/plain":                  ".txt",
+	"text/html":                   ".html",
+	"text/csv":                    ".csv",
+	"text/calendar":               ".ics",
+	"text/vcard":                  ".vcf",
+	"message/rfc822":              ".eml",
+	"audio/mpeg":                  ".mp3",
+	"video/mp4":                   ".mp4",
+}
+
+// names that Windows reserves for devices, with any extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeFilename returns the attachment filename made safe to be written to
+// disk: without directories, control and bidirectional formatting
+// characters (used to disguise "exe.pdf" as "fdp.exe"), characters reserved
+// by Windows and device names, limited to 255 bytes and with an extension
+// inferred from the content type when missing
+func (a Attachment) SafeFilename() string {
+	name := a.Filename
+
+	// keep only the last path element, whatever the separator
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), unicode.Is(unicode.Bidi_Control, r):
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows ignores the trailing dots and spaces
+	name = strings.Trim(name, ". ")
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	if name == "" {
+		name = "attachment"
+	}
+
+	ext := path.Ext(name)
+	if ext == "" || ext == name {
+		ext = a.extension()
+		name += ext
+	}
+
+	// cut the name keeping the extension and whole characters
+	if len(name) > maxFilenameLen {
+		if len(ext) > 16 {
+			ext = ""
+		}
+
+		stem := name[:len(name)-len(ext)]
+		stem = stem[:maxFilenameLen-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+
+		name = stem + ext
+	}
+
+	return name
+}
+
+// get the extension for the detected type, or the declared one
+func (a Attachment) extension() string {
+	for _, t := range []string{a.DetectedType, a.ContentType} {
+		t, _, _ = strings.Cut(t, ";")
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || t == "application/octet-stream" {
+			continue
+		}
+
+		if ext, ok := typeExtensions[t]; ok {
+			return ext
+		}
+		if exts, err := mime.ExtensionsByType(t); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,83 @@
+// Message fingerprints, used to find the copies of a message.
+
+package eml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// FingerprintOptions picks the header fields covered by Fingerprint
+type FingerprintOptions struct {
+	// Headers are the fields hashed, Message-ID, Date, From and Subject
+	// when empty
+	Headers []string
+
+	// AllHeaders hashes every header field instead of the Headers list
+	AllHeaders bool
+
+	// IgnoreTransport leaves out the fields added by the servers on the
+	// way, like Received, when hashing all the headers
+	IgnoreTransport bool
+}
+
+// headers hashed by default by the fingerprints
+var fingerprintHeaders = []string{`message-id`, `date`, `from`, `subject`}
+
+// fields and prefixes of the fields added during the transport, which
+// change with the route followed by the message
+var transportHeaders = []string{
+	`received`, `return-path`, `delivered-to`, `x-original-to`, `x-envelope-from`,
+	`authentication-results`, `received-spf`, `dkim-signature`, `arc-`,
+	`x-received`, `x-spam-`, `x-ms-exchange-`, `x-forefront-`, `x-microsoft-antispam`,
+	`x-google-smtp-source`, `x-gm-`, `x-virus-`,
+}
+
+// check if a header field is added during the transport
+func isTransportHeader(name string) bool {
+	for _, h := range transportHeaders {
+		if name == h || (strings.HasSuffix(h, "-") && strings.HasPrefix(name, h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint computes a hash of the message, as hex encoded SHA-256, over
+// the relaxed canonical form of the chosen header fields and the body. The
+// copies of a message that followed different routes get the same
+// fingerprint.
+func (msg Message) Fingerprint(opts FingerprintOptions) string {
+	fields := splitHeaderFields(msg.Headers)
+	h := sha256.New()
+
+	if opts.AllHeaders {
+		for _, f := range fields {
+			name := headerFieldName(f)
+			if name == "" || (opts.IgnoreTransport && isTransportHeader(name)) {
+				continue
+			}
+			h.Write(canonicalizeHeader(f, true))
+		}
+	} else {
+		names := opts.Headers
+		if len(names) == 0 {
+			names = fingerprintHeaders
+		}
+
+		for _, n := range names {
+			n = strings.ToLower(n)
+			for _, f := range fields {
+				if headerFieldName(f) == n {
+					h.Write(canonicalizeHeader(f, true))
+				}
+			}
+		}
+	}
+
+	h.Write([]byte("\r\n"))
+	h.Write(canonicalizeBody(msg.Body, true))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
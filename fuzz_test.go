@@ -0,0 +1,94 @@
+package eml
+
+import (
+	"testing"
+)
+
+// the parsers must not panic on any input, the errors being reported
+
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		replyOriginal,
+		forwardOriginal,
+		"",
+		"\r\n\r\n",
+		"From: a@example.com\n\nbody",
+		"Content-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\n\r\n--x--",
+		"Content-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: multipart/alternative\r\n\r\n--x--",
+		"Content-Type: multipart/mixed\r\n\r\nno boundary",
+		"Content-Type: message/rfc822\r\n\r\nContent-Type: text/plain\r\n\r\ninner",
+		"Content-Type: text/plain; charset=\"\r\nContent-Transfer-Encoding: base64\r\n\r\n====",
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n=\r\n=4",
+		"Subject: =?utf-8?q?=\r\nDate: 32 Foo 99999\r\nFrom: <@>\r\n\r\n",
+		"Content-Type: text/plain\r\n\r\nbegin 644 a.txt\r\n`\r\nend\r\n",
+		"Content-Type: text/plain\r\n\r\n=ybegin line=128 size=1 name=a\r\n*\r\n=yend size=1\r\n",
+		"Content-Type: message/external-body; access-type=x\r\n\r\n",
+		"Content-Type: multipart/appledouble; boundary=a\r\n\r\n--a\r\nContent-Type: application/applefile\r\n\r\n\x00\x05\x16\x07\r\n--a--\r\n",
+	} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Parse(data)
+	})
+}
+
+func FuzzParseAddressList(f *testing.F) {
+	for _, s := range []string{
+		"a@example.com",
+		"John Doe <john@example.com>, \"a,b\"@example.com",
+		"user@[IPv6:::1], <@relay:user@example.com>",
+		"Group: a@example.com, b@example.com;, undisclosed-recipients:;",
+		"=?utf-8?q?J=C3=A9r=C3=B4me?= <j@example.com>",
+		"\"unterminated <a@example.com>",
+		"(comment (nested)) a@example.com (trailing",
+		"<<>>,,;;@@",
+		"John Q. Public <john@example.com>",
+		"",
+	} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseAddressList(data)
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, s := range []string{
+		"=?utf-8?q?caf=C3=A9?=",
+		"=?iso-8859-1?B?Y2Fm6Q==?= =?utf-8?Q?_ok?=",
+		"=?utf-8*en?q?x?=",
+		"=?unknown?q?x?=",
+		"=?utf-8?b?====?=",
+		"=?utf-8?q?=",
+		"=??=",
+		"plain text",
+		"",
+	} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Decode(data)
+	})
+}
+
+func FuzzParseDate(f *testing.F) {
+	for _, s := range []string{
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"2 Jan 06 15:04 EST",
+		"Mon, 02 Jan 2006 09 : 55 : 00 +0000 (UTC)",
+		"Tue, 1 Jan 104 00:00:00 Z",
+		"2006-01-02T15:04:05Z",
+		"32 Foo 99999",
+		"",
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		ParseDate(s)
+		ParseDateErr(s)
+	})
+}
@@ -0,0 +1,14 @@
+module github.com/ncastellani/eml/gomessage
+
+go 1.21.0
+
+require github.com/ncastellani/eml v0.0.0-00010101000000-000000000000
+
+require (
+	github.com/emersion/go-message v0.18.2
+	github.com/paulrosania/go-charset v0.0.0-20190326053356-55c9d7a5834c // indirect
+	golang.org/x/net v0.15.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
+
+replace github.com/ncastellani/eml => ../
@@ -0,0 +1,75 @@
+// Package gomessage converts the parsed messages to and from the entities
+// of github.com/emersion/go-message, used by the emersion SMTP and IMAP
+// libraries. It is a module of its own, so the users of the parser alone
+// don't depend on go-message.
+package gomessage
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/ncastellani/eml"
+)
+
+// ToEntity reads the original message data as a go-message entity
+func ToEntity(msg eml.Message) (*message.Entity, error) {
+	raw := append([]byte{}, bytes.TrimRight(msg.Headers, "\r\n")...)
+	raw = append(raw, "\r\n\r\n"...)
+	raw = append(raw, msg.Body...)
+
+	return message.Read(bytes.NewReader(raw))
+}
+
+// FromEntity writes an entity and parses it back as a message. The body of
+// the entity is consumed.
+func FromEntity(e *message.Entity) (eml.Message, []error) {
+	var b bytes.Buffer
+	if err := e.WriteTo(&b); err != nil {
+		return eml.Message{}, []error{err}
+	}
+
+	return eml.Parse(b.Bytes())
+}
+
+// PartToEntity builds the entity of a part of the MIME tree, from its
+// decoded contents. The text parts are sent as UTF-8, and the contents are
+// encoded again with the original transfer encoding when written.
+func PartToEntity(p eml.Part) (*message.Entity, error) {
+	h := message.HeaderFromMap(p.Headers)
+
+	// the contents are already decoded
+	h.Del("Content-Transfer-Encoding")
+	if t, ps, err := h.ContentType(); err == nil && strings.HasPrefix(t, "text/") && ps["charset"] != "" {
+		ps["charset"] = "utf-8"
+		h.SetContentType(t, ps)
+	}
+
+	var e *message.Entity
+	var err error
+
+	if p.Children != nil {
+		children := []*message.Entity{}
+		for _, c := range p.Children {
+			ce, err := PartToEntity(c)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, ce)
+		}
+
+		e, err = message.NewMultipart(h, children)
+	} else {
+		e, err = message.New(h, bytes.NewReader(p.Data))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Children == nil && p.TransferEncoding != "" {
+		e.Header.Set("Content-Transfer-Encoding", p.TransferEncoding)
+	}
+
+	return e, nil
+}
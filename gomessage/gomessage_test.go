@@ -0,0 +1,103 @@
+package gomessage
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	_ "github.com/emersion/go-message/charset"
+	"github.com/ncastellani/eml"
+)
+
+const sample = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9?=\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=E9\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"doc.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"doc.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--XX--\r\n"
+
+func TestRoundTrip(t *testing.T) {
+	msg, errs := eml.Parse([]byte(sample))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	e, err := ToEntity(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := e.Header.Text("Subject"); s != "Café" {
+		t.Errorf("entity subject = %q", s)
+	}
+
+	mr := e.MultipartReader()
+	if mr == nil {
+		t.Fatal("entity is not a multipart")
+	}
+	var types []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t, _, _ := p.Header.ContentType()
+		types = append(types, t)
+	}
+	if strings.Join(types, " ") != "text/plain application/pdf" {
+		t.Errorf("entity parts = %q", types)
+	}
+
+	e, err = ToEntity(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, errs := FromEntity(e)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if back.Subject != "Café" || strings.TrimSpace(back.Text) != "Café" || len(back.Attachments) != 1 {
+		t.Errorf("message: subject %q, text %q, %d attachments", back.Subject, back.Text, len(back.Attachments))
+	}
+}
+
+func TestPartToEntity(t *testing.T) {
+	msg, errs := eml.Parse([]byte(sample))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	e, err := PartToEntity(msg.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Header.Set("Subject", "tree")
+
+	// the decoded parts are encoded again, the text as UTF-8
+	tree, errs := FromEntity(e)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if strings.TrimSpace(tree.Text) != "Café" {
+		t.Errorf("text = %q", tree.Text)
+	}
+	if len(tree.Attachments) != 1 || tree.Attachments[0].Filename != "doc.pdf" || string(tree.Attachments[0].Data) != "%PDF-1.4\n" {
+		t.Errorf("attachments = %+v", tree.Attachments)
+	}
+	if cs := tree.Parts[0].MediaType.Params["charset"]; cs != "utf-8" {
+		t.Errorf("text charset = %q", cs)
+	}
+}
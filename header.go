@@ -4,6 +4,8 @@ package eml
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 )
 
 func split(ts []token, s token) [][]token {
@@ -20,54 +22,247 @@ func split(ts []token, s token) [][]token {
 	return r
 }
 
-// BUG: We don't currently support domain literals with commas.
-func parseAddressList(s []byte) ([]Address, error) {
-	al := []Address{}
+// AddressListError is returned when some entries of an address list can't
+// be parsed, the list being returned with a RawAddress in their place
+type AddressListError struct {
+	Invalid []string // raw text of the unparseable entries
+	Errs    []error  // the error of each entry
+}
+
+func (e *AddressListError) Error() string {
+	return fmt.Sprintf("unparseable addresses %q", e.Invalid)
+}
+
+func (e *AddressListError) Unwrap() []error {
+	return e.Errs
+}
+
+// DuplicateHeaderError is reported at strict mode for the messages with
+// several fields of a header that must be unique, which the mail clients
+// disagree on how to show
+type DuplicateHeaderError struct {
+	Header string   // the header name, as found first
+	Values []string // the raw value of each field, in order
+}
+
+func (e *DuplicateHeaderError) Error() string {
+	return fmt.Sprintf("%d conflicting %s headers %q", len(e.Values), e.Header, e.Values)
+}
+
+// headers checked for duplicates at strict mode
+var uniqueHeaders = []string{`from`, `sender`, `reply-to`, `subject`, `date`, `message-id`}
+
+// find the unique headers present more than once
+func duplicateHeaders(headers []RawHeader) (errs []error) {
+	for _, h := range uniqueHeaders {
+		var de *DuplicateHeaderError
+		for _, rh := range headers {
+			if !strings.EqualFold(string(rh.Key), h) {
+				continue
+			}
+			if de == nil {
+				de = &DuplicateHeaderError{Header: string(rh.Key)}
+			}
+			de.Values = append(de.Values, string(rh.Value))
+		}
+
+		if de != nil && len(de.Values) > 1 {
+			errs = append(errs, de)
+		}
+	}
 
+	return
+}
+
+func parseAddressList(s []byte) ([]Address, error) {
 	// UTF8 decode the address list
 	dd, e := decodeRFC2047(s)
-	if e == nil {
-		s = []byte(dd)
+	if e != nil || bytes.Equal(dd, s) {
+		return parseAddresses(s)
 	}
 
-	ts, e := tokenize(s)
-	if e != nil {
-		return al, e
+	al, err := parseAddresses(dd)
+
+	// the display names as written, before decoding
+	if raw, _ := parseAddresses(s); len(raw) == len(al) {
+		for i := range al {
+			al[i] = withRawName(al[i], raw[i])
+		}
 	}
 
-	// split by groups (,)
-	stb := split(ts, []byte{','})
-	var lsb []token
-	var vsb [][]token
+	return al, err
+}
+
+// parse an address list, already decoded
+func parseAddresses(s []byte) ([]Address, error) {
+	al := []Address{}
 
-	for i, t := range stb {
-		var p []token
-		var fc []byte
+	le := &AddressListError{}
 
-		for _, c := range t {
-			p = append(p, c)
-			fc = append(fc, c...)
+	ts, e := tokenize(s)
+	if e != nil {
+		// parse each entry on its own, so a bad one does not take the
+		// others with it
+		for _, v := range splitRawList(s) {
+			ts, e := tokenize(v)
+			if e == nil {
+				var a Address
+				if a, e = parseAddress(ts); e == nil {
+					al = append(al, a)
+					continue
+				}
+			}
+			raw := string(bytes.TrimSpace(v))
+			al = append(al, RawAddress{raw: raw})
+			le.Invalid = append(le.Invalid, raw)
+			le.Errs = append(le.Errs, e)
 		}
 
-		lsb = append(lsb, p...)
-		if i != len(stb)-1 && !bytes.Contains(fc, []byte("@")) {
-			comma := []byte(",")
-			lsb = append(lsb, []token{comma}...)
+		if len(le.Invalid) > 0 {
+			return al, le
 		}
+		return al, nil
+	}
+
+	// split by addresses (,) keeping the groups (name: a, b;) together
+	var vsb [][]token
+	var lsb []token
+	var fc []byte
+	angle, group := 0, false
+
+	for _, t := range ts {
+		switch {
+		case string(t) == "<":
+			angle++
+		case string(t) == ">" && angle > 0:
+			angle--
+		case string(t) == ":" && angle == 0 && !group:
+			group = true
+		case string(t) == ";" && angle == 0 && group:
+			group = false
+			vsb = append(vsb, append(lsb, t))
+			lsb, fc = nil, nil
+			continue
+		case (string(t) == "," || string(t) == ";") && angle == 0 && !group:
+			// some clients separate the addresses with ";"
+			if len(lsb) == 0 {
+				continue
+			}
+
+			// a comma at a display name without quotes does not
+			// split the address
+			if !bytes.Contains(fc, []byte("@")) {
+				break
+			}
 
-		if bytes.Contains(fc, []byte("@")) || i == len(stb)-1 {
 			vsb = append(vsb, lsb)
-			lsb = make([]token, 0)
+			lsb, fc = nil, nil
+			continue
 		}
+
+		lsb = append(lsb, t)
+		fc = append(fc, t...)
+	}
+
+	if len(lsb) > 0 {
+		vsb = append(vsb, lsb)
 	}
 
 	for _, ts := range vsb {
 		a, e := parseAddress(ts)
 		if e != nil {
-			return al, e
+			raw := string(tokensRaw(s, ts))
+			al = append(al, RawAddress{raw: raw})
+			le.Invalid = append(le.Invalid, raw)
+			le.Errs = append(le.Errs, e)
+			continue
 		}
 		al = append(al, a)
 	}
 
+	if len(le.Invalid) > 0 {
+		return al, le
+	}
 	return al, nil
 }
+
+// get the text of the list covered by the tokens, which are slices of it
+func tokensRaw(s []byte, ts []token) []byte {
+	if len(ts) == 0 {
+		return nil
+	}
+
+	start := cap(s) - cap(ts[0])
+	last := ts[len(ts)-1]
+	end := cap(s) - cap(last) + len(last)
+	if start < 0 || end > len(s) || start > end {
+		return nil
+	}
+	return s[start:end]
+}
+
+// split an address list by the commas out of quotes and angle brackets,
+// used when the list can't be tokenized
+func splitRawList(s []byte) (l [][]byte) {
+	last, angle, quoted := 0, 0, false
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '<' && !quoted:
+			angle++
+		case c == '>' && !quoted && angle > 0:
+			angle--
+		case c == ',' && !quoted && angle == 0:
+			if len(bytes.TrimSpace(s[last:i])) > 0 {
+				l = append(l, s[last:i])
+			}
+			last = i + 1
+		}
+	}
+
+	if len(bytes.TrimSpace(s[last:])) > 0 {
+		l = append(l, s[last:])
+	}
+
+	return
+}
+
+// Header gets the first value of a header, in any case, unfolded and with
+// the RFC 2047 encoded-words decoded, or an empty string when missing
+func (msg Message) Header(key string) string {
+	if v := msg.HeaderAll(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// HeaderAll gets the values of all the fields of a header, in any case and
+// in the message order, unfolded and with the RFC 2047 encoded-words
+// decoded. The words that can't be decoded are kept as they are.
+func (msg Message) HeaderAll(key string) (values []string) {
+	for _, v := range msg.HeaderRaw(key) {
+		d, _ := DecodeString(strings.TrimSpace(string(unfold(v))))
+		values = append(values, d)
+	}
+	return
+}
+
+// HeaderRaw gets the values of all the fields of a header, in any case and
+// in the message order, as they are at the message: folded, encoded and
+// with the whitespace after the colon, but without the final line break
+func (msg Message) HeaderRaw(key string) (values [][]byte) {
+	key = strings.ToLower(key)
+	for _, f := range splitHeaderFields(msg.Headers) {
+		if headerFieldName(f) != key {
+			continue
+		}
+
+		_, v, _ := bytes.Cut(f, []byte(":"))
+		values = append(values, bytes.TrimRight(v, "\r\n"))
+	}
+	return
+}
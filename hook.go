@@ -0,0 +1,40 @@
+// Inspection of the attachments while parsing, like for malware scanning.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// AttachmentMeta describes an attachment given to ParseOptions.OnAttachment
+type AttachmentMeta struct {
+	Filename    string
+	ContentType string // declared media type
+	ContentID   string
+	Inline      bool
+	Size        int // length of the decoded contents
+	Part        int // index at the message Parts of the part holding it
+}
+
+// give the decoded attachments to the hook, stopping at its first error
+func (o ParseOptions) hookAttachments(atts []Attachment, part int) error {
+	for _, a := range atts {
+		if a.Skipped {
+			continue
+		}
+
+		meta := AttachmentMeta{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			ContentID:   a.ContentID,
+			Inline:      a.Inline,
+			Size:        len(a.Data),
+			Part:        part,
+		}
+		if err := o.OnAttachment(meta, bytes.NewReader(a.Data)); err != nil {
+			return fmt.Errorf("attachment %q rejected: %w", a.Filename, err)
+		}
+	}
+	return nil
+}
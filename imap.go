@@ -0,0 +1,221 @@
+// IMAP (RFC 3501) BODYSTRUCTURE and ENVELOPE representations.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// BodyStructure builds the IMAP BODYSTRUCTURE representation of the MIME
+// tree, extension data included
+func (msg Message) BodyStructure() string {
+	if msg.Root.Type == "" {
+		// messages without Content-Type are plain text
+		return fmt.Sprintf(`("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" %d %d NIL NIL NIL NIL)`,
+			len(msg.Body), countLines(msg.Body))
+	}
+
+	return msg.bodyStructure(msg.Root)
+}
+
+// IMAPEnvelope builds the IMAP ENVELOPE representation of the headers
+func (msg Message) IMAPEnvelope() string {
+	from := imapAddressList(msg.From)
+
+	// the sender and reply-to default to the from addresses
+	sender, replyTo := from, imapAddressList(msg.ReplyTo)
+	if _, ok := msg.rawHeader(`sender`); ok {
+		sender = imapAddressList([]Address{msg.Sender})
+	}
+	if replyTo == "NIL" {
+		replyTo = from
+	}
+
+	date, _ := msg.rawHeader(`date`)
+	subject, _ := msg.rawHeader(`subject`)
+	inReplyTo, _ := msg.rawHeader(`in-reply-to`)
+	messageID, _ := msg.rawHeader(`message-id`)
+
+	return fmt.Sprintf("(%s %s %s %s %s %s %s %s %s %s)",
+		imapNString(date), imapNString(subject), from, sender, replyTo,
+		imapAddressList(msg.To), imapAddressList(msg.Cc), imapAddressList(msg.Bcc),
+		imapNString(inReplyTo), imapNString(messageID))
+}
+
+// get the unfolded value of the first field of a header, ignoring the key
+// case, from the header block as written
+func (msg Message) rawHeader(key string) (string, bool) {
+	for _, f := range splitHeaderFields(msg.Headers) {
+		if headerFieldName(f) == strings.ToLower(key) {
+			_, v, _ := bytes.Cut(f, []byte(":"))
+			return strings.TrimSpace(string(unfold(v))), true
+		}
+	}
+	return "", false
+}
+
+// get the raw (still encoded) contents of a part
+func (msg Message) rawPart(p Part) []byte {
+	if p.Raw != nil {
+		return p.Raw
+	}
+
+	start := p.Offset - msg.BodyOffset
+	if start < 0 || start+p.Length > len(msg.Body) {
+		return p.Data
+	}
+	return msg.Body[start : start+p.Length]
+}
+
+func (msg Message) bodyStructure(p Part) string {
+	h := textproto.MIMEHeader(p.Headers)
+	mt, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mt == "" {
+		mt, params, _ = mime.ParseMediaType(p.Type)
+	}
+
+	if params == nil {
+		params = make(map[string]string)
+	}
+
+	typ, subtype, _ := strings.Cut(mt, "/")
+	typ, subtype = strings.ToUpper(typ), strings.ToUpper(subtype)
+
+	ext := fmt.Sprintf("%s %s %s",
+		imapDisposition(h.Get("Content-Disposition")),
+		imapNString(h.Get("Content-Language")),
+		imapNString(h.Get("Content-Location")))
+
+	if p.Children != nil {
+		var b strings.Builder
+		b.WriteString("(")
+		for _, c := range p.Children {
+			b.WriteString(msg.bodyStructure(c))
+		}
+		fmt.Fprintf(&b, " %s %s %s)", imapString(subtype), imapParams(params), ext)
+		return b.String()
+	}
+
+	if typ == "TEXT" && params["charset"] == "" {
+		params["charset"] = "us-ascii"
+	}
+
+	encoding := strings.ToUpper(p.TransferEncoding)
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+
+	raw := msg.rawPart(p)
+	fields := fmt.Sprintf("%s %s %s %s %s %s %d",
+		imapString(typ), imapString(subtype), imapParams(params),
+		imapNString(h.Get("Content-Id")), imapNString(h.Get("Content-Description")),
+		imapString(encoding), len(raw))
+
+	switch {
+	case typ == "TEXT":
+		fields += fmt.Sprintf(" %d", countLines(raw))
+	case typ == "MESSAGE" && subtype == "RFC822":
+		// the encapsulated message is described as well
+		inner, _ := Parse(raw)
+		fields += fmt.Sprintf(" %s %s %d", inner.IMAPEnvelope(), inner.BodyStructure(), countLines(raw))
+	}
+
+	return fmt.Sprintf("(%s %s %s)", fields, imapNString(h.Get("Content-Md5")), ext)
+}
+
+// count the lines of a body the way IMAP reports them
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte("\n"))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// format a string as an IMAP quoted string, or a literal when it can't be
+// quoted
+func imapString(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' || s[i] == '\n' || s[i] >= 0x80 || s[i] == 0 {
+			return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+		}
+	}
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// format a string that is NIL when empty
+func imapNString(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return imapString(s)
+}
+
+// format a parameters list ordered by name
+func imapParams(ps map[string]string) string {
+	if len(ps) == 0 {
+		return "NIL"
+	}
+
+	keys := make([]string, 0, len(ps))
+	for k := range ps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	l := []string{}
+	for _, k := range keys {
+		l = append(l, imapString(strings.ToUpper(k)), imapString(ps[k]))
+	}
+
+	return "(" + strings.Join(l, " ") + ")"
+}
+
+// format the Content-Disposition header
+func imapDisposition(cd string) string {
+	d, ps, err := mime.ParseMediaType(cd)
+	if cd == "" || err != nil {
+		return "NIL"
+	}
+	return fmt.Sprintf("(%s %s)", imapString(strings.ToUpper(d)), imapParams(ps))
+}
+
+// format an address list, groups being delimited as RFC 3501 describes
+func imapAddressList(al []Address) string {
+	var l []string
+	for _, a := range al {
+		switch v := a.(type) {
+		case MailboxAddr:
+			l = append(l, imapAddress(v))
+		case GroupAddr:
+			l = append(l, fmt.Sprintf("(NIL NIL %s NIL)", imapString(v.name)))
+			for _, b := range v.boxes {
+				l = append(l, imapAddress(b))
+			}
+			l = append(l, "(NIL NIL NIL NIL)")
+		}
+	}
+
+	if len(l) == 0 {
+		return "NIL"
+	}
+
+	return "(" + strings.Join(l, "") + ")"
+}
+
+func imapAddress(ma MailboxAddr) string {
+	if ma.local == "" && ma.domain == "" {
+		return "(NIL NIL NIL NIL)"
+	}
+
+	// the names are sent back with the RFC 2047 encoding
+	name := strings.ReplaceAll(string(EncodeHeader(strings.Trim(ma.name, `"`), "UTF-8")), "\r\n ", " ")
+	return fmt.Sprintf("(%s NIL %s %s)", imapNString(name), imapString(ma.local), imapString(ma.domain))
+}
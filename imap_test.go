@@ -0,0 +1,43 @@
+package eml
+
+import (
+	"testing"
+)
+
+func TestRawHeader(t *testing.T) {
+	msg, errs := Parse([]byte("Subject: first\r\n line\r\n" +
+		"SENDER: one@example.com\r\n" +
+		"Sender: two@example.com\r\n" +
+		"subject: second\r\n" +
+		"\r\n" +
+		"body\r\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the first field as written, whatever the case of the others
+	for i := 0; i < 20; i++ {
+		if v, ok := msg.rawHeader("sender"); !ok || v != "one@example.com" {
+			t.Fatalf("sender = %q, %v", v, ok)
+		}
+	}
+	if v, _ := msg.rawHeader("SUBJECT"); v != "first line" {
+		t.Errorf("subject = %q", v)
+	}
+	if v, ok := msg.rawHeader("date"); ok {
+		t.Errorf("date = %q", v)
+	}
+}
+
+func TestIMAPEnvelopeSender(t *testing.T) {
+	msg, errs := Parse([]byte("From: a@example.com\r\nSubject: s\r\n\r\nbody\r\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the sender defaults to the from addresses
+	want := `(NIL "s" ((NIL NIL "a" "example.com")) ((NIL NIL "a" "example.com")) ((NIL NIL "a" "example.com")) NIL NIL NIL NIL NIL)`
+	if env := msg.IMAPEnvelope(); env != want {
+		t.Errorf("envelope = %s, want %s", env, want)
+	}
+}
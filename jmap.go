@@ -0,0 +1,312 @@
+// JMAP (RFC 8621) Email object mapping.
+
+package eml
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type jmapHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type jmapAddress struct {
+	Name  *string `json:"name"`
+	Email string  `json:"email"`
+}
+
+type jmapBodyPart struct {
+	PartID      *string         `json:"partId"`
+	Size        int             `json:"size"`
+	Headers     []jmapHeader    `json:"headers"`
+	Name        *string         `json:"name"`
+	Type        string          `json:"type"`
+	Charset     *string         `json:"charset"`
+	Disposition *string         `json:"disposition"`
+	Cid         *string         `json:"cid"`
+	Language    []string        `json:"language"`
+	Location    *string         `json:"location"`
+	SubParts    []*jmapBodyPart `json:"subParts,omitempty"`
+
+	data []byte // decoded contents, for the bodyValues
+}
+
+type jmapBodyValue struct {
+	Value             string `json:"value"`
+	IsEncodingProblem bool   `json:"isEncodingProblem"`
+	IsTruncated       bool   `json:"isTruncated"`
+}
+
+// ToJMAP emits the message as a JSON encoded JMAP Email object, with the
+// body structure, the text, html and attachments lists, the values of the
+// text parts and the raw headers also available as "header:{name}"
+// properties
+func (msg Message) ToJMAP() ([]byte, error) {
+	email := make(map[string]interface{})
+
+	// header fields, in order
+	headers := jmapHeaders(msg.Headers)
+	for _, h := range headers {
+		// the last instance of each header is the one exposed
+		email["header:"+h.Name] = strings.TrimSpace(string(unfold([]byte(h.Value))))
+	}
+	email["headers"] = headers
+
+	email["messageId"] = nullableList(msg.MessageID)
+	email["inReplyTo"] = msg.InReply
+	email["references"] = msg.References
+	// the parser fills Sender from the From field when missing
+	if _, ok := msg.rawHeader(`sender`); ok {
+		email["sender"] = jmapAddresses([]Address{msg.Sender})
+	} else {
+		email["sender"] = nil
+	}
+	email["from"] = jmapAddresses(msg.From)
+	email["to"] = jmapAddresses(msg.To)
+	email["cc"] = jmapAddresses(msg.Cc)
+	email["bcc"] = jmapAddresses(msg.Bcc)
+	email["replyTo"] = jmapAddresses(msg.ReplyTo)
+	email["subject"] = msg.Subject
+	email["size"] = msg.BodyOffset + len(msg.Body)
+
+	if _, ok := msg.rawHeader(`date`); ok {
+		email["sentAt"] = msg.Date.Format(time.RFC3339)
+	} else {
+		email["sentAt"] = nil
+	}
+
+	// messages without Content-Type are a single text/plain part
+	root := msg.Root
+	if root.Type == "" {
+		root = Part{Type: "text/plain", Data: []byte(msg.Text), Length: len(msg.Body)}
+	}
+
+	structure := msg.jmapBodyPart(root, "")
+	email["bodyStructure"] = structure
+
+	textBody, htmlBody, attachments := []*jmapBodyPart{}, []*jmapBodyPart{}, []*jmapBodyPart{}
+	jmapParseStructure([]*jmapBodyPart{structure}, "mixed", false, &htmlBody, &textBody, &attachments)
+
+	email["textBody"] = textBody
+	email["htmlBody"] = htmlBody
+	email["attachments"] = attachments
+	email["hasAttachment"] = len(attachments) > 0
+
+	values := make(map[string]jmapBodyValue)
+	collectBodyValues(structure, values)
+	email["bodyValues"] = values
+
+	// the textBody may hold inline media, only the text goes at the
+	// preview
+	preview := ""
+	for _, p := range textBody {
+		if strings.HasPrefix(p.Type, "text/") {
+			preview += string(p.data) + " "
+		}
+	}
+	preview = strings.Join(strings.Fields(preview), " ")
+	if r := []rune(preview); len(r) > 256 {
+		preview = string(r[:256])
+	}
+	email["preview"] = preview
+
+	return json.Marshal(email)
+}
+
+// split a header block into its fields, the values kept raw
+func jmapHeaders(block []byte) []jmapHeader {
+	headers := []jmapHeader{}
+	for _, f := range splitHeaderFields(bytes.TrimRight(block, "\r\n")) {
+		k, v, _ := bytes.Cut(bytes.TrimRight(f, "\r\n"), []byte(":"))
+		headers = append(headers, jmapHeader{string(k), string(v)})
+	}
+	return headers
+}
+
+// build the EmailBodyPart of a part, numbering them as the IMAP sections
+func (msg Message) jmapBodyPart(p Part, section string) *jmapBodyPart {
+	h := textproto.MIMEHeader(p.Headers)
+
+	bp := &jmapBodyPart{
+		Size:        len(msg.rawPart(p)),
+		Headers:     []jmapHeader{},
+		Name:        nullableString(p.Filename),
+		Disposition: nullableString(p.Disposition),
+		Cid:         nullableString(p.ContentID),
+		Location:    nullableString(h.Get("Content-Location")),
+		data:        p.Data,
+	}
+
+	mt, ps, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mt, ps, _ = mime.ParseMediaType(p.Type)
+	}
+	bp.Type = strings.ToLower(mt)
+	if bp.Type == "" {
+		bp.Type = "text/plain"
+	}
+	if cs := ps["charset"]; cs != "" {
+		bp.Charset = &cs
+	} else if strings.HasPrefix(bp.Type, "text/") {
+		cs = "us-ascii"
+		bp.Charset = &cs
+	}
+
+	for _, l := range strings.Split(h.Get("Content-Language"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			bp.Language = append(bp.Language, l)
+		}
+	}
+
+	// the header fields in order, as written (RFC 8621 section 4.1.2),
+	// the ones of the root being the message headers
+	if p.HeaderOffset == p.Offset {
+		bp.Headers = jmapHeaders(msg.Headers)
+	} else if raw := msg.RawPart(p); raw != nil {
+		bp.Headers = jmapHeaders(raw[:p.Offset-p.HeaderOffset])
+	}
+
+	if p.Children == nil {
+		if section == "" {
+			section = "1"
+		}
+		bp.PartID = &section
+		return bp
+	}
+
+	for i, c := range p.Children {
+		sub := strconv.Itoa(i + 1)
+		if section != "" {
+			sub = section + "." + sub
+		}
+		bp.SubParts = append(bp.SubParts, msg.jmapBodyPart(c, sub))
+	}
+
+	return bp
+}
+
+// the media types that can be displayed inline
+func isInlineMediaType(t string) bool {
+	return strings.HasPrefix(t, "image/") || strings.HasPrefix(t, "audio/") || strings.HasPrefix(t, "video/")
+}
+
+// split the parts into the text, html and attachments lists following the
+// algorithm from RFC 8621 section 4.1.4
+func jmapParseStructure(parts []*jmapBodyPart, multipartType string, inAlternative bool, htmlBody, textBody, attachments *[]*jmapBodyPart) {
+	textLength, htmlLength := -1, -1
+	if textBody != nil {
+		textLength = len(*textBody)
+	}
+	if htmlBody != nil {
+		htmlLength = len(*htmlBody)
+	}
+
+	for i, part := range parts {
+		isInline := (part.Disposition == nil || *part.Disposition != "attachment") &&
+			(part.Type == "text/plain" || part.Type == "text/html" || isInlineMediaType(part.Type)) &&
+			(i == 0 || (multipartType != "related" && (isInlineMediaType(part.Type) || part.Name == nil)))
+
+		switch {
+		case strings.HasPrefix(part.Type, "multipart/"):
+			sub := strings.TrimPrefix(part.Type, "multipart/")
+			jmapParseStructure(part.SubParts, sub, inAlternative || sub == "alternative", htmlBody, textBody, attachments)
+		case isInline:
+			if multipartType == "alternative" {
+				switch part.Type {
+				case "text/plain":
+					*textBody = append(*textBody, part)
+				case "text/html":
+					*htmlBody = append(*htmlBody, part)
+				default:
+					*attachments = append(*attachments, part)
+				}
+				continue
+			}
+
+			if inAlternative {
+				if part.Type == "text/plain" {
+					htmlBody = nil
+				}
+				if part.Type == "text/html" {
+					textBody = nil
+				}
+			}
+
+			if textBody != nil {
+				*textBody = append(*textBody, part)
+			}
+			if htmlBody != nil {
+				*htmlBody = append(*htmlBody, part)
+			}
+			if (textBody == nil || htmlBody == nil) && isInlineMediaType(part.Type) {
+				*attachments = append(*attachments, part)
+			}
+		default:
+			*attachments = append(*attachments, part)
+		}
+	}
+
+	if multipartType == "alternative" && textBody != nil && htmlBody != nil {
+		// an alternative without one of the versions uses the other one
+		if textLength == len(*textBody) && htmlLength != len(*htmlBody) {
+			*textBody = append(*textBody, (*htmlBody)[htmlLength:]...)
+		}
+		if htmlLength == len(*htmlBody) && textLength != len(*textBody) {
+			*htmlBody = append(*htmlBody, (*textBody)[textLength:]...)
+		}
+	}
+}
+
+// collect the decoded values of the text leaf parts
+func collectBodyValues(bp *jmapBodyPart, values map[string]jmapBodyValue) {
+	for _, s := range bp.SubParts {
+		collectBodyValues(s, values)
+	}
+
+	if bp.PartID != nil && strings.HasPrefix(bp.Type, "text/") {
+		values[*bp.PartID] = jmapBodyValue{Value: string(bytes.ToValidUTF8(bp.data, []byte("�")))}
+	}
+}
+
+// convert the addresses to EmailAddress objects, flattening the groups
+func jmapAddresses(al []Address) []jmapAddress {
+	l := []jmapAddress{}
+	for _, a := range al {
+		switch v := a.(type) {
+		case MailboxAddr:
+			if v.local != "" || v.domain != "" {
+				l = append(l, jmapAddress{nullableString(strings.Trim(v.name, `"`)), v.Email()})
+			}
+		case GroupAddr:
+			for _, b := range v.boxes {
+				l = append(l, jmapAddress{nullableString(strings.Trim(b.name, `"`)), b.Email()})
+			}
+		}
+	}
+
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullableList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
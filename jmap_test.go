@@ -0,0 +1,145 @@
+package eml
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// the body part headers keep their order and raw values (RFC 8621 section
+// 4.1.2)
+func TestJMAPPartHeaders(t *testing.T) {
+	data := "From: a@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+		"\r\n" +
+		"--XX\r\n" +
+		"X-Z: first\r\n" +
+		"Content-Type: text/plain;\r\n charset=utf-8\r\n" +
+		"X-A: second\r\n" +
+		"x-z: third\r\n" +
+		"\r\n" +
+		"text\r\n" +
+		"--XX--\r\n"
+	msg, errs := Parse([]byte(data))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	b, err := msg.ToJMAP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var email struct {
+		Headers       []jmapHeader `json:"headers"`
+		BodyStructure struct {
+			Headers  []jmapHeader `json:"headers"`
+			SubParts []struct {
+				Headers []jmapHeader `json:"headers"`
+			} `json:"subParts"`
+		} `json:"bodyStructure"`
+	}
+	if err := json.Unmarshal(b, &email); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []jmapHeader{
+		{"X-Z", " first"},
+		{"Content-Type", " text/plain;\r\n charset=utf-8"},
+		{"X-A", " second"},
+		{"x-z", " third"},
+	}
+	if len(email.BodyStructure.SubParts) != 1 {
+		t.Fatalf("got %d sub parts", len(email.BodyStructure.SubParts))
+	}
+	if got := email.BodyStructure.SubParts[0].Headers; !equalHeaders(got, want) {
+		t.Errorf("part headers = %q, want %q", got, want)
+	}
+
+	// the root part has the message headers
+	if got := email.BodyStructure.Headers; !equalHeaders(got, email.Headers) || len(got) != 2 {
+		t.Errorf("root headers = %q, want %q", got, email.Headers)
+	}
+}
+
+func equalHeaders(a, b []jmapHeader) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJMAPPreviewSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		preview string
+		sender  string
+	}{
+		{
+			name: "inline image",
+			data: "From: a@example.com\r\n" +
+				"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+				"\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"hello\r\n" +
+				"--XX\r\n" +
+				"Content-Type: image/png\r\n" +
+				"Content-Disposition: inline\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"iVBORw0KGgo=\r\n" +
+				"--XX--\r\n",
+			preview: "hello",
+		},
+		{
+			name: "sender",
+			data: "From: a@example.com\r\n" +
+				"Sender: b@example.com\r\n" +
+				"\r\n" +
+				"hello\r\n",
+			preview: "hello",
+			sender:  "b@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, errs := Parse([]byte(tt.data))
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			b, err := msg.ToJMAP()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var email struct {
+				Preview string        `json:"preview"`
+				Sender  []jmapAddress `json:"sender"`
+			}
+			if err := json.Unmarshal(b, &email); err != nil {
+				t.Fatal(err)
+			}
+
+			if email.Preview != tt.preview {
+				t.Errorf("preview = %q, want %q", email.Preview, tt.preview)
+			}
+
+			sender := ""
+			for _, a := range email.Sender {
+				sender += a.Email
+			}
+			if sender != tt.sender {
+				t.Errorf("sender = %q, want %q", sender, tt.sender)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// JSON representation of the parsed messages.
+//
+// The messages are encoded as objects with a "version" member holding the
+// JSONSchemaVersion, followed by the fields of the Message struct named by
+// their json tags. The binary data (raw headers, body, parts and
+// attachments contents) is base64 encoded, the dates use the RFC 3339
+// format and the priority is one of "none", "highest", "high", "normal",
+// "low" or "lowest". The addresses are objects with a "type" member:
+//
+//	{"type": "mailbox", "name": "Alice", "email": "alice@example.com"}
+//	{"type": "group", "name": "Team", "members": [{"type": "mailbox", ...}]}
+//	{"type": "raw", "raw": "john at example dot com"}
+
+package eml
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONSchemaVersion is the version of the JSON representation of the
+// messages, increased on incompatible changes
+const JSONSchemaVersion = 1
+
+type jsonAddress struct {
+	Type    string        `json:"type"`
+	Name    string        `json:"name,omitempty"`
+	RawName string        `json:"raw_name,omitempty"`
+	Email   string        `json:"email,omitempty"`
+	Members []jsonAddress `json:"members,omitempty"`
+	Raw     string        `json:"raw,omitempty"`
+}
+
+// convert a JSON address back into a MailboxAddr, GroupAddr or RawAddress
+func (ja jsonAddress) address() Address {
+	if ja.Type == "raw" {
+		return RawAddress{raw: ja.Raw}
+	}
+
+	if ja.Type == "group" {
+		ga := GroupAddr{name: ja.Name, rawName: ja.RawName, boxes: []MailboxAddr{}}
+		for _, m := range ja.Members {
+			if ma, ok := m.address().(MailboxAddr); ok {
+				ga.boxes = append(ga.boxes, ma)
+			}
+		}
+		return ga
+	}
+
+	ma := MailboxAddr{name: ja.Name, rawName: ja.RawName}
+	if i := strings.LastIndex(ja.Email, "@"); i >= 0 {
+		ma.local, ma.domain = ja.Email[:i], ja.Email[i+1:]
+	} else {
+		ma.local = ja.Email
+	}
+	return ma
+}
+
+func jsonAddresses(l []jsonAddress) (al []Address) {
+	for _, ja := range l {
+		al = append(al, ja.address())
+	}
+	return
+}
+
+func jsonAddressPtr(ja *jsonAddress) Address {
+	if ja == nil {
+		return nil
+	}
+	return ja.address()
+}
+
+func (ma MailboxAddr) MarshalJSON() ([]byte, error) {
+	email := ""
+	if ma.local != "" || ma.domain != "" {
+		email = ma.Email()
+	}
+	return json.Marshal(jsonAddress{Type: "mailbox", Name: ma.name, RawName: ma.rawName, Email: email})
+}
+
+func (ga GroupAddr) MarshalJSON() ([]byte, error) {
+	ja := jsonAddress{Type: "group", Name: ga.name, RawName: ga.rawName, Members: []jsonAddress{}}
+	for _, b := range ga.boxes {
+		ja.Members = append(ja.Members, jsonAddress{Type: "mailbox", Name: b.name, RawName: b.rawName, Email: b.Email()})
+	}
+	return json.Marshal(ja)
+}
+
+func (ra RawAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonAddress{Type: "raw", Raw: ra.raw})
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(b []byte) error {
+	for c := PriorityNone; c <= PriorityLowest; c++ {
+		if c.String() == string(b) {
+			*p = c
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid priority %q", b)
+}
+
+// aliases without the JSON methods, to use the default encoding
+type messageAlias Message
+type resentAlias ResentBlock
+
+func (msg Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		messageAlias
+	}{JSONSchemaVersion, messageAlias(msg)})
+}
+
+func (msg *Message) UnmarshalJSON(b []byte) error {
+	v := struct {
+		Version int `json:"version"`
+		*messageAlias
+		Sender        *jsonAddress  `json:"sender"`
+		From          []jsonAddress `json:"from"`
+		ReplyTo       []jsonAddress `json:"reply_to"`
+		To            []jsonAddress `json:"to"`
+		Cc            []jsonAddress `json:"cc"`
+		Bcc           []jsonAddress `json:"bcc"`
+		ReadReceiptTo []jsonAddress `json:"read_receipt_to"`
+	}{messageAlias: (*messageAlias)(msg)}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	if v.Version > JSONSchemaVersion {
+		return fmt.Errorf("unsupported message schema version %d", v.Version)
+	}
+
+	msg.Sender = jsonAddressPtr(v.Sender)
+	msg.From = jsonAddresses(v.From)
+	msg.ReplyTo = jsonAddresses(v.ReplyTo)
+	msg.To = jsonAddresses(v.To)
+	msg.Cc = jsonAddresses(v.Cc)
+	msg.Bcc = jsonAddresses(v.Bcc)
+	msg.ReadReceiptTo = jsonAddresses(v.ReadReceiptTo)
+
+	return nil
+}
+
+func (rb *ResentBlock) UnmarshalJSON(b []byte) error {
+	v := struct {
+		*resentAlias
+		From   []jsonAddress `json:"from"`
+		Sender *jsonAddress  `json:"sender"`
+		To     []jsonAddress `json:"to"`
+		Cc     []jsonAddress `json:"cc"`
+		Bcc    []jsonAddress `json:"bcc"`
+	}{resentAlias: (*resentAlias)(rb)}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	rb.From = jsonAddresses(v.From)
+	rb.Sender = jsonAddressPtr(v.Sender)
+	rb.To = jsonAddresses(v.To)
+	rb.Cc = jsonAddresses(v.Cc)
+	rb.Bcc = jsonAddresses(v.Bcc)
+
+	return nil
+}
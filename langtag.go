@@ -0,0 +1,53 @@
+// Content-Language (RFC 3282) and Accept-Language language tags.
+
+package eml
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// ParseLanguageTags parses a Content-Language value, a list of BCP 47
+// tags, normalizing their case and the deprecated forms, like "EN-us" to
+// "en-US" or "iw" to "he". The invalid tags are skipped, the first one
+// being reported.
+func ParseLanguageTags(v string) (tags []string, err error) {
+	for _, s := range strings.Split(stripComments(string(unfold([]byte(v)))), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		t, e := language.Parse(s)
+		if e != nil {
+			if err == nil {
+				err = fmt.Errorf("invalid language tag %q: %v", s, e)
+			}
+			continue
+		}
+		tags = append(tags, t.String())
+	}
+	return
+}
+
+// ParseAcceptLanguage parses an Accept-Language value, giving the tags
+// normalized like ParseLanguageTags and sorted by their quality, the
+// preferred first. The tags with a zero quality and the wildcard are
+// dropped.
+func ParseAcceptLanguage(v string) ([]string, error) {
+	ts, _, err := language.ParseAcceptLanguage(stripComments(string(unfold([]byte(v)))))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Accept-Language: %v", err)
+	}
+
+	// the wildcard comes as the "mul" tag
+	var tags []string
+	for _, t := range ts {
+		if t != language.Und && t.String() != "mul" {
+			tags = append(tags, t.String())
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,194 @@
+// Language detection of the message bodies.
+
+package eml
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// most frequent trigrams of the latin script languages, in order, the
+// underscores being word boundaries
+var languageTrigrams = map[string]string{
+	"en": "_th the he_ _an and nd_ ing ng_ _of of_ ion _to to_ _in in_ ed_ er_ tio ent _a_ is_ es_ re_ _re _be _co hat tha _ha ati for _fo or_ on_ at_ ter _wi _is his _it it_ _yo you ou_ all",
+	"fr": "_de de_ es_ _le le_ ent _la la_ _et et_ ion on_ _qu que ue_ _pa les nt_ _co tio re_ _un _pr our _po _en en_ _da dan ans _pl par ait ns_ _au _ce ur_ _vo vou ous _ne _se men est",
+	"de": "en_ er_ _de der ich ie_ die _di ein _ei sch che ch_ cht _un und nd_ ine gen den _da _in in_ te_ ten ung _ge ge_ _be ht_ _ic _si sie ber ist _is st_ _zu _mi mit it_ _au auf _wi",
+	"es": "_de de_ os_ _la la_ es_ _qu que ue_ _el el_ en_ _en as_ ent _co _lo ión ón_ _se ado do_ _po _pa ar_ _un nte _es _ma ara par ra_ _su _pr con los _ha cio aci ien _no por",
+	"it": "_di di_ _ch che he_ to_ _la la_ re_ _il il_ _de del ell lla _co ion one ne_ _in _e_ ent are _pe per er_ no_ _no _un _st zio _so ato _pr _qu _a_ tto ere _se _al con ti_ _es",
+	"pt": "_de de_ os_ _qu que ue_ _a_ _o_ do_ da_ _da _do ão_ ção _co _se ent _pa _e_ es_ _em em_ ra_ ara par _na nte _pr com _no _um as_ ar_ _es _po por or_ mos _ma ado não _nã",
+	"nl": "en_ _de de_ an_ _va van _he het et_ er_ _en _ee een _in in_ _ge ij_ _da _ve ver _di dat at_ ijk _zi _te _me _we _ni nie _op _vo _is is_ _ze oor ing gen cht ond sch _be aar",
+}
+
+// ranks of the trigrams of each language, built from languageTrigrams
+var trigramRanks = func() map[string]map[string]int {
+	ranks := make(map[string]map[string]int)
+	for lang, l := range languageTrigrams {
+		ranks[lang] = make(map[string]int)
+		for i, t := range strings.Fields(l) {
+			ranks[lang][strings.ReplaceAll(t, "_", " ")] = i
+		}
+	}
+	return ranks
+}()
+
+// languages told by their script alone
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// minimum number of letters to tell the language of a text
+const minLanguageLetters = 20
+
+// DetectLanguage finds the language of the message text, or of the HTML
+// one when there's no plain text, as a BCP 47 tag like "en" or "ja". The
+// first tag of the Content-Language header is used when the text is too
+// short or of an unknown language, and an empty string when missing too.
+func (msg Message) DetectLanguage() string {
+	text := msg.Text
+	if strings.TrimSpace(text) == "" {
+		text = htmlText(msg.Html)
+	}
+
+	if lang, _ := DetectTextLanguage(text); lang != "" {
+		return lang
+	}
+
+	if len(msg.ContentLanguage) > 0 {
+		return msg.ContentLanguage[0]
+	}
+	return ""
+}
+
+// DetectTextLanguage finds the language of a text, by its script or by the
+// most frequent trigrams of English, French, German, Spanish, Italian,
+// Portuguese and Dutch. The confidence goes from 0 to 1, and the language
+// is empty when it can't be told.
+func DetectTextLanguage(text string) (lang string, confidence float64) {
+	// count the letters of each script
+	scripts := make(map[string]int)
+	latin, letters := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+
+	if letters < minLanguageLetters {
+		return "", 0
+	}
+
+	// the Japanese texts mix kana with Han characters
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	best, count := "", 0
+	for l, n := range scripts {
+		if n > count || (n == count && l < best) {
+			best, count = l, n
+		}
+	}
+	if count > latin {
+		if best == "ru" && strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			best = "uk"
+		}
+		return best, float64(count) / float64(letters)
+	}
+
+	return detectTrigrams(text)
+}
+
+// score the text trigrams against the profiles of each language
+func detectTrigrams(text string) (string, float64) {
+	// words of lowercase letters between spaces
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+
+	counts := make(map[string]int)
+	for _, w := range words {
+		r := []rune(" " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			counts[string(r[i:i+3])]++
+		}
+	}
+
+	type score struct {
+		lang  string
+		value float64
+	}
+	var scores []score
+	for lang, ranks := range trigramRanks {
+		v := 0.0
+		for t, n := range counts {
+			if rank, ok := ranks[t]; ok {
+				v += float64(n) * float64(len(ranks)-rank) / float64(len(ranks))
+			}
+		}
+		scores = append(scores, score{lang, v})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].value != scores[j].value {
+			return scores[i].value > scores[j].value
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	if scores[0].value == 0 {
+		return "", 0
+	}
+	return scores[0].lang, (scores[0].value - scores[1].value) / scores[0].value
+}
+
+// get the visible text of an HTML document
+func htmlText(doc string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(doc))
+	skip := 0
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Compliance checks of the raw messages against RFC 5322 and MIME.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Severity is the importance of a lint finding
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // style, accepted by most receivers
+	SeverityWarning                 // discouraged by the RFCs, may be rejected
+	SeverityError                   // breaks a requirement of the RFCs
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "info"
+}
+
+// Finding is a compliance problem found by Lint
+type Finding struct {
+	Severity  Severity `json:"severity"`
+	Code      string   `json:"code"`      // stable identifier of the check, like "missing-date"
+	Message   string   `json:"message"`   // description of the problem
+	Reference string   `json:"reference"` // RFC section of the requirement
+	Line      int      `json:"line"`      // line of the first occurrence, 0 for the whole message
+}
+
+// header fields that can appear at most once (RFC 5322 section 3.6)
+var singleHeaders = []string{
+	`date`, `from`, `sender`, `reply-to`, `to`, `cc`, `bcc`, `message-id`,
+	`in-reply-to`, `references`, `subject`,
+}
+
+// Lint checks the message data against RFC 5322 and the MIME RFCs,
+// returning the problems found in the order of the checks
+func Lint(data []byte) (findings []Finding) {
+	add := func(s Severity, code, ref string, line int, format string, args ...interface{}) {
+		findings = append(findings, Finding{s, code, fmt.Sprintf(format, args...), ref, line})
+	}
+
+	raw, err := ParseRaw(data)
+	if err != nil {
+		add(SeverityError, "unparseable-headers", "RFC 5322 section 2.2", 0, "the header block can't be parsed: %v", err)
+		return
+	}
+
+	// count the header fields
+	count := make(map[string]int)
+	first := make(map[string]int) // line of the first field with each name
+	for _, f := range splitHeaderFields(data[:raw.BodyOffset]) {
+		name := headerFieldName(f)
+		if name == "" {
+			continue
+		}
+		count[name]++
+		if _, ok := first[name]; !ok {
+			first[name] = lineAt(data, bytes.Index(data, f))
+		}
+	}
+
+	if count[`date`] == 0 {
+		add(SeverityError, "missing-date", "RFC 5322 section 3.6", 0, "missing Date header")
+	}
+	if count[`from`] == 0 {
+		add(SeverityError, "missing-from", "RFC 5322 section 3.6", 0, "missing From header")
+	}
+	if count[`message-id`] == 0 {
+		add(SeverityWarning, "missing-message-id", "RFC 5322 section 3.6.4", 0, "missing Message-ID header")
+	}
+
+	for _, h := range singleHeaders {
+		if count[h] > 1 {
+			add(SeverityError, "duplicate-"+h, "RFC 5322 section 3.6", first[h], "%d %s headers, only one is allowed", count[h], h)
+		}
+	}
+
+	for _, rh := range raw.RawHeaders {
+		if hasNonASCII(rh.Value) {
+			add(SeverityWarning, "8bit-header", "RFC 5322 section 2.2, RFC 6532", first[strings.ToLower(string(rh.Key))],
+				"raw 8-bit data at the %s header, needs the RFC 2047 encoding or SMTPUTF8", rh.Key)
+		}
+	}
+
+	// MIME messages must declare their version
+	if count[`mime-version`] == 0 && (count[`content-type`] > 0 || count[`content-transfer-encoding`] > 0 || hasNonASCII(raw.Body)) {
+		add(SeverityError, "missing-mime-version", "RFC 2045 section 4", 0, "missing MIME-Version header at a MIME message")
+	}
+
+	// the line lengths and endings
+	longLine, wideLine, bareCR, bareLF := 0, 0, 0, 0
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for n, l := range lines {
+		l = bytes.TrimSuffix(l, []byte("\n"))
+		if bytes.HasSuffix(l, []byte("\r")) {
+			l = l[:len(l)-1]
+		} else if bytes.HasSuffix(lines[n], []byte("\n")) && bareLF == 0 {
+			bareLF = n + 1
+		}
+
+		if bytes.IndexByte(l, '\r') >= 0 && bareCR == 0 {
+			bareCR = n + 1
+		}
+		if len(l) > maxBodyLineLen && longLine == 0 {
+			longLine = n + 1
+		}
+		if len(l) > 78 && wideLine == 0 {
+			wideLine = n + 1
+		}
+	}
+
+	if longLine > 0 {
+		add(SeverityError, "line-too-long", "RFC 5322 section 2.1.1", longLine, "line over %d characters", maxBodyLineLen)
+	}
+	if wideLine > 0 && longLine == 0 {
+		add(SeverityInfo, "line-over-78", "RFC 5322 section 2.1.1", wideLine, "line over 78 characters")
+	}
+	if bareCR > 0 {
+		add(SeverityError, "bare-cr", "RFC 5322 section 2.3", bareCR, "CR not followed by LF")
+	}
+	if bareLF > 0 {
+		add(SeverityInfo, "bare-lf", "RFC 5322 section 2.3", bareLF, "LF line endings instead of CRLF")
+	}
+
+	// the boundaries must not appear inside the nested parts
+	msg, _ := Parse(data)
+	var check func(p Part, outer []string)
+	check = func(p Part, outer []string) {
+		if p.Children == nil {
+			return
+		}
+
+		_, ps, _ := mime.ParseMediaType(firstHeader(p.Headers, "Content-Type"))
+		b := ps["boundary"]
+		if b != "" {
+			for _, o := range outer {
+				if strings.HasPrefix(b, o) || strings.HasPrefix(o, b) {
+					add(SeverityError, "boundary-reuse", "RFC 2046 section 5.1.1", lineAt(data, p.HeaderOffset),
+						"boundary %q of a nested multipart collides with the enclosing %q", b, o)
+				}
+			}
+			outer = append(outer[:len(outer):len(outer)], b)
+		}
+
+		for _, c := range p.Children {
+			check(c, outer)
+		}
+	}
+	check(msg.Root, nil)
+
+	return
+}
+
+// get the line number of a position at the data
+func lineAt(data []byte, pos int) int {
+	if pos < 0 || pos > len(data) {
+		return 0
+	}
+	return bytes.Count(data[:pos], []byte("\n")) + 1
+}
+
+// get the first value of a header at a part headers map
+func firstHeader(headers map[string][]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+// Package maildir reads and writes messages at Maildir directories, with
+// the tmp, new and cur layout.
+package maildir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ncastellani/eml"
+)
+
+// flags set at the info suffix (":2,FS") of the messages filenames
+const (
+	FlagDraft   = 'D'
+	FlagFlagged = 'F'
+	FlagPassed  = 'P'
+	FlagReplied = 'R'
+	FlagSeen    = 'S'
+	FlagTrashed = 'T'
+)
+
+// Dir is the path of a Maildir
+type Dir string
+
+// Entry is a message stored at the Maildir
+type Entry struct {
+	Key   string // unique name, without the info suffix
+	Path  string // current path of the message file
+	New   bool   // not yet seen by any client, at the new directory
+	Flags string // sorted flags from the info suffix
+}
+
+// HasFlag reports whether the flag is set on the message
+func (e Entry) HasFlag(f rune) bool {
+	return strings.ContainsRune(e.Flags, f)
+}
+
+// Message reads and parses the message
+func (e Entry) Message() (eml.Message, []error) {
+	data, err := os.ReadFile(e.Path)
+	if err != nil {
+		return eml.Message{}, []error{err}
+	}
+	return eml.Parse(data)
+}
+
+// Init creates the tmp, new and cur directories
+func (d Dir) Init() error {
+	for _, s := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(string(d), s), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var deliveries int64
+
+// generate a unique filename as the Maildir specification recommends:
+// time.MusecPpidQcounter.hostname
+func uniqueName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.ReplaceAll(host, "/", `\057`)
+	host = strings.ReplaceAll(host, ":", `\072`)
+
+	now := time.Now()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000,
+		os.Getpid(), atomic.AddInt64(&deliveries, 1), host)
+}
+
+// Deliver writes the message at tmp and moves it to new once complete,
+// returning the entry of the delivered message
+func (d Dir) Deliver(data []byte) (Entry, error) {
+	key := uniqueName()
+
+	tmp := filepath.Join(string(d), "tmp", key)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return Entry{}, err
+	}
+
+	e := Entry{Key: key, Path: filepath.Join(string(d), "new", key), New: true}
+	if err := os.Rename(tmp, e.Path); err != nil {
+		os.Remove(tmp)
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+// List returns the messages at the new and cur directories
+func (d Dir) List() ([]Entry, error) {
+	var entries []Entry
+
+	for _, s := range []string{"new", "cur"} {
+		files, err := os.ReadDir(filepath.Join(string(d), s))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+
+			key, flags := ParseFilename(f.Name())
+			entries = append(entries, Entry{
+				Key:   key,
+				Path:  filepath.Join(string(d), s, f.Name()),
+				New:   s == "new",
+				Flags: flags,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// SetFlags moves the message to cur with the given flags
+func (d Dir) SetFlags(e Entry, flags string) (Entry, error) {
+	if e.Key == "" {
+		return e, errors.New("maildir: entry without key")
+	}
+
+	n := Entry{Key: e.Key, Flags: sortFlags(flags)}
+	n.Path = filepath.Join(string(d), "cur", e.Key+":2,"+n.Flags)
+
+	if err := os.Rename(e.Path, n.Path); err != nil {
+		return e, err
+	}
+
+	return n, nil
+}
+
+// ParseFilename splits a message filename into its unique key and flags,
+// sorted and without repetitions
+func ParseFilename(name string) (key, flags string) {
+	key, info, ok := strings.Cut(name, ":")
+	if !ok || !strings.HasPrefix(info, "2,") {
+		return key, ""
+	}
+	return key, sortFlags(info[2:])
+}
+
+func sortFlags(flags string) string {
+	f := []rune(flags)
+	sort.Slice(f, func(i, j int) bool { return f[i] < f[j] })
+
+	var b strings.Builder
+	for i, r := range f {
+		if i == 0 || f[i-1] != r {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
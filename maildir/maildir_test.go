@@ -0,0 +1,120 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		name, key, flags string
+	}{
+		{"1700000000.M1P2Q3.host", "1700000000.M1P2Q3.host", ""},
+		{"1700000000.M1P2Q3.host:2,", "1700000000.M1P2Q3.host", ""},
+		{"1700000000.M1P2Q3.host:2,S", "1700000000.M1P2Q3.host", "S"},
+		{"1700000000.M1P2Q3.host:2,SRF", "1700000000.M1P2Q3.host", "FRS"},
+		{"1700000000.M1P2Q3.host:2,SS", "1700000000.M1P2Q3.host", "S"},
+		{"1700000000.M1P2Q3.host:1,experimental", "1700000000.M1P2Q3.host", ""},
+	}
+
+	for _, tt := range tests {
+		key, flags := ParseFilename(tt.name)
+		if key != tt.key || flags != tt.flags {
+			t.Errorf("%s: got %q %q, want %q %q", tt.name, key, flags, tt.key, tt.flags)
+		}
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestDeliver(t *testing.T) {
+	d := Dir(t.TempDir())
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("Subject: delivered\r\n\r\nbody\r\n")
+	e, err := d.Deliver(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// written at tmp, then moved to new
+	if names := dirNames(t, filepath.Join(string(d), "tmp")); len(names) != 0 {
+		t.Errorf("left at tmp: %v", names)
+	}
+	if names := dirNames(t, filepath.Join(string(d), "new")); len(names) != 1 || names[0] != e.Key {
+		t.Errorf("new = %v, want %s", names, e.Key)
+	}
+	if !e.New || e.Path != filepath.Join(string(d), "new", e.Key) || strings.ContainsAny(e.Key, ":/") {
+		t.Errorf("entry = %+v", e)
+	}
+
+	msg, errs := e.Message()
+	if len(errs) > 0 || msg.Subject != "delivered" {
+		t.Errorf("subject = %q, errors = %v", msg.Subject, errs)
+	}
+
+	// unique names
+	other, err := d.Deliver(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Key == e.Key {
+		t.Errorf("same key %s for two deliveries", e.Key)
+	}
+
+	// setting the flags moves to cur
+	e, err = d.SetFlags(e, "SFS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.New || e.Flags != "FS" || !e.HasFlag(FlagSeen) || e.HasFlag(FlagTrashed) {
+		t.Errorf("entry = %+v", e)
+	}
+	if names := dirNames(t, filepath.Join(string(d), "cur")); len(names) != 1 || names[0] != e.Key+":2,FS" {
+		t.Errorf("cur = %v", names)
+	}
+
+	// the dot files and the directories are not messages
+	os.WriteFile(filepath.Join(string(d), "cur", ".hidden"), nil, 0600)
+	os.Mkdir(filepath.Join(string(d), "new", "sub"), 0700)
+
+	entries, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != other.Key || !entries[0].New || entries[1].Key != e.Key || entries[1].Flags != "FS" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestDeliverWithoutDirs(t *testing.T) {
+	d := Dir(t.TempDir())
+	os.Mkdir(filepath.Join(string(d), "tmp"), 0700)
+
+	// the message doesn't stay at tmp when it can't be moved
+	if _, err := d.Deliver([]byte("Subject: lost\r\n\r\n")); err == nil {
+		t.Errorf("no error without the new directory")
+	}
+	if names := dirNames(t, filepath.Join(string(d), "tmp")); len(names) != 0 {
+		t.Errorf("left at tmp: %v", names)
+	}
+
+	if _, err := d.SetFlags(Entry{}, "S"); err == nil {
+		t.Errorf("no error for an entry without key")
+	}
+}
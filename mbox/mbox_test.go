@@ -0,0 +1,186 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var date = time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+func TestRoundTrip(t *testing.T) {
+	messages := []string{
+		"Subject: lf\n\nFrom here\n>From there\n>>From everywhere\n",
+		"Subject: crlf\r\n\r\nFrom here\r\n>From there\r\n\r\n",
+		"Subject: crlf blank lines\r\n\r\nbody\r\n\r\n\r\n",
+		"Subject: no from\n\nFromage\n From indented\n",
+	}
+
+	tests := []struct {
+		format  Format
+		archive []string // lines expected at the archive
+		read    []string // the messages read back, when they differ
+	}{
+		{
+			format:  MBOXRD,
+			archive: []string{">From here\n", ">>From there\n", ">>>From everywhere\n", ">From here\r\n", ">>From there\r\n"},
+		},
+		{
+			// the quoting of mboxo can't tell the quoted lines from the
+			// ones already starting with ">From "
+			format:  MBOXO,
+			archive: []string{">From here\n", "\n>From there\n", ">>From everywhere\n", ">From here\r\n", "\n>From there\r\n"},
+			read: []string{
+				"Subject: lf\n\nFrom here\nFrom there\n>>From everywhere\n",
+				"Subject: crlf\r\n\r\nFrom here\r\nFrom there\r\n\r\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		w.Format = tt.format
+		for i, m := range messages {
+			sender := "a@example.com"
+			if i == 0 {
+				sender = ""
+			}
+			if err := w.WriteMessage(sender, date, []byte(m)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		archive := b.String()
+		for _, l := range tt.archive {
+			if !strings.Contains(archive, l) {
+				t.Errorf("format %d: %q not at the archive %q", tt.format, l, archive)
+			}
+		}
+
+		r := NewReader(strings.NewReader(archive))
+		r.Format = tt.format
+
+		var offset int64
+		for i, m := range messages {
+			e, err := r.Next()
+			if err != nil {
+				t.Fatalf("format %d: message %d: %v", tt.format, i, err)
+			}
+
+			want := m
+			if i < len(tt.read) {
+				want = tt.read[i]
+			}
+			if string(e.Raw) != want {
+				t.Errorf("format %d: message %d = %q, want %q", tt.format, i, e.Raw, want)
+			}
+			if len(e.Errors) > 0 {
+				t.Errorf("format %d: message %d: %v", tt.format, i, e.Errors)
+			}
+
+			from := "a@example.com Fri Mar  1 10:30:00 2024"
+			if i == 0 {
+				from = "MAILER-DAEMON Fri Mar  1 10:30:00 2024"
+			}
+			if e.From != from {
+				t.Errorf("format %d: message %d From_ = %q, want %q", tt.format, i, e.From, from)
+			}
+
+			if e.Offset != offset || !strings.HasPrefix(archive[e.Offset:], "From ") {
+				t.Errorf("format %d: message %d at %d, want %d", tt.format, i, e.Offset, offset)
+			}
+			offset += e.Length
+		}
+
+		if offset != int64(len(archive)) {
+			t.Errorf("format %d: entries add up to %d bytes, want %d", tt.format, offset, len(archive))
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("format %d: got %v after the last message, want io.EOF", tt.format, err)
+		}
+	}
+}
+
+// the From_ quoting is undone by format, mboxrd removing one ">" from
+// any ">*From " line and mboxo only from the ">From " ones
+func TestReadQuoting(t *testing.T) {
+	archive := "From a@example.com Fri Mar  1 10:30:00 2024\n" +
+		"Subject: quoted\n" +
+		"\n" +
+		">From here\n" +
+		">>From there\n" +
+		">Fromage\n" +
+		"\n"
+
+	for _, tt := range []struct {
+		format Format
+		want   string
+	}{
+		{MBOXRD, "Subject: quoted\n\nFrom here\n>From there\n>Fromage\n"},
+		{MBOXO, "Subject: quoted\n\nFrom here\n>>From there\n>Fromage\n"},
+	} {
+		r := NewReader(strings.NewReader(archive))
+		r.Format = tt.format
+
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(e.Raw) != tt.want {
+			t.Errorf("format %d: got %q, want %q", tt.format, e.Raw, tt.want)
+		}
+		if e.Length != int64(len(archive)) {
+			t.Errorf("format %d: length = %d, want %d", tt.format, e.Length, len(archive))
+		}
+	}
+}
+
+// an archive written with CRLF line endings, like the ones exported on
+// Windows
+func TestReadCRLF(t *testing.T) {
+	archive := "garbage\r\n" +
+		"From a@example.com Fri Mar  1 10:30:00 2024\r\n" +
+		"Subject: first\r\n" +
+		"\r\n" +
+		">From quoted\r\n" +
+		"\r\n" +
+		"From b@example.com Fri Mar  1 10:31:00 2024\r\n" +
+		"Subject: second\r\n" +
+		"\r\n" +
+		"body\r\n"
+
+	r := NewReader(strings.NewReader(archive))
+
+	e, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e.Raw) != "Subject: first\r\n\r\nFrom quoted\r\n" || e.Message.Subject != "first" {
+		t.Errorf("first = %q", e.Raw)
+	}
+	if e.From != "a@example.com Fri Mar  1 10:30:00 2024" || e.Offset != 9 {
+		t.Errorf("first From_ = %q at %d", e.From, e.Offset)
+	}
+
+	e, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e.Raw) != "Subject: second\r\n\r\nbody\r\n" || e.Message.Subject != "second" {
+		t.Errorf("second = %q", e.Raw)
+	}
+	if e.Offset+e.Length != int64(len(archive)) {
+		t.Errorf("second ends at %d, want %d", e.Offset+e.Length, len(archive))
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+
+	if _, err := NewReader(strings.NewReader("no archive\r\n")).Next(); err == nil || err == io.EOF {
+		t.Errorf("got %v for a file without From_ lines", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Package mbox reads and writes mbox archives of messages.
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/ncastellani/eml"
+)
+
+// Format is the quoting convention of the "From " lines inside the messages
+type Format int
+
+const (
+	// MBOXRD quotes every ">*From " line with one more ">", so the
+	// unquoting is reversible
+	MBOXRD Format = iota
+	// MBOXO only quotes the "From " lines, leaving ">From " ones as
+	// they are
+	MBOXO
+)
+
+// Entry is a message read from the archive
+type Entry struct {
+	From    string // the From_ line, without the "From " prefix
+	Offset  int64  // position of the From_ line at the archive
+	Length  int64  // size of the entry at the archive, From_ line included
+	Raw     []byte // the unquoted message data
+	Message eml.Message
+	Errors  []error // errors found while parsing the message
+}
+
+type Reader struct {
+	Format Format
+
+	r      *bufio.Reader
+	offset int64
+	next   []byte // From_ line of the next message
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+var fromLine = []byte("From ")
+
+// Next reads and parses the next message of the archive, returning io.EOF
+// when there are no more messages
+func (r *Reader) Next() (*Entry, error) {
+	// find the first From_ line, skipping any garbage before it
+	skipped := false
+	for r.next == nil {
+		line, err := r.readLine()
+		if len(line) == 0 && err != nil && (!skipped || err != io.EOF) {
+			return nil, err
+		}
+
+		if bytes.HasPrefix(line, fromLine) {
+			r.next = line
+			r.offset -= int64(len(line))
+			break
+		}
+		skipped = true
+
+		if err != nil {
+			return nil, errors.New("mbox: no From_ line found")
+		}
+	}
+
+	e := &Entry{
+		From:   string(bytes.TrimRight(r.next[len(fromLine):], "\r\n")),
+		Offset: r.offset,
+	}
+	r.offset += int64(len(r.next))
+	e.Length = int64(len(r.next))
+	r.next = nil
+
+	var data []byte
+	for {
+		line, err := r.readLine()
+		if bytes.HasPrefix(line, fromLine) {
+			r.next = line
+			r.offset -= int64(len(line))
+			break
+		}
+
+		e.Length += int64(len(line))
+		data = append(data, r.unquote(line)...)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the blank line before the next From_ line is a separator
+	if bytes.HasSuffix(data, []byte("\r\n\r\n")) {
+		data = data[:len(data)-2]
+	} else if bytes.HasSuffix(data, []byte("\n\n")) {
+		data = data[:len(data)-1]
+	}
+
+	e.Raw = data
+	e.Message, e.Errors = eml.Parse(data)
+
+	return e, nil
+}
+
+// read a line keeping its ending, and track the archive offset
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	r.offset += int64(len(line))
+	return line, err
+}
+
+// remove the quoting of the lines starting with ">From "
+func (r *Reader) unquote(line []byte) []byte {
+	if len(line) == 0 || line[0] != '>' {
+		return line
+	}
+
+	if r.Format == MBOXO {
+		if bytes.HasPrefix(line, []byte(">From ")) {
+			return line[1:]
+		}
+		return line
+	}
+
+	if bytes.HasPrefix(bytes.TrimLeft(line, ">"), fromLine) {
+		return line[1:]
+	}
+
+	return line
+}
@@ -0,0 +1,60 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+type Writer struct {
+	Format Format
+
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteMessage appends a message to the archive, synthesizing the From_
+// line from the envelope sender (MAILER-DAEMON when empty) and the
+// delivery date, and quoting the message lines that look like a From_ line
+func (w *Writer) WriteMessage(sender string, date time.Time, data []byte) error {
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From %s %s\n", sender, date.UTC().Format(time.ANSIC))
+
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+
+		if w.quote(line) {
+			b.WriteByte('>')
+		}
+		b.Write(line)
+	}
+
+	// the messages end with a line break plus a blank separator line
+	if !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+// check if a message line must be quoted
+func (w *Writer) quote(line []byte) bool {
+	if w.Format == MBOXO {
+		return bytes.HasPrefix(line, fromLine)
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), fromLine)
+}
@@ -0,0 +1,60 @@
+// Structured Content-Type values.
+
+package eml
+
+import (
+	"mime"
+	"strings"
+)
+
+// MediaType is a parsed Content-Type value
+type MediaType struct {
+	Type    string            `json:"type"`    // lowercase top level type, like "text"
+	Subtype string            `json:"subtype"` // lowercase subtype, like "plain"
+	Params  map[string]string `json:"params"`  // parameters by lowercase name, with the values decoded
+	Raw     string            `json:"raw"`     // header value as written, empty when missing
+}
+
+// ParseMediaType parses a Content-Type value, repairing the malformed ones
+// when possible. An empty value gives the default of RFC 2045 section 5.2,
+// text/plain with the us-ascii charset. When the value can't be parsed the
+// error is returned along with the type found before the first semicolon.
+func ParseMediaType(v string) (MediaType, error) {
+	ct := v
+	if strings.TrimSpace(ct) == "" {
+		ct = "text/plain; charset=us-ascii"
+	}
+
+	mt, ps, err := mime.ParseMediaType(ct)
+	if err != nil {
+		var e error
+		if mt, ps, e = mime.ParseMediaType(repairContentType(ct)); e != nil {
+			mt, _, _ = strings.Cut(ct, ";")
+			mt, ps = strings.ToLower(strings.TrimSpace(mt)), map[string]string{}
+		} else {
+			err = nil
+		}
+	}
+
+	return newMediaType(mt, ps, v), err
+}
+
+// build the media type of an already parsed value
+func newMediaType(mt string, ps map[string]string, raw string) MediaType {
+	t, sub, _ := strings.Cut(mt, "/")
+	return MediaType{Type: t, Subtype: sub, Params: ps, Raw: raw}
+}
+
+// String gives the type and subtype, without parameters, like "text/plain"
+func (m MediaType) String() string {
+	if m.Subtype == "" {
+		return m.Type
+	}
+	return m.Type + "/" + m.Subtype
+}
+
+// Is checks the media type against a "type/subtype" pattern, which may end
+// with "/*" to match every subtype
+func (m MediaType) Is(pattern string) bool {
+	return mediaTypeMatches(m.String(), strings.ToLower(pattern))
+}
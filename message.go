@@ -2,109 +2,332 @@ package eml
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"mime/quotedprintable"
 	"net/textproto"
-	"regexp"
 	"strings"
 	"time"
 )
 
 type Message struct {
-	Headers []byte // full message headers
-	Body    []byte // message body separated from headers
+	Headers    []byte `json:"headers"`     // full message headers
+	Body       []byte `json:"body"`        // message body separated from headers
+	BodyOffset int    `json:"body_offset"` // position of the body at the parsed data
 
 	// from headers
-	ParsedHeaders map[string][]string // all headers
-
-	MessageID   string
-	Date        time.Time
-	Sender      Address
-	From        []Address
-	ReplyTo     []Address
-	To          []Address
-	Cc          []Address
-	Bcc         []Address
-	Subject     string
-	ContentType string
-	Comments    []string
-	Keywords    []string
-	InReply     []string
-	References  []string
+	ParsedHeaders map[string][]string `json:"parsed_headers"` // all headers
+
+	MessageID       string              `json:"message_id"`
+	Date            time.Time           `json:"date"`
+	Sender          Address             `json:"sender"`
+	From            []Address           `json:"from"`
+	ReplyTo         []Address           `json:"reply_to"`
+	To              []Address           `json:"to"`
+	Cc              []Address           `json:"cc"`
+	Bcc             []Address           `json:"bcc"`
+	ReadReceiptTo   []Address           `json:"read_receipt_to"`
+	Subject         string              `json:"subject"`
+	SubjectRaw      string              `json:"subject_raw"`      // as written at the header, with its encoded-words
+	ContentType     string              `json:"content_type"`     // Content-Type header value as written, see MediaType
+	ContentLanguage []string            `json:"content_language"` // normalized BCP 47 tags
+	AcceptLanguage  []string            `json:"accept_language"`  // normalized BCP 47 tags, the preferred first
+	MediaType       MediaType           `json:"media_type"`
+	Comments        []string            `json:"comments"`
+	HeaderComments  map[string][]string `json:"header_comments"` // comments of the structured headers, by lowercase name
+	Keywords        []string            `json:"keywords"`
+	InReply         []string            `json:"in_reply"`
+	References      []string            `json:"references"`
+	ARC             []ARCSet            `json:"arc"`
+	Envelope        Envelope            `json:"envelope"`
+	Resent          []ResentBlock       `json:"resent"`
+	Priority        Priority            `json:"priority"`
+	Received        []Received          `json:"received"` // the newest first, as found at the headers
+	ReceivedSPF     []ReceivedSPF       `json:"received_spf"`
+	Spam            *SpamInfo           `json:"spam"`               // nil without spam filter headers
+	Microsoft       *MicrosoftAntispam  `json:"microsoft_antispam"` // nil without Microsoft 365 filter headers
+	Autocrypt       []Autocrypt         `json:"autocrypt"`
+	AutocryptGossip []Autocrypt         `json:"autocrypt_gossip"` // keys of the other recipients
+	BIMI            *BIMI               `json:"bimi"`             // nil without brand indicator headers
 
 	// from body
-	Text        string
-	Html        string
-	Attachments []Attachment
-	Parts       []Part
+	Text        string       `json:"text"`
+	Html        string       `json:"html"`
+	Attachments []Attachment `json:"attachments"`
+	Contacts    []Contact    `json:"contacts"` // from the vCard parts
+	Parts       []Part       `json:"parts"`    // leaf parts of the MIME tree, in order
+	Root        Part         `json:"root"`     // MIME tree of the message
+
+	PolicyViolations []PolicyViolation `json:"policy_violations"` // see ParseOptions.Policy
+}
+
+// SMTP envelope information recorded by the delivery agents
+type Envelope struct {
+	ReturnPath   string   `json:"return_path"`  // empty for the null sender (<>)
+	DeliveredTo  []string `json:"delivered_to"` // one entry per delivery hop
+	OriginalTo   []string `json:"original_to"`
+	EnvelopeFrom string   `json:"envelope_from"`
 }
 
 type Attachment struct {
-	Filename string
-	Data     []byte
+	Filename     string `json:"filename"`
+	Data         []byte `json:"data"`
+	ContentType  string `json:"content_type"`  // declared media type
+	DetectedType string `json:"detected_type"` // sniffed media type, see ParseOptions.SniffTypes
+	ContentID    string `json:"content_id"`    // Content-ID without the angle brackets
+	Inline       bool   `json:"inline"`        // not marked as attachment, like the images shown by the HTML body
+	Skipped      bool   `json:"skipped"`       // not decoded, without Data, see ParseOptions.SkipTypes
+	SHA256       string `json:"sha256"`        // hex encoded hash of Data, see ParseOptions.HashAttachments
+
+	Metadata map[string]string `json:"metadata,omitempty"` // document properties, see ParseOptions.MetadataExtractors
+
+	YEnc         *YEncInfo `json:"yenc,omitempty"`          // set for the yEnc decoded files
+	ResourceFork []byte    `json:"resource_fork,omitempty"` // Mac resource fork sent at AppleDouble
+}
+
+// ParseOptions tunes the parser, the zero value gives the default lenient
+// behaviour used by Parse
+type ParseOptions struct {
+	// Strict reports and skips the content that breaks the RFCs instead of
+	// trying to make sense of it, like raw 8-bit data in the headers
+	Strict bool
+
+	// ObsoleteSyntax accepts on Strict mode the obsolete syntax of RFC 5322
+	// section 4 at the address and date headers, like the route addresses
+	// (<@relay:user@host>), the dotted display names (John Q. Public) and
+	// the two digits years, which the lenient mode always accepts
+	ObsoleteSyntax bool
+
+	// SkipTypes lists the media types of the parts which are never
+	// decoded, like "video/*" or "application/zip". Their parts are kept
+	// with the type, filename and position but without Data, and their
+	// attachments are listed as Skipped.
+	SkipTypes []string
+
+	// HashAttachments computes the SHA-256 of the attachments contents,
+	// see DedupAttachments and AttachmentStore
+	HashAttachments bool
+
+	// MetadataExtractors fill the Metadata of the attachments they match,
+	// like DefaultMetadataExtractors for the Office documents and PDFs
+	MetadataExtractors []MetadataExtractor
+
+	// Policy flags or strips the attachments breaking it, the violations
+	// being found at the message PolicyViolations
+	Policy *AttachmentPolicy
+
+	// OnAttachment is called with each attachment once decoded, before
+	// going on with the next part, like for streaming it to a malware
+	// scanner. A returned error stops the parsing, being reported at the
+	// message errors, while the flagging can be done by the hook itself.
+	OnAttachment func(meta AttachmentMeta, r io.Reader) error
+
+	// MaxDepth is the maximum nesting of multiparts, 50 when not positive.
+	// The deeper ones are kept as leaves and a *DepthError is reported.
+	MaxDepth int
+
+	// Location is used for the dates without zone information, UTC when nil
+	Location *time.Location
+
+	// Now is the clock used for the dates that can't be parsed, time.Now
+	// when nil
+	Now func() time.Time
+
+	// SniffTypes detects the real media type of the attachments declared
+	// as application/octet-stream or without type, from their contents
+	SniffTypes bool
+
+	// ExtractUUEncoded moves the uuencoded files ("begin 644 name" to
+	// "end" blocks) found at the plain text bodies to the attachments
+	ExtractUUEncoded bool
+
+	// ExtractYEnc decodes the yEnc files ("=ybegin" to "=yend" blocks)
+	// found at the plain text bodies and attachments
+	ExtractYEnc bool
+
+	// FetchExternal resolves the message/external-body references, their
+	// contents being added to the attachments
+	FetchExternal ExternalFetcher
+
+	// RecoverBoundaries looks for the delimiter lines actually used at the
+	// multipart bodies where the declared boundary is not found
+	RecoverBoundaries bool
+
+	// DotStuffed removes the SMTP dot-stuffing and the terminating line of
+	// the messages captured from SMTP sessions, like the ones extracted
+	// from network captures. The offsets are then relative to the unstuffed
+	// data, not to the passed one.
+	DotStuffed bool
+
+	// LineEndings normalizes the line endings before parsing, preserving
+	// them by default
+	LineEndings LineEndings
+
+	// TextSeparator joins the contents of the messages with several
+	// text/plain or text/html parts, like forwarded texts, a line break
+	// when empty
+	TextSeparator string
+
+	// context checked between the parsing steps, see ParseContext
+	ctx context.Context
+
+	// buffers reused between the messages, see Parser
+	scratch *parseScratch
+
+	// nesting of the multipart being parsed
+	depth int
+}
+
+func (o ParseOptions) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// check if the parts of a media type are not decoded
+func (o ParseOptions) skipType(t string) bool {
+	for _, s := range o.SkipTypes {
+		if mediaTypeMatches(t, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o ParseOptions) maxDepth() int {
+	if o.MaxDepth <= 0 {
+		return defaultMaxDepth
+	}
+	return o.MaxDepth
+}
+
+func (o ParseOptions) textSeparator() string {
+	if o.TextSeparator == "" {
+		return "\n"
+	}
+	return o.TextSeparator
+}
+
+// get the error of the parsing context, nil while it can go on
+func (o ParseOptions) canceled() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+func (o ParseOptions) now() time.Time {
+	if o.Now == nil {
+		return time.Now()
+	}
+	return o.Now()
 }
 
 func Parse(data []byte) (msg Message, errors []error) {
+	return ParseWithOptions(data, ParseOptions{})
+}
+
+func ParseWithOptions(data []byte, opts ParseOptions) (msg Message, errors []error) {
+	if opts.DotStuffed {
+		data = dotUnstuff(data)
+	}
+	if opts.LineEndings == NormalizeCRLF {
+		data = normalizeLineEndings(data)
+	}
 
 	// treat the raw data
-	raw, err := ParseRaw(data)
+	raw, err := parseRaw(data, opts.scratch.rawHeaders())
+	opts.scratch.keepRawHeaders(raw.RawHeaders)
 	if err != nil {
 		errors = append(errors, fmt.Errorf("raw parsing: %v", err))
 		return
 	}
 
 	// proccess the message headers and body parts
-	msg, errors = handleMessage(raw)
+	msg, errors = handleMessage(raw, opts)
 
 	// append the body and headers at the message
 	msg.Body = raw.Body
-	msg.Headers = extractHeaders(&raw.Body, &data)
+	msg.BodyOffset = raw.BodyOffset
+	msg.Headers = extractHeaders(data, raw.BodyOffset)
 
 	return
 }
 
 // extract the data from each header and parse the body contents
-func handleMessage(r RawMessage) (msg Message, errors []error) {
+func handleMessage(r RawMessage, opts ParseOptions) (msg Message, errors []error) {
 
 	// proccess and append the headers parameters
 	msg.ParsedHeaders = make(map[string][]string)
 	for _, rh := range r.RawHeaders {
 
 		// add this header to the parsed headers map
-		if _, ok := msg.ParsedHeaders[string(rh.Key)]; !ok {
-			msg.ParsedHeaders[string(rh.Key)] = []string{}
+		key := string(rh.Key)
+		msg.ParsedHeaders[key] = append(msg.ParsedHeaders[key], string(rh.Value))
+
+		// internationalized headers (RFC 6532) carry raw UTF-8, which
+		// plain RFC 5322 does not allow
+		if opts.Strict && hasNonASCII(rh.Value) {
+			errors = append(errors, fmt.Errorf("header parser: raw 8-bit data at %s header", rh.Key))
+			continue
 		}
 
-		msg.ParsedHeaders[string(rh.Key)] = append(msg.ParsedHeaders[string(rh.Key)], string(rh.Value))
+		// the obsolete syntax of the old messages is only accepted by the
+		// strict mode when asked
+		if opts.Strict && !opts.ObsoleteSyntax && hasObsoleteSyntax(key, rh.Value) {
+			errors = append(errors, fmt.Errorf("header parser: obsolete syntax at %s header", rh.Key))
+			continue
+		}
 
 		// handle key headers
 		var err error
 
-		switch strings.ToLower(string(rh.Key)) {
+		switch strings.ToLower(key) {
+		case `return-path`:
+			msg.Envelope.ReturnPath = envelopeAddress(rh.Value)
+		case `delivered-to`:
+			msg.Envelope.DeliveredTo = append(msg.Envelope.DeliveredTo, envelopeAddress(rh.Value))
+		case `x-original-to`:
+			msg.Envelope.OriginalTo = append(msg.Envelope.OriginalTo, envelopeAddress(rh.Value))
+		case `x-envelope-from`:
+			msg.Envelope.EnvelopeFrom = envelopeAddress(rh.Value)
 		case `content-type`:
+			msg.uncomment(key, rh.Value)
 			msg.ContentType = string(rh.Value)
 		case `message-id`:
-			v := bytes.TrimSpace(rh.Value)
-			v = bytes.Trim(rh.Value, `<>`)
-			msg.MessageID = string(v)
+			v := strings.TrimSpace(msg.uncomment(key, rh.Value))
+			msg.MessageID = strings.Trim(v, `<>`)
 		case `in-reply-to`:
-			ids := strings.Fields(string(rh.Value))
+			ids := strings.Fields(msg.uncomment(key, rh.Value))
 			for _, id := range ids {
 				msg.InReply = append(msg.InReply, strings.Trim(id, `<> `))
 			}
 		case `references`:
-			ids := strings.Fields(string(rh.Value))
+			ids := strings.Fields(msg.uncomment(key, rh.Value))
 			for _, id := range ids {
 				msg.References = append(msg.References, strings.Trim(id, `<> `))
 			}
+		case `content-language`:
+			msg.ContentLanguage, err = ParseLanguageTags(string(rh.Value))
+		case `accept-language`:
+			msg.AcceptLanguage, err = ParseAcceptLanguage(string(rh.Value))
+		case `mime-version`:
+			msg.uncomment(key, rh.Value)
 		case `date`:
-			msg.Date = ParseDate(string(rh.Value))
+			msg.uncomment(key, rh.Value)
+			msg.Date, err = parseDate(string(rh.Value), opts.location())
+			if err != nil {
+				msg.Date = opts.now()
+			}
 		case `from`:
 			msg.From, err = parseAddressList(rh.Value)
 		case `sender`:
 			msg.Sender, err = ParseAddress(rh.Value)
+			if err != nil {
+				msg.Sender = RawAddress{raw: string(bytes.TrimSpace(rh.Value))}
+			}
 		case `reply-to`:
 			msg.ReplyTo, err = parseAddressList(rh.Value)
 		case `to`:
@@ -113,14 +336,42 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 			msg.Cc, err = parseAddressList(rh.Value)
 		case `bcc`:
 			msg.Bcc, err = parseAddressList(rh.Value)
+		case `disposition-notification-to`, `return-receipt-to`:
+			var al []Address
+			al, err = parseAddressList(rh.Value)
+			msg.ReadReceiptTo = append(msg.ReadReceiptTo, al...)
 		case `subject`:
 			subject, e := Decode(rh.Value)
 			err = e
 			msg.Subject = string(subject)
+			msg.SubjectRaw = string(rh.Value)
+		case `received`:
+			var rcv Received
+			rcv, err = ParseReceived(rh.Value)
+			msg.Received = append(msg.Received, rcv)
+		case `received-spf`:
+			var spf ReceivedSPF
+			spf, err = ParseReceivedSPF(rh.Value)
+			if err == nil {
+				msg.ReceivedSPF = append(msg.ReceivedSPF, spf)
+			}
+		case `autocrypt`:
+			var ac Autocrypt
+			ac, err = ParseAutocrypt(rh.Value)
+			if err == nil {
+				msg.Autocrypt = append(msg.Autocrypt, ac)
+			}
+		case `autocrypt-gossip`:
+			var ac Autocrypt
+			ac, err = ParseAutocrypt(rh.Value)
+			if err == nil {
+				ac.PreferEncrypt = ""
+				msg.AutocryptGossip = append(msg.AutocryptGossip, ac)
+			}
 		case `comments`:
 			msg.Comments = append(msg.Comments, string(rh.Value))
 		case `keywords`:
-			ks := strings.Split(string(rh.Value), ",")
+			ks := strings.Split(msg.uncomment(key, rh.Value), ",")
 			for _, k := range ks {
 				msg.Keywords = append(msg.Keywords, strings.TrimSpace(k))
 			}
@@ -132,97 +383,354 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 		}
 	}
 
+	// the unique headers found more than once are ambiguous
+	if opts.Strict {
+		for _, e := range duplicateHeaders(r.RawHeaders) {
+			errors = append(errors, fmt.Errorf("header parser: %w", e))
+		}
+	}
+
+	// group the ARC headers into their sets
+	arc, err := parseARCHeaders(r.RawHeaders)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("header parser: %v", err))
+	}
+	msg.ARC = arc
+
+	// group the redistribution headers
+	resent, errs := parseResentBlocks(r.RawHeaders, opts)
+	errors = append(errors, errs...)
+	msg.Resent = resent
+
+	msg.Priority = messagePriority(r.RawHeaders)
+	msg.Spam = parseSpamHeaders(r.RawHeaders)
+	msg.Microsoft = parseMicrosoftAntispam(r.RawHeaders)
+
+	msg.BIMI, err = parseBIMIHeaders(r.RawHeaders)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("header parser: %v", err))
+	}
+
+	if e := opts.canceled(); e != nil {
+		errors = append(errors, fmt.Errorf("header parser: %w", e))
+		return
+	}
+
 	// if no sender header was found, use the first value of From
 	if msg.Sender == nil && len(msg.From) > 0 {
 		msg.Sender = msg.From[0]
 	}
 
-	// do the body parsing
-	if msg.ContentType != `` {
+	// the messages without Content-Type are plain text (RFC 2045 section
+	// 5.2)
+	ct := msg.ContentType
+	if ct == `` {
+		ct = "text/plain; charset=us-ascii"
+	}
 
-		// try to parse the body contents with the passed content type
-		parts, e := parseBody(msg.ContentType, r.Body, textproto.MIMEHeader{})
-		if e != nil {
-			msg.Text = string(r.Body) // set the whole message body as the message text
-			errors = append(errors, fmt.Errorf("body parser: %v", e))
+	// try to parse the body contents with the passed content type
+	// the message headers are the ones of a single part body
+	mh := textproto.MIMEHeader{}
+	for _, rh := range r.RawHeaders {
+		mh.Add(string(rh.Key), string(rh.Value))
+	}
+
+	root, e := parseBody(ct, r.Body, mh, r.BodyOffset, opts)
+	if c := opts.canceled(); c != nil {
+		errors = append(errors, fmt.Errorf("body parser: %w", c))
+		return
+	}
+	msg.MediaType = root.MediaType
+	if _, ok := e.(*DepthError); ok {
+		// the tree is kept up to the depth limit
+		errors = append(errors, fmt.Errorf("body parser: %w", e))
+	} else if e != nil {
+		msg.Text = string(r.Body) // set the whole message body as the message text
+		msg.MediaType, _ = ParseMediaType(msg.ContentType)
+		errors = append(errors, fmt.Errorf("body parser: %v", e))
+		return
+	}
+
+	// the empty multiparts have no leaf to hold their contents
+	root.walkEmpty(func(p *Part) {
+		errors = append(errors, fmt.Errorf("body parser: %s at offset %d: %w", p.Type, p.Offset, ErrEmptyMultipart))
+	})
+
+	// handle each message part
+	parts := root.leaves()
+
+	// the AppleDouble header applies to the data fork at the next part
+	var apple *appleFile
+	appleIndex := -1
+
+	// attachments already given to the policy and the OnAttachment hook
+	checked := 0
+
+	// contents of the text parts, in order
+	texts, htmls := opts.scratch.texts()
+	defer func() { opts.scratch.keepTexts(texts, htmls) }()
+
+	for k, part := range parts {
+		if c := opts.canceled(); c != nil {
+			errors = append(errors, fmt.Errorf("body parser: %w", c))
 			return
 		}
 
-		// handle each message part
-		for k, part := range parts {
-			switch {
-			case strings.Contains(part.Type, "text/plain"):
-				part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
-				if e != nil {
-					errors = append(errors, e)
+		if part.TransferEncoding == "" {
+			parts[k].TransferEncoding = "7bit"
+		}
+
+		// the uninteresting types are only indexed
+		if opts.skipType(part.Type) {
+			parts[k].Data, parts[k].Skipped = nil, true
+			if a, ok := parts[k].attachment(); ok {
+				a.Skipped = true
+				msg.Attachments = append(msg.Attachments, a)
+			}
+			continue
+		}
+
+		switch {
+		case strings.Contains(part.Type, "text/plain"):
+			part.Data, parts[k].TransferEncoding, e = decodeContentTransferEncoding(part.Headers, &part.Data, opts.Strict)
+			if e != nil {
+				errors = append(errors, e)
+			}
+
+			if data, e := UTF8(part.Charset, part.Data); e == nil {
+				part.Data = data
+			}
+			parts[k].Data = part.Data
+			text := string(part.Data)
+
+			// move the uuencoded files out of the text
+			if opts.ExtractUUEncoded {
+				t, atts, errs := extractUUEncoded(text, opts)
+				if len(atts) > 0 {
+					text = t
+					parts[k].Data = []byte(text)
+					msg.Attachments = append(msg.Attachments, atts...)
 				}
+				errors = append(errors, errs...)
+			}
 
-				data, e := UTF8(part.Charset, part.Data)
-				if e != nil {
-					msg.Text = string(part.Data)
-				} else {
-					msg.Text = string(data)
-					parts[k].Data = data
+			if opts.ExtractYEnc {
+				t, atts, errs := extractYEnc(text, opts)
+				if len(atts) > 0 {
+					text = t
+					parts[k].Data = []byte(text)
+					msg.Attachments = append(msg.Attachments, atts...)
 				}
+				errors = append(errors, errs...)
+			}
 
-				//
-			case strings.Contains(part.Type, "text/html"):
-				part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
-				if e != nil {
-					errors = append(errors, e)
+			texts = append(texts, text)
+
+			//
+		case strings.Contains(part.Type, "text/html"):
+			part.Data, parts[k].TransferEncoding, e = decodeContentTransferEncoding(part.Headers, &part.Data, opts.Strict)
+			if e != nil {
+				errors = append(errors, e)
+			}
+
+			if data, e := UTF8(part.Charset, part.Data); e == nil {
+				part.Data = data
+			}
+			parts[k].Data = part.Data
+			htmls = append(htmls, string(part.Data))
+
+			//
+		case part.External != nil:
+			if opts.FetchExternal == nil {
+				break
+			}
+
+			data, e := opts.FetchExternal(*part.External)
+			if e != nil {
+				errors = append(errors, fmt.Errorf("body parser: failed fetch external body [msg: %v]", e))
+				break
+			}
+
+			parts[k].Data = data
+			msg.Attachments = append(msg.Attachments, Attachment{
+				Filename:    part.External.filename(),
+				Data:        data,
+				ContentType: part.External.ContentType,
+			})
+
+			//
+		case strings.Contains(part.Type, "application/applefile"):
+			part.Data, parts[k].TransferEncoding, e = decodeContentTransferEncoding(part.Headers, &part.Data, opts.Strict)
+			if e != nil {
+				errors = append(errors, e)
+			}
+			parts[k].Data = part.Data
+
+			af, e := parseAppleFile(part.Data)
+			if e != nil {
+				errors = append(errors, fmt.Errorf("body parser: %v", e))
+				break
+			}
+
+			if af.double {
+				apple, appleIndex = &af, k
+				break
+			}
+
+			// AppleSingle files carry the data fork themselves
+			name := af.name
+			if name == "" {
+				name = part.Filename
+			}
+			msg.Attachments = append(msg.Attachments, Attachment{Filename: name, Data: af.data, ResourceFork: af.resource})
+
+			//
+		case isVCardType(part.Type):
+			data, _, e := decodeContentTransferEncoding(part.Headers, &part.Data, opts.Strict)
+			if e == nil {
+				if d, e := UTF8(part.Charset, data); e == nil {
+					data = d
 				}
 
-				data, e := UTF8(part.Charset, part.Data)
+				contacts, e := ParseVCard(data)
 				if e != nil {
-					msg.Html = string(part.Data)
-				} else {
-					msg.Html = string(data)
-					parts[k].Data = data
+					errors = append(errors, fmt.Errorf("body parser: %v", e))
 				}
+				msg.Contacts = append(msg.Contacts, contacts...)
+			}
 
-				//
-			default:
-				if cd, ok := part.Headers["Content-Disposition"]; ok {
-					if strings.Contains(cd[0], "attachment") {
-						filename := regexp.MustCompile("(?msi)name=\"(.*?)\"").FindStringSubmatch(cd[0]) //.FindString(cd[0])
-						if len(filename) < 2 {
-							errors = append(errors, fmt.Errorf("body parser: failed get filename from header Content-Disposition"))
-							break
-						}
-
-						dfilename, e := Decode([]byte(filename[1]))
-						if e != nil {
-							errors = append(errors, fmt.Errorf("body parser: failed decode filename of attachment [msg: %v]", e))
-						} else {
-							filename[1] = string(dfilename)
-						}
-
-						part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
-						if e != nil {
-							errors = append(errors, e)
-						}
-
-						msg.Attachments = append(msg.Attachments, Attachment{filename[1], part.Data})
+			// the vCard files are still kept as attachments
+			fallthrough
+
+			//
+		default:
+			// every leaf is decoded, the attachments or not
+			part.Data, parts[k].TransferEncoding, e = decodeContentTransferEncoding(part.Headers, &part.Data, opts.Strict)
+			if e != nil {
+				errors = append(errors, e)
+			}
+			parts[k].Data = part.Data
+
+			// the data fork of an AppleDouble is always an attachment
+			forked := apple != nil && appleIndex == k-1
+			if forked {
+				part.Disposition = "attachment"
+				if part.Filename == "" {
+					part.Filename = apple.name
+				}
+			}
+
+			// inline parts are attachments too when they are files, either
+			// named or referenced by the HTML body
+			if part.Disposition == "attachment" || part.Filename != "" || part.ContentID != "" {
+				a := Attachment{
+					Filename:    part.Filename,
+					Data:        part.Data,
+					ContentType: part.Type,
+					ContentID:   part.ContentID,
+					Inline:      part.Disposition != "attachment",
+				}
+
+				// attachments sent as yEnc blocks
+				if opts.ExtractYEnc && bytes.HasPrefix(bytes.TrimSpace(part.Data), []byte("=ybegin ")) {
+					_, atts, errs := extractYEnc(string(bytes.TrimSpace(part.Data)), ParseOptions{})
+					if len(atts) == 1 {
+						a.Data, a.YEnc = atts[0].Data, atts[0].YEnc
 					}
+					errors = append(errors, errs...)
+				}
+
+				parts[k].Data = a.Data
+				if forked {
+					a.ResourceFork = apple.resource
 				}
+				if opts.SniffTypes && isGenericType(part.Type) {
+					a.DetectedType = DetectContentType(a.Data)
+				}
+
+				msg.Attachments = append(msg.Attachments, a)
 			}
 		}
 
-		msg.Parts = parts
-		msg.ContentType = parts[0].Type
-		msg.Text = string(parts[0].Data)
-	} else {
-		msg.Text = string(r.Body)
+		// the new attachments go through the metadata extractors, the
+		// policy and the hook before the next part
+		if len(opts.MetadataExtractors) > 0 {
+			for _, e := range extractMetadata(opts.MetadataExtractors, msg.Attachments[checked:]) {
+				errors = append(errors, fmt.Errorf("body parser: %w", e))
+			}
+		}
+		if opts.Policy != nil {
+			kept, found := opts.Policy.apply(msg.Attachments[checked:])
+			msg.Attachments = append(msg.Attachments[:checked], kept...)
+			msg.PolicyViolations = append(msg.PolicyViolations, found...)
+		}
+		if opts.OnAttachment != nil {
+			if err := opts.hookAttachments(msg.Attachments[checked:], k); err != nil {
+				errors = append(errors, fmt.Errorf("body parser: %w", err))
+				return
+			}
+		}
+		checked = len(msg.Attachments)
 	}
 
+	// keep the tree in sync with the decoded parts
+	i := 0
+	root.setLeaves(parts, &i)
+
+	msg.Root = root
+	msg.Parts = parts
+
+	if opts.HashAttachments {
+		for i, a := range msg.Attachments {
+			msg.Attachments[i].SHA256 = attachmentHash(a)
+		}
+	}
+
+	msg.Text = strings.Join(texts, opts.textSeparator())
+	msg.Html = strings.Join(htmls, opts.textSeparator())
+
 	return
 }
 
-// get the headers from the full message and sanitize its suffix
-func extractHeaders(body *[]byte, data *[]byte) []byte {
+// remove the comments of a structured header value, keeping them at the
+// HeaderComments
+func (msg *Message) uncomment(key string, v []byte) string {
+	s, comments := splitComments(string(unfold(v)))
+	if len(comments) > 0 {
+		if msg.HeaderComments == nil {
+			msg.HeaderComments = make(map[string][]string)
+		}
+		k := strings.ToLower(key)
+		msg.HeaderComments[k] = append(msg.HeaderComments[k], comments...)
+	}
+	return s
+}
+
+// check if the value has any byte out of the ASCII range
+func hasNonASCII(v []byte) bool {
+	for _, b := range v {
+		if b >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
 
-	// replace the body from the full message to get just the headers
-	headers := bytes.Replace(*data, *body, nil, 1)
+// strip the angle brackets and spaces around an envelope address
+func envelopeAddress(v []byte) string {
+	return strings.Trim(string(bytes.TrimSpace(v)), `<> `)
+}
+
+// get the headers from the full message, up to the body position found by
+// the raw parser, and sanitize its suffix
+func extractHeaders(data []byte, bodyOffset int) []byte {
+	if bodyOffset < 0 || bodyOffset > len(data) {
+		return nil
+	}
+
+	// the headers are a slice of the data, limited to their length so
+	// appending to them can't overwrite the body
+	headers := data[:bodyOffset:bodyOffset]
 
 	// define a list of CF + LF variations at the headers end
 	trimOut := [][]byte{
@@ -242,31 +750,166 @@ func extractHeaders(body *[]byte, data *[]byte) []byte {
 	return headers
 }
 
-// generic function to handle content encoding
-func decodeContentTransferEncoding(msgHeaders, partHeaders map[string][]string, toDecode *[]byte) (decoded []byte, err error) {
+// generic function to handle content encoding, returning the effective
+// encoding. The identity encodings (7bit, 8bit and binary) are passed
+// through, being validated at strict mode.
+func decodeContentTransferEncoding(partHeaders map[string][]string, toDecode *[]byte, strict bool) (decoded []byte, encoding string, err error) {
 	decoded = *toDecode
 
-	// read the encoding from the part headers
-	// if it does not exists in that map, use the message headers
-	encoding := ""
+	// read the encoding from the part headers only, it's not inherited
+	// across the multipart boundaries (RFC 2045 section 6.4), and the
+	// headers of single part bodies are the message ones
+	if headerEncoding := partHeaders["Content-Transfer-Encoding"]; len(headerEncoding) > 0 {
+		encoding = strings.ToLower(strings.TrimSpace(stripComments(headerEncoding[0])))
+	}
 
-	if headerEncoding, ok := partHeaders["Content-Transfer-Encoding"]; ok {
-		encoding = strings.ToLower(headerEncoding[0])
-	} else {
-		if headerEncoding, ok := msgHeaders["Content-Transfer-Encoding"]; ok {
-			encoding = strings.ToLower(headerEncoding[0])
-		}
+	// the default encoding (RFC 2045 section 6.1)
+	if encoding == "" {
+		encoding = "7bit"
 	}
 
 	// parse the transfer encoding
-	switch strings.ToLower(encoding) {
+	switch encoding {
 	case "base64":
-		decoded, err = base64.StdEncoding.DecodeString(string(*toDecode))
+		decoded, err = decodeBase64(*toDecode)
 		if err != nil {
-			return decoded, fmt.Errorf("body parser: failed decode base64 [msg: %v]", err)
+			return decoded, encoding, fmt.Errorf("body parser: failed decode base64 [msg: %v]", err)
 		}
 	case "quoted-printable":
-		decoded, _ = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(*toDecode)))
+		var invalid int
+		decoded, invalid = decodeQuotedPrintable(*toDecode)
+		if invalid > 0 {
+			return decoded, encoding, fmt.Errorf("body parser: %d invalid quoted-printable escapes kept as they are", invalid)
+		}
+	case "7bit", "8bit":
+		if strict {
+			err = validateIdentityEncoding(decoded, encoding == "7bit")
+		}
+	case "binary":
+	default:
+		if strict {
+			err = fmt.Errorf("body parser: unknown transfer encoding %q", encoding)
+		}
+	}
+
+	return
+}
+
+// check that the data fits the 7bit or 8bit encodings: lines of up to 998
+// octets and no NUL bytes, besides only ASCII for 7bit
+func validateIdentityEncoding(data []byte, sevenBit bool) error {
+	n := 0
+	for _, c := range data {
+		switch {
+		case c == 0:
+			return fmt.Errorf("body parser: NUL byte at an identity encoded part")
+		case c >= 0x80 && sevenBit:
+			return fmt.Errorf("body parser: 8-bit data at a 7bit part")
+		case c == '\n':
+			n = 0
+			continue
+		case c == '\r':
+			continue
+		}
+
+		if n++; n > maxBodyLineLen {
+			return fmt.Errorf("body parser: line longer than %d octets", maxBodyLineLen)
+		}
+	}
+
+	return nil
+}
+
+// decode base64 data leniently: the whitespace is ignored, the padding is
+// optional, the URL safe alphabet is accepted, concatenated padded chunks
+// are decoded one after another and, on corrupted data, the decodable
+// prefix is returned along with the error
+func decodeBase64(data []byte) (decoded []byte, err error) {
+	clean := make([]byte, 0, len(data))
+	for _, c := range data {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			clean = append(clean, c)
+		}
+	}
+
+	for len(clean) > 0 {
+		// each chunk ends at its padding
+		chunk := clean
+		if i := bytes.IndexByte(clean, '='); i >= 0 {
+			j := i
+			for j < len(clean) && clean[j] == '=' {
+				j++
+			}
+			chunk, clean = clean[:i], clean[j:]
+		} else {
+			clean = nil
+		}
+
+		enc := base64.RawStdEncoding
+		if bytes.ContainsAny(chunk, "-_") {
+			enc = base64.RawURLEncoding
+		}
+
+		d := make([]byte, enc.DecodedLen(len(chunk)))
+		n, e := enc.Decode(d, chunk)
+		if e != nil {
+			// keep the whole groups before the corruption
+			if off, ok := e.(base64.CorruptInputError); ok {
+				n, _ = enc.Decode(d, chunk[:int(off)/4*4])
+			}
+			return append(decoded, d[:n]...), e
+		}
+
+		decoded = append(decoded, d[:n]...)
+	}
+
+	return decoded, nil
+}
+
+// decode quoted-printable data leniently, passing through the invalid
+// escapes ("=G1", lone "=") instead of stopping at them, and returning how
+// many were found. The whitespace at the end of the lines, added by some
+// transports, is removed.
+func decodeQuotedPrintable(data []byte) (decoded []byte, invalid int) {
+	decoded = make([]byte, 0, len(data))
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			// drop the whitespace at the end of the lines
+			j := i
+			for j < len(data) && (data[j] == ' ' || data[j] == '\t') {
+				j++
+			}
+			if j < len(data) && data[j] != '\r' && data[j] != '\n' {
+				decoded = append(decoded, data[i:j]...)
+			}
+			i = j - 1
+		case c != '=':
+			decoded = append(decoded, c)
+		case i+2 < len(data) && isHex(data[i+1]) && isHex(data[i+2]):
+			decoded = append(decoded, unhex(data[i+1])<<4|unhex(data[i+2]))
+			i += 2
+		default:
+			// soft line break, maybe with whitespace before the line ending
+			j := i + 1
+			for j < len(data) && (data[j] == ' ' || data[j] == '\t') {
+				j++
+			}
+			switch {
+			case j == len(data):
+				i = j - 1
+			case data[j] == '\n':
+				i = j
+			case data[j] == '\r' && j+1 < len(data) && data[j+1] == '\n':
+				i = j + 1
+			default:
+				invalid++
+				decoded = append(decoded, c)
+			}
+		}
 	}
 
 	return
@@ -0,0 +1,147 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+// the Content-Transfer-Encoding of the message is not inherited by the
+// multipart children (RFC 2045 section 6.4)
+func TestTransferEncodingNotInherited(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		text     string
+		html     string
+		encoding []string // of the leaf parts
+	}{
+		{
+			name: "multipart with an encoding",
+			data: "Content-Type: multipart/alternative; boundary=\"XX\"\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"plain=20text\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>html</p>\r\n" +
+				"--XX--\r\n",
+			text:     "plain=20text",
+			html:     "<p>html</p>",
+			encoding: []string{"7bit", "7bit"},
+		},
+		{
+			name: "children with their own encoding",
+			data: "Content-Type: multipart/alternative; boundary=\"XX\"\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"cGxhaW4=\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"a=3Db\r\n" +
+				"--XX--\r\n",
+			text:     "plain",
+			html:     "a=3Db",
+			encoding: []string{"base64", "7bit"},
+		},
+		{
+			name: "nested multipart",
+			data: "Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"--XX\r\n" +
+				"Content-Type: multipart/alternative; boundary=\"YY\"\r\n" +
+				"\r\n" +
+				"--YY\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"a=3Db\r\n" +
+				"--YY--\r\n" +
+				"--XX--\r\n",
+			text:     "a=3Db",
+			encoding: []string{"7bit"},
+		},
+		{
+			name: "single part",
+			data: "Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"a=3Db\r\n",
+			text:     "a=b",
+			encoding: []string{"quoted-printable"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, errs := Parse([]byte(tt.data))
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			if got := strings.TrimSpace(msg.Text); got != tt.text {
+				t.Errorf("text = %q, want %q", got, tt.text)
+			}
+			if got := strings.TrimSpace(msg.Html); got != tt.html {
+				t.Errorf("html = %q, want %q", got, tt.html)
+			}
+
+			var encoding []string
+			for _, p := range msg.Parts {
+				encoding = append(encoding, p.TransferEncoding)
+			}
+			if strings.Join(encoding, " ") != strings.Join(tt.encoding, " ") {
+				t.Errorf("encodings = %q, want %q", encoding, tt.encoding)
+			}
+		})
+	}
+}
+
+// the data of every leaf is decoded, not only the one of the attachments
+func TestLeafDataDecoded(t *testing.T) {
+	data := "Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+		"\r\n" +
+		"--XX\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"body\r\n" +
+		"--XX\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"aGVs\r\n" +
+		"bG8=\r\n" +
+		"--XX\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"a=3Db\r\n" +
+		"--XX--\r\n"
+
+	msg, errs := Parse([]byte(data))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(msg.Attachments) != 0 {
+		t.Errorf("got %d attachments", len(msg.Attachments))
+	}
+
+	want := []string{"body", "hello", "a=b"}
+	if len(msg.Parts) != len(want) {
+		t.Fatalf("got %d parts", len(msg.Parts))
+	}
+	for i, p := range msg.Parts {
+		if got := strings.TrimSpace(string(p.Data)); got != want[i] {
+			t.Errorf("part %d data = %q, want %q", i, got, want[i])
+		}
+	}
+}
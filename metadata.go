@@ -0,0 +1,241 @@
+// Metadata extraction from the attachments, like Office documents and PDFs.
+
+package eml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// MetadataExtractor pulls the metadata of the attachments of the types it
+// knows, see ParseOptions.MetadataExtractors. The keys are lowercase, like
+// "author", "creator_tool" or "macros".
+type MetadataExtractor interface {
+	// Match tells if the extractor knows the attachment
+	Match(a Attachment) bool
+
+	// Extract reads the metadata of a matched attachment
+	Extract(a Attachment) (map[string]string, error)
+}
+
+// DefaultMetadataExtractors gives the extractors of the Office documents
+// and the PDFs
+func DefaultMetadataExtractors() []MetadataExtractor {
+	return []MetadataExtractor{OfficeExtractor{}, PDFExtractor{}}
+}
+
+// run the extractors matching each attachment, merging their results
+func extractMetadata(extractors []MetadataExtractor, atts []Attachment) (errs []error) {
+	for i, a := range atts {
+		if a.Skipped {
+			continue
+		}
+
+		for _, x := range extractors {
+			if !x.Match(a) {
+				continue
+			}
+
+			md, err := x.Extract(a)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("metadata of %q: %w", a.Filename, err))
+				continue
+			}
+
+			for k, v := range md {
+				if atts[i].Metadata == nil {
+					atts[i].Metadata = make(map[string]string)
+				}
+				atts[i].Metadata[k] = v
+			}
+		}
+	}
+	return
+}
+
+// get the detected type of an attachment, sniffing it when missing
+func attachmentType(a Attachment) string {
+	if a.DetectedType != "" {
+		return a.DetectedType
+	}
+	return DetectContentType(a.Data)
+}
+
+// OfficeExtractor reads the document properties of the Office Open XML
+// files (docx, xlsx, pptx and their macro enabled versions), and the
+// macros flag of the older OLE ones (doc, xls, ppt)
+type OfficeExtractor struct{}
+
+func (OfficeExtractor) Match(a Attachment) bool {
+	t := attachmentType(a)
+	return strings.HasPrefix(t, "application/vnd.openxmlformats-officedocument.") || t == "application/x-ole-storage"
+}
+
+// properties of docProps/core.xml and docProps/app.xml, by local name
+var officeProperties = map[string]string{
+	"creator":        "author",
+	"lastModifiedBy": "last_modified_by",
+	"title":          "title",
+	"subject":        "subject",
+	"created":        "created",
+	"modified":       "modified",
+	"Application":    "creator_tool",
+	"AppVersion":     "creator_tool_version",
+	"Company":        "company",
+}
+
+func (OfficeExtractor) Extract(a Attachment) (map[string]string, error) {
+	t := attachmentType(a)
+	md := map[string]string{"macros": strconv.FormatBool(hasMacros(a.Data, t))}
+	if t == "application/x-ole-storage" {
+		return md, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(a.Data), int64(len(a.Data)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "docProps/core.xml" && f.Name != "docProps/app.xml" {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = readXMLProperties(io.LimitReader(r, 1<<20), md)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return md, nil
+}
+
+// read the text of the known elements of a properties document
+func readXMLProperties(r io.Reader, md map[string]string) error {
+	d := xml.NewDecoder(r)
+	key := ""
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			key = officeProperties[tok.Name.Local]
+		case xml.CharData:
+			if v := strings.TrimSpace(string(tok)); key != "" && v != "" {
+				md[key] = v
+			}
+		case xml.EndElement:
+			key = ""
+		}
+	}
+}
+
+// PDFExtractor reads the document information dictionary of the PDFs,
+// when it is not inside a compressed object stream
+type PDFExtractor struct{}
+
+func (PDFExtractor) Match(a Attachment) bool {
+	return attachmentType(a) == "application/pdf"
+}
+
+// keys of the document information dictionary
+var pdfProperties = map[string]string{
+	"Author":       "author",
+	"Creator":      "creator_tool",
+	"Producer":     "producer",
+	"Title":        "title",
+	"Subject":      "subject",
+	"CreationDate": "created",
+	"ModDate":      "modified",
+}
+
+var pdfInfoR = regexp.MustCompile(`/(Author|Creator|Producer|Title|Subject|CreationDate|ModDate)\s*(\((?:[^()\\]|\\.|\((?:[^()\\]|\\.)*\))*\)|<[0-9A-Fa-f\s]*>)`)
+
+func (PDFExtractor) Extract(a Attachment) (map[string]string, error) {
+	md := map[string]string{}
+
+	// the last values win, like the updates appended to the file
+	for _, m := range pdfInfoR.FindAllSubmatch(a.Data, -1) {
+		if v := strings.TrimSpace(pdfString(m[2])); v != "" {
+			md[pdfProperties[string(m[1])]] = v
+		}
+	}
+
+	// the JavaScript actions are the macros of the PDFs
+	md["macros"] = strconv.FormatBool(bytes.Contains(a.Data, []byte("/JavaScript")) || bytes.Contains(a.Data, []byte("/JS")))
+
+	return md, nil
+}
+
+var pdfEscapes = map[byte]byte{'n': '\n', 'r': '\r', 't': '\t', 'b': '\b', 'f': '\f', '(': '(', ')': ')', '\\': '\\'}
+
+// decode a PDF literal (between parentheses) or hexadecimal (between
+// angle brackets) string, in PDFDocEncoding or UTF-16BE with a BOM
+func pdfString(s []byte) string {
+	var b []byte
+	if s[0] == '<' {
+		b, _ = hex.DecodeString(strings.Join(strings.Fields(string(s[1:len(s)-1])), ""))
+	} else {
+		s = s[1 : len(s)-1]
+		for i := 0; i < len(s); i++ {
+			if s[i] != '\\' || i+1 == len(s) {
+				b = append(b, s[i])
+				continue
+			}
+
+			i++
+			if c, ok := pdfEscapes[s[i]]; ok {
+				b = append(b, c)
+				continue
+			}
+
+			// octal escapes of up to three digits
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			if n, err := strconv.ParseUint(string(s[i:j]), 8, 8); err == nil {
+				b = append(b, byte(n))
+				i = j - 1
+			} else {
+				// the backslash of the unknown escapes is ignored
+				b = append(b, s[i])
+			}
+		}
+	}
+
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		u := make([]uint16, (len(b)-2)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[2+2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+
+	// PDFDocEncoding matches Latin-1 for the printable characters
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
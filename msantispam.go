@@ -0,0 +1,83 @@
+// Microsoft 365 (Exchange Online Protection) antispam headers parsing.
+
+package eml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MicrosoftAntispam is the verdict of the Microsoft 365 filters, from the
+// X-Forefront-Antispam-Report and X-Microsoft-Antispam headers
+type MicrosoftAntispam struct {
+	SCL       *int              `json:"scl"`       // spam confidence level, -1 for the bypassed messages, nil if missing
+	BCL       *int              `json:"bcl"`       // bulk complaint level, nil if missing
+	PCL       *int              `json:"pcl"`       // phishing confidence level, nil if missing
+	ClientIP  string            `json:"client_ip"` // CIP
+	Country   string            `json:"country"`   // CTRY, of the client IP
+	Language  string            `json:"language"`  // LANG, of the message
+	Verdict   string            `json:"verdict"`   // SFV, like "NSPM" (not spam), "SPM" or "SKN" (skipped)
+	Category  string            `json:"category"`  // CAT, like "NONE", "SPM", "PHSH" or "BULK"
+	Direction string            `json:"direction"` // DIR, "INB" or "OUT"
+	Helo      string            `json:"helo"`      // H, of the client
+	PTR       string            `json:"ptr"`       // of the client IP
+	Fields    map[string]string `json:"fields"`    // all the fields, by their uppercase key
+}
+
+// collect the Microsoft antispam fields, nil if none. The first headers,
+// added last, win over the later ones.
+func parseMicrosoftAntispam(headers []RawHeader) *MicrosoftAntispam {
+	fields := make(map[string]string)
+
+	for _, rh := range headers {
+		switch strings.ToLower(string(rh.Key)) {
+		case `x-forefront-antispam-report`, `x-microsoft-antispam`:
+		case `x-ms-exchange-organization-scl`:
+			if _, ok := fields["SCL"]; !ok {
+				fields["SCL"] = strings.TrimSpace(string(rh.Value))
+			}
+			continue
+		default:
+			continue
+		}
+
+		// packed KEY:value;KEY:value fields
+		for _, f := range strings.Split(string(unfold(rh.Value)), ";") {
+			k, v, ok := strings.Cut(f, ":")
+			k = strings.ToUpper(strings.TrimSpace(k))
+			if !ok || k == "" {
+				continue
+			}
+			if _, ok := fields[k]; !ok {
+				fields[k] = strings.TrimSpace(v)
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	level := func(k string) *int {
+		n, err := strconv.Atoi(fields[k])
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+
+	return &MicrosoftAntispam{
+		SCL:       level("SCL"),
+		BCL:       level("BCL"),
+		PCL:       level("PCL"),
+		ClientIP:  fields["CIP"],
+		Country:   fields["CTRY"],
+		Language:  fields["LANG"],
+		Verdict:   fields["SFV"],
+		Category:  fields["CAT"],
+		Direction: fields["DIR"],
+		Helo:      fields["H"],
+		PTR:       fields["PTR"],
+		Fields:    fields,
+	}
+}
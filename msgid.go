@@ -0,0 +1,107 @@
+// Message-ID (RFC 5322 section 3.6.4) generation and validation.
+
+package eml
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// lowercase base32 without padding, safe at the left part of the IDs
+var msgIDEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// GenerateMessageID builds a unique message ID for the domain, from the
+// time and 120 random bits. The host name is used when the domain is
+// empty, and the internationalized domains are converted to ASCII. Like
+// the MessageID field, the ID is returned without the angle brackets.
+func GenerateMessageID(domain string) (string, error) {
+	if domain == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("message id domain: %w", err)
+		}
+		domain = h
+	}
+
+	d, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", fmt.Errorf("message id domain: %w", err)
+	}
+
+	random := make([]byte, 15)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatInt(time.Now().UnixMilli(), 36) + "." + msgIDEncoding.EncodeToString(random) + "@" + d
+	if err := ValidateMessageID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ValidateMessageID checks the syntax of a message ID, with or without the
+// angle brackets: a dot-atom, an "@" and a dot-atom or a domain literal.
+// The obsolete forms, like the quoted left parts, are rejected.
+func ValidateMessageID(s string) error {
+	if strings.HasPrefix(s, "<") || strings.HasSuffix(s, ">") {
+		if len(s) < 2 || s[0] != '<' || s[len(s)-1] != '>' {
+			return errors.New("message id: unbalanced angle brackets")
+		}
+		s = s[1 : len(s)-1]
+	}
+
+	i := strings.LastIndexByte(s, '@')
+	if i < 0 {
+		return errors.New("message id: missing @")
+	}
+	left, right := s[:i], s[i+1:]
+
+	if !isDotAtom(left) {
+		return fmt.Errorf("message id: invalid left part %q", left)
+	}
+
+	if strings.HasPrefix(right, "[") {
+		if !strings.HasSuffix(right, "]") {
+			return fmt.Errorf("message id: invalid domain literal %q", right)
+		}
+		for j := 1; j < len(right)-1; j++ {
+			// dtext, printable ASCII but the brackets and backslash
+			if c := right[j]; c <= ' ' || c > '~' || c == '[' || c == ']' || c == '\\' {
+				return fmt.Errorf("message id: invalid domain literal %q", right)
+			}
+		}
+		return nil
+	}
+
+	if !isDotAtom(right) {
+		return fmt.Errorf("message id: invalid right part %q", right)
+	}
+	return nil
+}
+
+// check if the text is a dot-atom (RFC 5322 section 3.2.3)
+func isDotAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, a := range strings.Split(s, ".") {
+		if a == "" {
+			return false
+		}
+		for i := 0; i < len(a); i++ {
+			if !isAtext(a[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
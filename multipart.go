@@ -5,102 +5,498 @@ package eml
 import (
 	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"mime"
-	"mime/multipart"
-	"net/mail"
 	"net/textproto"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type Part struct {
-	Type    string
-	Charset string
-	Data    []byte
-	Headers map[string][]string
+	Type    string              `json:"type"`
+	Charset string              `json:"charset"`
+	Data    []byte              `json:"data"`
+	Headers map[string][]string `json:"headers"`
+
+	// from the part headers
+	MediaType        MediaType `json:"media_type"`        // parsed Content-Type
+	TransferEncoding string    `json:"transfer_encoding"` // lowercase Content-Transfer-Encoding
+	Disposition      string    `json:"disposition"`       // lowercase Content-Disposition type
+	Filename         string    `json:"filename"`          // decoded name from the disposition or type
+	ContentID        string    `json:"content_id"`        // Content-ID without the angle brackets
+	Language         []string  `json:"language"`          // normalized BCP 47 tags of the Content-Language
+	Size             int64     `json:"size"`              // size declared at the disposition, 0 if missing
+
+	// position of the raw (still encoded) part contents at the original
+	// message, while Data holds the decoded ones (the text parts converted
+	// to UTF-8), and of the part headers, the same as the contents for the
+	// root
+	Offset       int `json:"offset"`
+	Length       int `json:"length"`
+	HeaderOffset int `json:"header_offset"`
+
+	// Raw is the still encoded contents, a slice of the parsed data without
+	// copy, for the byte exact uses like signatures or hashes. It is nil
+	// at the Index parts and is not kept at the JSON, see Message.RawPart.
+	Raw []byte `json:"-"`
+
+	// the contents were not decoded, see ParseOptions.SkipTypes
+	Skipped bool `json:"skipped,omitempty"`
+
+	// the entries of a multipart, nil for the leaf parts
+	Children []Part `json:"children,omitempty"`
+
+	// reference of the message/external-body parts
+	External *ExternalBody `json:"external,omitempty"`
+
+	// text before the first and after the last parts of a multipart,
+	// nil when there's nothing but whitespace
+	Preamble []byte `json:"preamble,omitempty"`
+	Epilogue []byte `json:"epilogue,omitempty"`
+}
+
+// ErrEmptyMultipart is reported for the multipart bodies without any part,
+// which are kept at the tree without children
+var ErrEmptyMultipart = errors.New("multipart body without parts")
+
+// default maximum nesting of multiparts
+const defaultMaxDepth = 50
+
+// DepthError is reported when the multiparts are nested deeper than the
+// limit of ParseOptions.MaxDepth, the deeper ones being kept as leaves
+// with their raw contents
+type DepthError struct {
+	Limit  int // maximum nesting of multiparts
+	Offset int // position of the first multipart over the limit
+}
+
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("multipart nested deeper than %d levels at offset %d", e.Limit, e.Offset)
 }
 
-// Parse the body of a message, using the given content-type. If the content
-// type is multipart, the parts slice will contain an entry for each part
-// present; otherwise, it will contain a single entry, with the entire (raw)
-// message contents.
-func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (parts []Part, err error) {
+var (
+	filenameR = regexp.MustCompile(`(?msi)name\*?=\"?([^\";]*)`)
+	charsetR  = regexp.MustCompile("(?is)charset=(.*)")
+)
+
+// build a part filling the typed fields from its headers
+func newPart(ct, charset string, data []byte, headers map[string][]string) Part {
+	p := Part{
+		Type:    ct,
+		Charset: charset,
+		Data:    data,
+		Headers: headers,
+	}
+
+	// the type given may be a whole header value, which could not be
+	// parsed, or just the media type with the parameters apart
+	p.MediaType, _ = ParseMediaType(ct)
+
+	h := textproto.MIMEHeader(headers)
+	p.TransferEncoding = strings.ToLower(strings.TrimSpace(stripComments(h.Get("Content-Transfer-Encoding"))))
+	p.ContentID = strings.Trim(h.Get("Content-Id"), "<> ")
+	if cl := h.Get("Content-Language"); cl != "" {
+		p.Language, _ = ParseLanguageTags(cl)
+	}
+
+	// the filename is usually at the disposition, but some clients only
+	// set the content type name parameter
+	if cd := h.Get("Content-Disposition"); cd != "" {
+		d, ps, err := mime.ParseMediaType(cd)
+		if err == nil {
+			p.Disposition = d
+			p.Filename = ps["filename"]
+			p.Size, _ = strconv.ParseInt(ps["size"], 10, 64)
+		} else {
+			d, _, _ = strings.Cut(cd, ";")
+			p.Disposition = strings.ToLower(strings.TrimSpace(d))
+		}
+
+		if p.Filename == "" {
+			if m := filenameR.FindStringSubmatch(cd); len(m) > 1 {
+				p.Filename = m[1]
+			}
+		}
+	}
+
+	if p.Filename == "" {
+		if _, ps, err := mime.ParseMediaType(h.Get("Content-Type")); err == nil {
+			p.Filename = ps["name"]
+		}
+	}
+
+	if f, err := Decode([]byte(p.Filename)); err == nil {
+		p.Filename = string(f)
+	}
+
+	if strings.EqualFold(ct, "message/external-body") {
+		p.External = parseExternalBody(h.Get("Content-Type"), data)
+	}
+
+	return p
+}
+
+// Parse the body of a message, using the given content-type, into a tree of
+// parts. If the content type is multipart, the root will have an entry for
+// each part present; otherwise, it will be a single leaf with the entire
+// (raw) message contents. The offset is the position of the body at the original
+// message, used to locate each part.
+func parseBody(ct string, body []byte, ph textproto.MIMEHeader, offset int, opts ParseOptions) (root Part, err error) {
 	mt, ps, err := mime.ParseMediaType(ct)
 	if err != nil {
-		return
+		// try to make sense of a slightly broken value
+		if mt, ps, err = mime.ParseMediaType(repairContentType(ct)); err != nil {
+			return
+		}
 	}
 
 	boundary, ok := ps["boundary"]
+
+	// the nesting bombs stop at the depth limit
+	if ok && opts.depth >= opts.maxDepth() {
+		err, ok = &DepthError{Limit: opts.maxDepth(), Offset: offset}, false
+	}
+
 	if !ok {
-		if strings.HasPrefix(mt, "multipart") {
-			return nil, errors.New("multipart specified without boundary")
+		if strings.HasPrefix(mt, "multipart") && err == nil {
+			return root, errors.New("multipart specified without boundary")
+		}
+
+		// the part keeps its own copy of the headers map, the contents
+		// are a slice of the original data
+		headers := make(map[string][]string, len(ph))
+		for k, v := range ph {
+			headers[k] = v
 		}
 
-		// must add the CRLF at the body before calling the mail.readmessage
-		// otherwise the passed body will be interpreted as a header
-		r := strings.NewReader("\r\n" + string(body))
+		root = newPart(mt, ps["charset"], body, headers)
+		root.MediaType = newMediaType(mt, ps, ph.Get("Content-Type"))
+		root.Offset, root.Length, root.HeaderOffset = offset, len(body), offset
+		root.Raw = body[:len(body):len(body)]
+
+		return root, err
+	}
+
+	// the multipart entries are the branches of the tree
+	root = newPart(mt, ps["charset"], nil, ph)
+	root.MediaType = newMediaType(mt, ps, ph.Get("Content-Type"))
+	root.Offset, root.Length, root.HeaderOffset = offset, len(body), offset
+	root.Raw = body[:len(body):len(body)]
+	root.Children = []Part{}
 
-		m, err := mail.ReadMessage(r)
-		if err != nil {
-			return nil, err
+	bounds, preambleEnd, epilogueStart := splitMultipart(body, boundary)
+
+	// the declared boundary may be mangled or not the one used at the body
+	if len(bounds) == 0 && opts.RecoverBoundaries {
+		if b := detectBoundary(body, boundary); b != "" {
+			bounds, preambleEnd, epilogueStart = splitMultipart(body, b)
 		}
+	}
 
-		// generate the list of headers by joining the found headers
-		// with the priority to the textproto ones
-		headers := make(map[string][]string)
+	// some systems hide data around the parts
+	if len(bytes.TrimSpace(body[:preambleEnd])) > 0 {
+		root.Preamble = body[:preambleEnd]
+	}
+	if len(bytes.TrimSpace(body[epilogueStart:])) > 0 {
+		root.Epilogue = body[epilogueStart:]
+	}
 
-		for k, v := range m.Header {
-			headers[k] = v
+	for _, b := range bounds {
+		if e := opts.canceled(); e != nil {
+			return root, e
 		}
 
-		for k, v := range ph {
-			headers[k] = v
+		// split the part headers from its contents
+		raw, e := parseRaw(body[b[0]:b[1]], opts.scratch.partHeaders())
+		if e != nil {
+			raw.Body = nil
 		}
 
-		parts = append(parts, Part{
-			Type:    mt,
-			Charset: ps["charset"],
-			Data:    body,
-			Headers: headers,
-		})
+		header := textproto.MIMEHeader{}
+		for _, rh := range raw.RawHeaders {
+			header.Add(string(rh.Key), string(unfold(rh.Value)))
+		}
+		opts.scratch.keepPartHeaders(raw.RawHeaders)
 
-		return parts, err
-	}
+		start := b[1] - len(raw.Body)
 
-	r := multipart.NewReader(bytes.NewReader(body), boundary)
-	p, err := r.NextPart()
-	for err == nil {
-		// check if this multipart part is empty
-		if len(p.Header.Values("Content-Type")) == 0 {
-			p, err = r.NextPart()
+		// skip the empty parts, without headers or contents
+		if len(header) == 0 && len(bytes.TrimSpace(raw.Body)) == 0 {
 			continue
 		}
 
-		data, _ := io.ReadAll(p) // ignore error
-		var subparts []Part
-		subparts, err = parseBody(p.Header["Content-Type"][0], data, p.Header)
+		// the entries of a digest are messages by default (RFC 2046
+		// section 5.1.5), and plain text anywhere else (RFC 2045 section
+		// 5.2)
+		ct := header.Get("Content-Type")
+		if ct == "" {
+			ct = "text/plain; charset=us-ascii"
+			if mt == "multipart/digest" {
+				ct = "message/rfc822"
+			}
+		}
 
-		if err == nil {
-			parts = append(parts, subparts...)
-		} else {
-			contenttype := regexp.MustCompile("(?is)charset=(.*)").FindStringSubmatch(p.Header["Content-Type"][0])
+		data := raw.Body
+		opts.depth++
+		sub, e := parseBody(ct, data, header, offset+start, opts)
+		opts.depth--
+
+		// the part over the depth limit is already a leaf, the error goes
+		// up to the message
+		var de *DepthError
+		if errors.As(e, &de) {
+			if err == nil {
+				err = e
+			}
+			e = nil
+		}
+
+		if e != nil {
+			contenttype := charsetR.FindStringSubmatch(ct)
 			charset := "UTF-8"
 			if len(contenttype) > 1 {
 				charset = contenttype[1]
 			}
-			part := Part{p.Header["Content-Type"][0], charset, data, p.Header}
-			parts = append(parts, part)
+			sub = newPart(ct, charset, data, header)
+			sub.Offset, sub.Length = offset+start, len(data)
+			sub.Raw = data[:len(data):len(data)]
+		}
+
+		sub.HeaderOffset = offset + b[0]
+		root.Children = append(root.Children, sub)
+	}
+
+	return
+}
+
+// Message parses the message encapsulated at a message/rfc822 part, like
+// the entries of a digest
+func (p Part) Message() (Message, []error) {
+	return Parse(p.Data)
+}
+
+// RawPart gives a part of the message as it was found at the parsed data,
+// its headers included, without copy. The part of a single part body has
+// the message headers, so only its contents are given.
+func (msg Message) RawPart(p Part) []byte {
+	start, end := p.HeaderOffset-msg.BodyOffset, p.Offset+p.Length-msg.BodyOffset
+	if start < 0 || start > end || end > len(msg.Body) {
+		return nil
+	}
+	return msg.Body[start:end:end]
+}
+
+// get the leaf parts of the tree, in order
+func (p Part) leaves() (parts []Part) {
+	if p.Children == nil {
+		return []Part{p}
+	}
+
+	for _, c := range p.Children {
+		parts = append(parts, c.leaves()...)
+	}
+
+	return
+}
+
+// call fn for each multipart of the tree without children
+func (p *Part) walkEmpty(fn func(p *Part)) {
+	if p.Children != nil && len(p.Children) == 0 {
+		fn(p)
+	}
+	for k := range p.Children {
+		p.Children[k].walkEmpty(fn)
+	}
+}
+
+// replace the leaves of the tree, in order, by the given parts
+func (p *Part) setLeaves(parts []Part, i *int) {
+	if p.Children == nil {
+		if *i < len(parts) {
+			*p = parts[*i]
+			*i++
+		}
+		return
+	}
+
+	for k := range p.Children {
+		p.Children[k].setLeaves(parts, i)
+	}
+}
+
+// find the parts of a multipart body, returning the start and end offsets
+// of each one, headers included, the end of the preamble and the start of
+// the epilogue. The CRLF before a delimiter line belongs to the delimiter,
+// and a missing close delimiter ends the last part at the end of the body,
+// leaving no epilogue. Without delimiters the whole body is the preamble.
+func splitMultipart(body []byte, boundary string) (parts [][2]int, preambleEnd, epilogueStart int) {
+	delim := []byte("--" + boundary)
+	start := -1
+	preambleEnd, epilogueStart = len(body), len(body)
+
+	for pos := 0; pos < len(body); {
+		lineEnd := len(body)
+		if i := bytes.IndexByte(body[pos:], '\n'); i >= 0 {
+			lineEnd = pos + i + 1
+		}
+
+		line := body[pos:lineEnd]
+		if bytes.HasPrefix(line, delim) {
+			rest := bytes.TrimRight(line[len(delim):], " \t\r\n")
+			if len(rest) == 0 || string(rest) == "--" {
+				if start >= 0 {
+					parts = append(parts, [2]int{start, trimLineEnding(body, start, pos)})
+				} else {
+					preambleEnd = trimLineEnding(body, 0, pos)
+				}
+
+				// close delimiter
+				if len(rest) > 0 {
+					epilogueStart = lineEnd
+					return
+				}
+
+				start = lineEnd
+			}
 		}
 
-		p, err = r.NextPart()
+		pos = lineEnd
 	}
 
-	if err == io.EOF {
-		err = nil
-	} else if err.Error() == "multipart: NextPart: EOF" {
-		err = nil
+	if start >= 0 && start < len(body) {
+		parts = append(parts, [2]int{start, len(body)})
 	}
 
 	return
 }
+
+// find the boundary actually used at a multipart body, looking for the
+// delimiter lines: the declared boundary with another case or truncated is
+// preferred, otherwise the most repeated candidate
+func detectBoundary(body []byte, declared string) string {
+	counts := make(map[string]int)
+	var order []string
+
+	for _, l := range bytes.Split(body, []byte("\n")) {
+		l = bytes.TrimRight(l, " \t\r")
+		if !bytes.HasPrefix(l, []byte("--")) {
+			continue
+		}
+
+		b := string(bytes.TrimSuffix(l[2:], []byte("--")))
+		if b == "" || len(b) > 70 || strings.Trim(b, "-") == "" {
+			continue
+		}
+
+		if counts[b] == 0 {
+			order = append(order, b)
+		}
+		counts[b]++
+	}
+
+	for _, b := range order {
+		if strings.EqualFold(b, declared) {
+			return b
+		}
+	}
+
+	for _, b := range order {
+		if declared != "" && (strings.HasPrefix(b, declared) || strings.HasPrefix(declared, b)) {
+			return b
+		}
+	}
+
+	best := ""
+	for _, b := range order {
+		if counts[b] >= 2 && counts[b] > counts[best] {
+			best = b
+		}
+	}
+
+	return best
+}
+
+// move the end offset back over the line ending that precedes it
+func trimLineEnding(b []byte, start, end int) int {
+	if end > start && b[end-1] == '\n' {
+		end--
+	}
+	if end > start && b[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+// remove the line breaks of a folded header value, stray CRs included
+func unfold(v []byte) []byte {
+	if bytes.IndexAny(v, "\r\n") < 0 {
+		return v
+	}
+	v = bytes.ReplaceAll(v, []byte("\r"), nil)
+	return bytes.ReplaceAll(v, []byte("\n"), nil)
+}
+
+// SkipPart is returned by a WalkFunc to skip the children of the current
+// multipart part
+var SkipPart = errors.New("skip this part")
+
+// WalkFunc is called for each part visited by Walk, with the depth of the
+// part at the tree (0 for the root)
+type WalkFunc func(p *Part, depth int) error
+
+// Walk visits the parts of the MIME tree in depth-first order, parents
+// before their children. The parts can be changed in place. Messages
+// whose body could not be parsed have no tree to walk.
+func (msg *Message) Walk(fn WalkFunc) error {
+	if msg.Root.Type == "" {
+		return nil
+	}
+
+	err := walkPart(&msg.Root, 0, fn)
+	if err == SkipPart {
+		return nil
+	}
+	return err
+}
+
+func walkPart(p *Part, depth int, fn WalkFunc) error {
+	if err := fn(p, depth); err != nil {
+		return err
+	}
+
+	for k := range p.Children {
+		err := walkPart(&p.Children[k], depth+1, fn)
+		if err != nil && err != SkipPart {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PartsByType returns the parts of the MIME tree with the given media
+// type, which may be a "type/*" wildcard, in depth-first order
+func (msg Message) PartsByType(mediaType string) (parts []Part) {
+	mediaType = strings.ToLower(mediaType)
+
+	msg.Walk(func(p *Part, depth int) error {
+		if mediaTypeMatches(p.Type, mediaType) {
+			parts = append(parts, *p)
+		}
+		return nil
+	})
+
+	return
+}
+
+// check a part type, which may carry parameters, against a media type
+func mediaTypeMatches(t, mediaType string) bool {
+	t, _, _ = strings.Cut(t, ";")
+	t = strings.ToLower(strings.TrimSpace(t))
+
+	if prefix, ok := strings.CutSuffix(mediaType, "/*"); ok {
+		return strings.HasPrefix(t, prefix+"/")
+	}
+	return t == mediaType
+}
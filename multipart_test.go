@@ -0,0 +1,94 @@
+package eml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// build a message with the given number of nested multiparts, each one
+// with a text part after the nested one
+func nestingBomb(levels int) []byte {
+	var b strings.Builder
+	b.WriteString("From: a@example.com\r\nSubject: bomb\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=\"b0\"\r\n\r\n")
+
+	for i := 0; i < levels; i++ {
+		fmt.Fprintf(&b, "--b%d\r\n", i)
+		if i+1 < levels {
+			fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=\"b%d\"\r\n\r\n", i+1)
+		} else {
+			b.WriteString("Content-Type: text/plain\r\n\r\ninner\r\n")
+		}
+	}
+
+	for i := levels - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "--b%d\r\nContent-Type: text/plain\r\n\r\nsibling %d\r\n--b%d--\r\n", i, i, i)
+	}
+
+	return []byte(b.String())
+}
+
+func depthError(errs []error) *DepthError {
+	for _, err := range errs {
+		var de *DepthError
+		if errors.As(err, &de) {
+			return de
+		}
+	}
+	return nil
+}
+
+func TestNestingBomb(t *testing.T) {
+	tests := []struct {
+		levels   int
+		maxDepth int
+		limited  bool
+	}{
+		{levels: 10},
+		{levels: defaultMaxDepth},
+		{levels: defaultMaxDepth + 1, limited: true},
+		{levels: 120, limited: true},
+		{levels: 5000, limited: true},
+		{levels: 10, maxDepth: 5, limited: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d", tt.levels, tt.maxDepth), func(t *testing.T) {
+			msg, errs := ParseWithOptions(nestingBomb(tt.levels), ParseOptions{MaxDepth: tt.maxDepth})
+
+			de := depthError(errs)
+			if !tt.limited {
+				if de != nil {
+					t.Fatalf("unexpected depth error: %v", de)
+				}
+				return
+			}
+
+			if de == nil {
+				t.Fatalf("expected a depth error, got %v", errs)
+			}
+			limit := tt.maxDepth
+			if limit == 0 {
+				limit = defaultMaxDepth
+			}
+			if de.Limit != limit {
+				t.Errorf("limit = %d, want %d", de.Limit, limit)
+			}
+
+			// the tree is kept up to the limit, the siblings included
+			depth := 0
+			msg.Walk(func(p *Part, d int) error {
+				depth = max(depth, d)
+				return nil
+			})
+			if depth != limit {
+				t.Errorf("tree depth = %d, want %d", depth, limit)
+			}
+			if !strings.Contains(msg.Text, "sibling 0") {
+				t.Errorf("missing the outer sibling text")
+			}
+		})
+	}
+}
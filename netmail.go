@@ -0,0 +1,41 @@
+// Conversion to and from the net/mail types.
+
+package eml
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+)
+
+// ToNetMail converts a mailbox address to the net/mail type. The groups and
+// raw addresses have no equivalent, returning nil.
+func ToNetMail(a Address) *mail.Address {
+	ma, ok := a.(MailboxAddr)
+	if !ok {
+		return nil
+	}
+
+	return &mail.Address{Name: ma.name, Address: ma.Email()}
+}
+
+// FromNetMail converts a net/mail address to a mailbox address
+func FromNetMail(a *mail.Address) Address {
+	if a == nil {
+		return nil
+	}
+
+	ma := MailboxAddr{name: a.Name}
+	if i := strings.LastIndex(a.Address, "@"); i >= 0 {
+		ma.local, ma.domain = a.Address[:i], a.Address[i+1:]
+	} else {
+		ma.local = a.Address
+	}
+	return ma
+}
+
+// ToNetMailMessage builds the net/mail message of the original headers and
+// body, read by the standard library parser
+func (msg Message) ToNetMailMessage() (*mail.Message, error) {
+	return mail.ReadMessage(bytes.NewReader(msg.Raw()))
+}
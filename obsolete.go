@@ -0,0 +1,77 @@
+// Detection of the obsolete syntax of RFC 5322 section 4.
+
+package eml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// times with whitespace around the colons, only allowed by obs-time
+var obsTimeSpaceR = regexp.MustCompile(`\d\s+:|:\s+\d`)
+
+// check if the value of a header uses the obsolete syntax, which is parsed
+// anyway but is not allowed at the messages generated since RFC 2822
+func hasObsoleteSyntax(key string, v []byte) bool {
+	switch strings.ToLower(key) {
+	case `from`, `sender`, `reply-to`, `to`, `cc`, `bcc`:
+		return obsoleteAddress(v)
+	case `date`:
+		return obsoleteDate(string(v))
+	}
+	return false
+}
+
+// check for the route addresses, like <@relay:user@host>, and the dots out
+// of the dot-atoms, like at John Q. Public or "john".smith@host
+func obsoleteAddress(v []byte) bool {
+	ts, err := tokenize([]byte(stripComments(string(unfold(v)))))
+	if err != nil {
+		return false
+	}
+
+	for i, t := range ts {
+		var next token
+		if i+1 < len(ts) {
+			next = ts[i+1]
+		}
+
+		switch {
+		case string(t) == ".":
+			return true
+		case string(t) == "<" && string(next) == "@":
+			return true
+
+		// a dotted word followed by another word or an angle address
+		// belongs to a display name
+		case t[0] != '"' && t[0] != '[' && strings.Contains(string(t), ".") && len(next) > 0 &&
+			(string(next) == "<" || next[0] == '"' || next[0] >= 0x80 || isAtext(next[0])):
+			return true
+		}
+	}
+	return false
+}
+
+// check for the two or three digits years, the zone names and the
+// whitespace inside the time of a date
+func obsoleteDate(s string) bool {
+	s = stripComments(string(unfold([]byte(s))))
+	if obsTimeSpaceR.MatchString(s) {
+		return true
+	}
+
+	month := false
+	for _, f := range strings.Fields(strings.ReplaceAll(s, ",", " ")) {
+		if _, ok := obsoleteZones[strings.ToUpper(f)]; ok {
+			return true
+		}
+		if len(f) == 1 && ((f[0] >= 'A' && f[0] <= 'Z') || (f[0] >= 'a' && f[0] <= 'z')) {
+			return true
+		}
+		if month && (len(f) == 2 || len(f) == 3) && strings.Trim(f, "0123456789") == "" {
+			return true
+		}
+		month = isMonth(f)
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Originating client IP addresses, for abuse investigations.
+
+package eml
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// OriginatingIP is an address of a client that submitted or relayed the
+// message
+type OriginatingIP struct {
+	IP      string `json:"ip"`
+	Source  string `json:"source"`  // lowercase header name where it was first found
+	Private bool   `json:"private"` // private, loopback, link-local, shared or reserved range
+}
+
+var (
+	// IPv4 addresses, and the IPv6 ones between brackets, like at
+	// "(mail.example.com [192.0.2.1])" or "[IPv6:2001:db8::1]"
+	ipv4R = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	ipv6R = regexp.MustCompile(`(?i)\[(?:ipv6:)?([0-9a-f]*:[0-9a-f:.]+)\]`)
+
+	// the remote address at the Authentication-Results
+	iprevR = regexp.MustCompile(`(?i)\b(?:policy\.iprev|smtp\.remote-ip|smtp\.client-ip)=\[?([0-9a-f:.]+)\]?`)
+)
+
+// ranges which are not publicly routable besides the ones known by net.IP
+var reservedNets = func() (l []*net.IPNet) {
+	for _, s := range []string{
+		"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15",
+		"198.51.100.0/24", "203.0.113.0/24", "240.0.0.0/4", "2001:db8::/32", "64:ff9b:1::/48",
+	} {
+		_, n, _ := net.ParseCIDR(s)
+		l = append(l, n)
+	}
+	return
+}()
+
+// check if an address is out of the public internet
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// find the IP addresses of a text
+func findIPs(s string) (l []net.IP) {
+	for _, m := range ipv4R.FindAllString(s, -1) {
+		if ip := net.ParseIP(m); ip != nil {
+			l = append(l, ip)
+		}
+	}
+	for _, m := range ipv6R.FindAllStringSubmatch(s, -1) {
+		if ip := net.ParseIP(m[1]); ip != nil {
+			l = append(l, ip)
+		}
+	}
+	return
+}
+
+// OriginatingIPs collects the client addresses the message went through,
+// the most likely submitter first: the X-Originating-IP set by the webmail
+// services, then the clients of the Received headers from the oldest one,
+// and the remote addresses checked at the Authentication-Results. The
+// oldest Received headers are written by the sender and may be forged,
+// only the ones added by trusted relays are reliable.
+func (msg Message) OriginatingIPs() (l []OriginatingIP) {
+	seen := make(map[string]bool)
+	add := func(ip net.IP, source string) {
+		s := ip.String()
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		l = append(l, OriginatingIP{IP: s, Source: source, Private: isPrivateIP(ip)})
+	}
+
+	for _, v := range msg.HeaderAll(`X-Originating-IP`) {
+		for _, ip := range findIPs(v) {
+			add(ip, `x-originating-ip`)
+		}
+	}
+
+	for i := len(msg.Received) - 1; i >= 0; i-- {
+		r := msg.Received[i]
+		for _, ip := range findIPs(r.From + " " + r.FromInfo) {
+			add(ip, `received`)
+		}
+	}
+
+	for _, v := range msg.HeaderAll(`Authentication-Results`) {
+		for _, m := range iprevR.FindAllStringSubmatch(v, -1) {
+			if ip := net.ParseIP(strings.TrimSuffix(m[1], ".")); ip != nil {
+				add(ip, `authentication-results`)
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,239 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Compound File Binary Format ([MS-CFB]) reader, just enough to get the
+// streams of an Outlook message.
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	endOfChain = 0xFFFFFFFE
+	noStream   = 0xFFFFFFFF
+
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+type cfbEntry struct {
+	name     string
+	kind     byte
+	left     uint32
+	right    uint32
+	child    uint32
+	start    uint32
+	size     uint64
+	children map[string]*cfbEntry
+}
+
+type cfbFile struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	cutoff     uint64
+	fat        []uint32
+	miniFat    []uint32
+	miniStream []byte
+	entries    []*cfbEntry
+}
+
+func (f *cfbFile) sector(n uint32) ([]byte, error) {
+	off := (int(n) + 1) * f.sectorSize
+	if n >= 0xFFFFFFFA || off+f.sectorSize > len(f.data) {
+		return nil, fmt.Errorf("cfb: sector %d out of range", n)
+	}
+	return f.data[off : off+f.sectorSize], nil
+}
+
+// read a chain of sectors following the FAT
+func (f *cfbFile) chain(start uint32) ([]byte, error) {
+	var out []byte
+	seen := make(map[uint32]bool)
+
+	for n := start; n != endOfChain && n != noStream; {
+		if seen[n] || int(n) >= len(f.fat) {
+			return nil, errors.New("cfb: invalid sector chain")
+		}
+		seen[n] = true
+
+		s, err := f.sector(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s...)
+		n = f.fat[n]
+	}
+
+	return out, nil
+}
+
+func uint32s(b []byte) []uint32 {
+	l := make([]uint32, len(b)/4)
+	for i := range l {
+		l[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return l
+}
+
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, errors.New("cfb: not a compound file")
+	}
+
+	// sectors of 512 or 4096 bytes, mini sectors of 64 bytes and a mini
+	// stream cutoff of 4096 bytes, the only values allowed
+	sectorShift := binary.LittleEndian.Uint16(data[0x1E:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, errors.New("cfb: invalid sector size")
+	}
+	if binary.LittleEndian.Uint16(data[0x20:]) != 6 {
+		return nil, errors.New("cfb: invalid mini sector size")
+	}
+	if binary.LittleEndian.Uint32(data[0x38:]) != 4096 {
+		return nil, errors.New("cfb: invalid mini stream cutoff")
+	}
+
+	f := &cfbFile{
+		data:       data,
+		sectorSize: 1 << sectorShift,
+		miniSize:   64,
+		cutoff:     4096,
+	}
+
+	// the FAT sectors are listed at the DIFAT, which starts at the header
+	difat := uint32s(data[0x4C:0x200])
+	next := binary.LittleEndian.Uint32(data[0x44:])
+	for i := 0; next != endOfChain && next != noStream; i++ {
+		if i > len(data)/f.sectorSize {
+			return nil, errors.New("cfb: invalid DIFAT chain")
+		}
+
+		s, err := f.sector(next)
+		if err != nil {
+			return nil, err
+		}
+		l := uint32s(s)
+		difat = append(difat, l[:len(l)-1]...)
+		next = l[len(l)-1]
+	}
+
+	numFat := int(binary.LittleEndian.Uint32(data[0x2C:]))
+	for i := 0; i < numFat && i < len(difat); i++ {
+		s, err := f.sector(difat[i])
+		if err != nil {
+			return nil, err
+		}
+		f.fat = append(f.fat, uint32s(s)...)
+	}
+
+	dir, err := f.chain(binary.LittleEndian.Uint32(data[0x30:]))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i+128 <= len(dir); i += 128 {
+		e := dir[i : i+128]
+		n := int(binary.LittleEndian.Uint16(e[64:]))
+		if n > 64 {
+			n = 64
+		}
+
+		u := make([]uint16, 0, n/2)
+		for j := 0; j+1 < n; j += 2 {
+			u = append(u, binary.LittleEndian.Uint16(e[j:]))
+		}
+		if len(u) > 0 && u[len(u)-1] == 0 {
+			u = u[:len(u)-1]
+		}
+
+		f.entries = append(f.entries, &cfbEntry{
+			name:  string(utf16.Decode(u)),
+			kind:  e[66],
+			left:  binary.LittleEndian.Uint32(e[68:]),
+			right: binary.LittleEndian.Uint32(e[72:]),
+			child: binary.LittleEndian.Uint32(e[76:]),
+			start: binary.LittleEndian.Uint32(e[116:]),
+			size:  binary.LittleEndian.Uint64(e[120:]),
+		})
+	}
+
+	if len(f.entries) == 0 || f.entries[0].kind != typeRoot {
+		return nil, errors.New("cfb: missing root entry")
+	}
+
+	// version 3 files may have garbage at the high part of the size
+	if f.sectorSize == 512 {
+		for _, e := range f.entries {
+			e.size &= 0xFFFFFFFF
+		}
+	}
+
+	if f.miniStream, err = f.chain(f.entries[0].start); err != nil {
+		return nil, err
+	}
+
+	miniFat, err := f.chain(binary.LittleEndian.Uint32(data[0x3C:]))
+	if err != nil {
+		return nil, err
+	}
+	f.miniFat = uint32s(miniFat)
+
+	// index the children of each storage by name
+	visited := make(map[uint32]bool)
+	for _, e := range f.entries {
+		if e.kind == typeStorage || e.kind == typeRoot {
+			e.children = make(map[string]*cfbEntry)
+			f.collect(e.child, e.children, visited)
+		}
+	}
+
+	return f, nil
+}
+
+// walk the red-black tree of siblings
+func (f *cfbFile) collect(n uint32, into map[string]*cfbEntry, visited map[uint32]bool) {
+	if n == noStream || int(n) >= len(f.entries) || visited[n] {
+		return
+	}
+	visited[n] = true
+
+	e := f.entries[n]
+	into[e.name] = e
+	f.collect(e.left, into, visited)
+	f.collect(e.right, into, visited)
+}
+
+// read the contents of a stream
+func (f *cfbFile) read(e *cfbEntry) ([]byte, error) {
+	var data []byte
+
+	if e.size < f.cutoff {
+		seen := make(map[uint32]bool)
+		for n := e.start; n != endOfChain && n != noStream; n = f.miniFat[n] {
+			off := int(n) * f.miniSize
+			if seen[n] || int(n) >= len(f.miniFat) || off+f.miniSize > len(f.miniStream) {
+				return nil, errors.New("cfb: invalid mini sector chain")
+			}
+			seen[n] = true
+			data = append(data, f.miniStream[off:off+f.miniSize]...)
+		}
+	} else {
+		var err error
+		if data, err = f.chain(e.start); err != nil {
+			return nil, err
+		}
+	}
+
+	if uint64(len(data)) < e.size {
+		return nil, errors.New("cfb: truncated stream")
+	}
+
+	return data[:e.size], nil
+}
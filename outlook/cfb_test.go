@@ -0,0 +1,291 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// entry of a compound file being built, a storage when it has children
+type cfbNode struct {
+	name    string
+	data    []byte
+	storage bool
+	kids    []*cfbNode
+}
+
+func cfbStream(name string, data []byte) *cfbNode {
+	return &cfbNode{name: name, data: data}
+}
+
+func cfbStorage(name string, kids ...*cfbNode) *cfbNode {
+	return &cfbNode{name: name, storage: true, kids: kids}
+}
+
+// build a version 3 compound file, 512 bytes sectors, with the streams
+// under the cutoff at the mini stream
+func buildCFB(kids ...*cfbNode) []byte {
+	const sectorSize, miniSize, cutoff = 512, 64, 4096
+
+	root := cfbStorage("Root Entry", kids...)
+
+	// flatten the tree, the siblings being chained by their right entry
+	var nodes []*cfbNode
+	index := make(map[*cfbNode]uint32)
+	var walk func(n *cfbNode)
+	walk = func(n *cfbNode) {
+		index[n] = uint32(len(nodes))
+		nodes = append(nodes, n)
+		for _, k := range n.kids {
+			walk(k)
+		}
+	}
+	walk(root)
+
+	type place struct {
+		start uint32
+		size  uint64
+	}
+	places := make(map[*cfbNode]place)
+
+	var ministream []byte
+	var minifat []uint32
+	var big []*cfbNode
+	for _, n := range nodes[1:] {
+		switch {
+		case n.storage:
+		case len(n.data) >= cutoff:
+			big = append(big, n)
+		case len(n.data) == 0:
+			places[n] = place{endOfChain, 0}
+		default:
+			start := uint32(len(minifat))
+			count := (len(n.data) + miniSize - 1) / miniSize
+			for i := 0; i < count; i++ {
+				if i+1 < count {
+					minifat = append(minifat, start+uint32(i)+1)
+				} else {
+					minifat = append(minifat, endOfChain)
+				}
+			}
+			ministream = append(ministream, n.data...)
+			ministream = append(ministream, make([]byte, count*miniSize-len(n.data))...)
+			places[n] = place{start, uint64(len(n.data))}
+		}
+	}
+
+	// the regular sectors: directory, mini FAT, mini stream, the big
+	// streams and at last the FAT
+	var sectors [][]byte
+	var fat []uint32
+	alloc := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return endOfChain
+		}
+		start := uint32(len(sectors))
+		for i := 0; i < len(data); i += sectorSize {
+			s := make([]byte, sectorSize)
+			copy(s, data[i:])
+			sectors = append(sectors, s)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = endOfChain
+		return start
+	}
+
+	dir := make([]byte, len(nodes)*128)
+	dirStart := alloc(dir)
+
+	// the unused mini FAT entries are free
+	for len(minifat)%(sectorSize/4) != 0 {
+		minifat = append(minifat, noStream)
+	}
+	mf := make([]byte, len(minifat)*4)
+	for i, v := range minifat {
+		binary.LittleEndian.PutUint32(mf[i*4:], v)
+	}
+	miniFatStart := alloc(mf)
+	places[root] = place{alloc(ministream), uint64(len(ministream))}
+
+	for _, n := range big {
+		places[n] = place{alloc(n.data), uint64(len(n.data))}
+	}
+
+	nFat := 1
+	for (len(sectors)+nFat)*4 > nFat*sectorSize {
+		nFat++
+	}
+	fatStart := uint32(len(sectors))
+	for i := 0; i < nFat; i++ {
+		sectors = append(sectors, make([]byte, sectorSize))
+		fat = append(fat, 0xFFFFFFFD)
+	}
+
+	for i, n := range nodes {
+		e := dir[i*128 : i*128+128]
+		u := utf16.Encode([]rune(n.name))
+		for j, c := range u {
+			binary.LittleEndian.PutUint16(e[j*2:], c)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16(len(u)*2+2))
+
+		e[66] = typeStream
+		if n.storage {
+			e[66] = typeStorage
+		}
+		if i == 0 {
+			e[66] = typeRoot
+		}
+
+		binary.LittleEndian.PutUint32(e[68:], noStream)
+		binary.LittleEndian.PutUint32(e[72:], noStream)
+		binary.LittleEndian.PutUint32(e[76:], noStream)
+		if len(n.kids) > 0 {
+			binary.LittleEndian.PutUint32(e[76:], index[n.kids[0]])
+		}
+
+		if p, ok := places[n]; ok {
+			binary.LittleEndian.PutUint32(e[116:], p.start)
+			binary.LittleEndian.PutUint64(e[120:], p.size)
+		}
+	}
+	for _, n := range nodes {
+		for j := 1; j < len(n.kids); j++ {
+			binary.LittleEndian.PutUint32(dir[index[n.kids[j-1]]*128+72:], index[n.kids[j]])
+		}
+	}
+	copy(sectors[dirStart], dir)
+	for i := 1; i*sectorSize < len(dir); i++ {
+		copy(sectors[int(dirStart)+i], dir[i*sectorSize:])
+	}
+
+	for i := range sectors[fatStart:] {
+		s := sectors[int(fatStart)+i]
+		for j := range s {
+			s[j] = 0xFF
+		}
+		for j := 0; j < sectorSize/4 && i*sectorSize/4+j < len(fat); j++ {
+			binary.LittleEndian.PutUint32(s[j*4:], fat[i*sectorSize/4+j])
+		}
+	}
+
+	h := make([]byte, 512)
+	copy(h, cfbSignature)
+	binary.LittleEndian.PutUint16(h[0x18:], 0x3E)
+	binary.LittleEndian.PutUint16(h[0x1A:], 3)
+	binary.LittleEndian.PutUint16(h[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(h[0x1E:], 9)
+	binary.LittleEndian.PutUint16(h[0x20:], 6)
+	binary.LittleEndian.PutUint32(h[0x2C:], uint32(nFat))
+	binary.LittleEndian.PutUint32(h[0x30:], dirStart)
+	binary.LittleEndian.PutUint32(h[0x38:], cutoff)
+	binary.LittleEndian.PutUint32(h[0x3C:], miniFatStart)
+	binary.LittleEndian.PutUint32(h[0x40:], uint32((len(mf)+sectorSize-1)/sectorSize))
+	binary.LittleEndian.PutUint32(h[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		v := uint32(noStream)
+		if i < nFat {
+			v = fatStart + uint32(i)
+		}
+		binary.LittleEndian.PutUint32(h[0x4C+i*4:], v)
+	}
+
+	return append(h, bytes.Join(sectors, nil)...)
+}
+
+func TestOpenCFB(t *testing.T) {
+	small := []byte(strings.Repeat("small stream ", 20))
+	large := []byte(strings.Repeat("large stream ", 500))
+
+	f, err := openCFB(buildCFB(
+		cfbStream("small", small),
+		cfbStorage("dir", cfbStream("large", large), cfbStream("empty", nil)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := f.entries[0]
+	for _, tt := range []struct {
+		e    *cfbEntry
+		want []byte
+	}{
+		{root.children["small"], small},
+		{root.children["dir"].children["large"], large},
+		{root.children["dir"].children["empty"], nil},
+	} {
+		if tt.e == nil {
+			t.Fatalf("missing entry, got %v", root.children)
+		}
+		data, err := f.read(tt.e)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.e.name, err)
+		}
+		if !bytes.Equal(data, tt.want) {
+			t.Errorf("%s: got %d bytes, want %d", tt.e.name, len(data), len(tt.want))
+		}
+	}
+}
+
+func TestOpenCFBMalformed(t *testing.T) {
+	valid := buildCFB(cfbStream("small", []byte("hello")))
+
+	tests := []struct {
+		name   string
+		change func(b []byte) []byte
+	}{
+		{"short", func(b []byte) []byte { return b[:511] }},
+		{"signature", func(b []byte) []byte { b[0] = 0; return b }},
+		{"sector shift 8", func(b []byte) []byte { binary.LittleEndian.PutUint16(b[0x1E:], 8); return b }},
+		{"sector shift 63", func(b []byte) []byte { binary.LittleEndian.PutUint16(b[0x1E:], 63); return b }},
+		{"mini shift 7", func(b []byte) []byte { binary.LittleEndian.PutUint16(b[0x20:], 7); return b }},
+		{"mini shift 63", func(b []byte) []byte { binary.LittleEndian.PutUint16(b[0x20:], 63); return b }},
+		{"mini shift 64", func(b []byte) []byte { binary.LittleEndian.PutUint16(b[0x20:], 64); return b }},
+		{"cutoff 0", func(b []byte) []byte { binary.LittleEndian.PutUint32(b[0x38:], 0); return b }},
+		{"cutoff max", func(b []byte) []byte { binary.LittleEndian.PutUint32(b[0x38:], 0xFFFFFFFF); return b }},
+		{"directory out of range", func(b []byte) []byte { binary.LittleEndian.PutUint32(b[0x30:], 1000); return b }},
+		{"directory loop", func(b []byte) []byte {
+			// the FAT entry of the directory sector pointing to itself
+			fat := 512 + 512*int(binary.LittleEndian.Uint32(b[0x4C:]))
+			dir := binary.LittleEndian.Uint32(b[0x30:])
+			binary.LittleEndian.PutUint32(b[fat+int(dir)*4:], dir)
+			return b
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.change(append([]byte{}, valid...))
+			if _, err := openCFB(data); err == nil {
+				t.Errorf("no error")
+			}
+			if _, err := Convert(data); err == nil {
+				t.Errorf("Convert: no error")
+			}
+		})
+	}
+}
+
+// a stream whose mini sector chain leaves the mini stream, or is shorter
+// than the stream, is an error
+func TestOpenCFBBadMiniChain(t *testing.T) {
+	f, err := openCFB(buildCFB(cfbStream("small", []byte("hello"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := f.entries[0].children["small"]
+	for _, start := range []uint32{9, 1000, 0xFFFFFFFA} {
+		e.start = start
+		if _, err := f.read(e); err == nil {
+			t.Errorf("start %d: no error", start)
+		}
+	}
+
+	e.start, e.size = 0, 1000
+	if _, err := f.read(e); err == nil {
+		t.Errorf("truncated stream: no error")
+	}
+}
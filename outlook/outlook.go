@@ -0,0 +1,462 @@
+// Package outlook imports the Outlook .msg files, compound files holding
+// the MAPI properties of a message ([MS-OXMSG]), by rebuilding them as
+// RFC 5322 messages that are then handled by the eml parser.
+//
+// The transport headers saved by Outlook are kept when present, otherwise
+// they are synthesized from the MAPI properties. The plain text and HTML
+// bodies and the attachments become a MIME tree, the embedded messages
+// being converted as message/rfc822 parts. Bodies only stored as
+// compressed RTF are not converted.
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ncastellani/eml"
+)
+
+// MAPI property identifiers used by the conversion
+const (
+	propSubject              = 0x0037
+	propClientSubmitTime     = 0x0039
+	propSentRepresentingName = 0x0042
+	propSentRepresentingAddr = 0x0065
+	propTransportHeaders     = 0x007D
+	propRecipientType        = 0x0C15
+	propSenderName           = 0x0C1A
+	propSenderEmail          = 0x0C1F
+	propDeliveryTime         = 0x0E06
+	propBody                 = 0x1000
+	propHTML                 = 0x1013
+	propInternetMessageID    = 0x1035
+	propReferences           = 0x1039
+	propInReplyTo            = 0x1042
+	propDisplayName          = 0x3001
+	propEmailAddress         = 0x3003
+	propAttachData           = 0x3701
+	propAttachFilename       = 0x3704
+	propAttachMethod         = 0x3705
+	propAttachLongFilename   = 0x3707
+	propAttachMimeTag        = 0x370E
+	propAttachContentID      = 0x3712
+	propSMTPAddress          = 0x39FE
+	propInternetCodepage     = 0x3FDE
+	propSenderSMTPAddress    = 0x5D01
+)
+
+// MAPI property types
+const (
+	typeLong    = 0x0003
+	typeString8 = 0x001E
+	typeUnicode = 0x001F
+	typeSystime = 0x0040
+	typeObject  = 0x000D
+	typeBinary  = 0x0102
+)
+
+// sizes of the header of the fixed properties stream
+const (
+	headerTopLevel = 32
+	headerEmbedded = 24
+	headerChild    = 8
+)
+
+const attachEmbeddedMessage = 5
+
+// charsets of the most common Windows code pages
+var codepages = map[uint64]string{
+	874: "windows-874", 932: "shift_jis", 936: "gb2312", 949: "euc-kr",
+	950: "big5", 1250: "windows-1250", 1251: "windows-1251",
+	1252: "windows-1252", 1253: "windows-1253", 1254: "windows-1254",
+	1255: "windows-1255", 1256: "windows-1256", 1257: "windows-1257",
+	1258: "windows-1258", 20127: "us-ascii", 20866: "koi8-r",
+	21866: "koi8-u", 28591: "iso-8859-1", 28592: "iso-8859-2",
+	28595: "iso-8859-5", 28597: "iso-8859-7", 28605: "iso-8859-15",
+	50220: "iso-2022-jp", 51932: "euc-jp", 65001: "utf-8",
+}
+
+// storage holding the properties of a message, recipient or attachment
+type storage struct {
+	f     *cfbFile
+	e     *cfbEntry
+	fixed map[uint16]uint64 // fixed size properties, by id
+}
+
+func newStorage(f *cfbFile, e *cfbEntry, headerSize int) storage {
+	s := storage{f: f, e: e, fixed: make(map[uint16]uint64)}
+
+	ps, ok := e.children["__properties_version1.0"]
+	if !ok {
+		return s
+	}
+
+	data, err := f.read(ps)
+	if err != nil || len(data) < headerSize {
+		return s
+	}
+
+	for i := headerSize; i+16 <= len(data); i += 16 {
+		tag := binary.LittleEndian.Uint32(data[i:])
+		s.fixed[uint16(tag>>16)] = binary.LittleEndian.Uint64(data[i+8:])
+	}
+
+	return s
+}
+
+// get the contents of a variable size property stream
+func (s storage) stream(id, typ uint16) ([]byte, bool) {
+	e, ok := s.e.children[fmt.Sprintf("__substg1.0_%04X%04X", id, typ)]
+	if !ok {
+		return nil, false
+	}
+
+	data, err := s.f.read(e)
+	return data, err == nil
+}
+
+// get a string property, either on its Unicode or 8-bit version
+func (s storage) str(id uint16) string {
+	if data, ok := s.stream(id, typeUnicode); ok {
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+
+	if data, ok := s.stream(id, typeString8); ok {
+		data = bytes.TrimRight(data, "\x00")
+		if d, err := eml.UTF8(s.charset(), data); err == nil {
+			return string(d)
+		}
+		return string(data)
+	}
+
+	return ""
+}
+
+// get a FILETIME property
+func (s storage) time(id uint16) (time.Time, bool) {
+	v, ok := s.fixed[id]
+	if !ok || v == 0 {
+		return time.Time{}, false
+	}
+
+	// 100 nanoseconds intervals since 1601-01-01
+	const epochDelta = 116444736000000000
+	return time.Unix(0, 0).Add(time.Duration(v-epochDelta) * 100).UTC(), true
+}
+
+// get the charset of the 8-bit strings and HTML body
+func (s storage) charset() string {
+	if cs, ok := codepages[s.fixed[propInternetCodepage]&0xFFFFFFFF]; ok {
+		return cs
+	}
+	return "windows-1252"
+}
+
+// get the child storages with the given name prefix, in order
+func (s storage) children(prefix string) (l []storage) {
+	var names []string
+	for n, e := range s.e.children {
+		if strings.HasPrefix(n, prefix) && e.kind == typeStorage {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		l = append(l, newStorage(s.f, s.e.children[n], headerChild))
+	}
+	return
+}
+
+// Convert rebuilds an Outlook .msg file as an RFC 5322 message
+func Convert(data []byte) ([]byte, error) {
+	f, err := openCFB(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return convert(newStorage(f, f.entries[0], headerTopLevel))
+}
+
+// Parse converts an Outlook .msg file and parses the resulting message
+func Parse(data []byte) (msg eml.Message, errors []error) {
+	raw, err := Convert(data)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("outlook: %v", err))
+		return
+	}
+
+	return eml.Parse(raw)
+}
+
+func convert(s storage) ([]byte, error) {
+	var b bytes.Buffer
+
+	if th := s.str(propTransportHeaders); th != "" {
+		writeTransportHeaders(&b, th)
+	} else {
+		writeHeaders(&b, s)
+	}
+
+	body, ct, err := buildBody(s)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\nContent-Type: %s\r\n\r\n", ct)
+	b.Write(body)
+
+	return b.Bytes(), nil
+}
+
+// copy the saved transport headers, but the ones describing the original
+// body, which is rebuilt
+func writeTransportHeaders(b *bytes.Buffer, th string) {
+	th = strings.ReplaceAll(th, "\r\n", "\n")
+
+	// stop at the end of the header block
+	if i := strings.Index(th, "\n\n"); i >= 0 {
+		th = th[:i]
+	}
+
+	skip := false
+	for _, l := range strings.Split(th, "\n") {
+		if l == "" {
+			continue
+		}
+
+		if l[0] != ' ' && l[0] != '\t' {
+			k, _, _ := strings.Cut(strings.ToLower(l), ":")
+			skip = strings.HasPrefix(k, "content-") || k == "mime-version"
+		}
+
+		if !skip {
+			b.WriteString(l + "\r\n")
+		}
+	}
+}
+
+// synthesize the headers from the MAPI properties
+func writeHeaders(b *bytes.Buffer, s storage) {
+	if t, ok := s.time(propClientSubmitTime); ok {
+		fmt.Fprintf(b, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	} else if t, ok := s.time(propDeliveryTime); ok {
+		fmt.Fprintf(b, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	}
+
+	from := mail.Address{Name: s.str(propSenderName), Address: s.str(propSenderSMTPAddress)}
+	if from.Name == "" {
+		from.Name = s.str(propSentRepresentingName)
+	}
+	for _, id := range []uint16{propSenderEmail, propSentRepresentingAddr} {
+		if from.Address == "" && strings.Contains(s.str(id), "@") {
+			from.Address = s.str(id)
+		}
+	}
+	if from.Address != "" {
+		fmt.Fprintf(b, "From: %s\r\n", from.String())
+	}
+
+	// recipients by their type: 1 for To, 2 for Cc and 3 for Bcc
+	recipients := make(map[uint64][]string)
+	for _, r := range s.children("__recip_version1.0_") {
+		a := mail.Address{Name: r.str(propDisplayName), Address: r.str(propSMTPAddress)}
+		if a.Address == "" && strings.Contains(r.str(propEmailAddress), "@") {
+			a.Address = r.str(propEmailAddress)
+		}
+		if a.Address == "" {
+			continue
+		}
+		if a.Name == a.Address {
+			a.Name = ""
+		}
+
+		t := r.fixed[propRecipientType] & 0xFFFFFFFF
+		recipients[t] = append(recipients[t], a.String())
+	}
+
+	for _, h := range []struct {
+		t uint64
+		k string
+	}{{1, "To"}, {2, "Cc"}, {3, "Bcc"}} {
+		if l := recipients[h.t]; len(l) > 0 {
+			fmt.Fprintf(b, "%s: %s\r\n", h.k, strings.Join(l, ",\r\n "))
+		}
+	}
+
+	if subject := s.str(propSubject); subject != "" {
+		fmt.Fprintf(b, "Subject: %s\r\n", eml.EncodeHeader(subject, "UTF-8"))
+	}
+
+	for _, h := range []struct {
+		id uint16
+		k  string
+	}{{propInternetMessageID, "Message-ID"}, {propInReplyTo, "In-Reply-To"}, {propReferences, "References"}} {
+		if v := strings.TrimSpace(s.str(h.id)); v != "" {
+			fmt.Fprintf(b, "%s: %s\r\n", h.k, v)
+		}
+	}
+}
+
+// build the MIME body with the text versions and the attachments,
+// returning it with its Content-Type
+func buildBody(s storage) ([]byte, string, error) {
+	var b bytes.Buffer
+
+	mixed := multipart.NewWriter(&b)
+
+	// the text and HTML versions are alternatives
+	var alt bytes.Buffer
+	aw := multipart.NewWriter(&alt)
+
+	if err := writePart(aw, "text/plain; charset=utf-8", []byte(s.str(propBody))); err != nil {
+		return nil, "", err
+	}
+
+	if html, ok := s.stream(propHTML, typeBinary); ok {
+		ct := mime.FormatMediaType("text/html", map[string]string{"charset": s.charset()})
+		if err := writePart(aw, ct, bytes.TrimRight(html, "\x00")); err != nil {
+			return nil, "", err
+		}
+	} else if html := s.str(propHTML); html != "" {
+		if err := writePart(aw, "text/html; charset=utf-8", []byte(html)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	aw.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": aw.Boundary()}))
+	w, err := mixed.CreatePart(h)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := w.Write(alt.Bytes()); err != nil {
+		return nil, "", err
+	}
+
+	for _, a := range s.children("__attach_version1.0_") {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, "", err
+		}
+	}
+
+	mixed.Close()
+
+	ct := mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()})
+	return b.Bytes(), ct, nil
+}
+
+func writeAttachment(mw *multipart.Writer, a storage) error {
+	filename := a.str(propAttachLongFilename)
+	if filename == "" {
+		filename = a.str(propAttachFilename)
+	}
+	if filename == "" {
+		filename = a.str(propDisplayName)
+	}
+
+	ct := a.str(propAttachMimeTag)
+	var data []byte
+
+	embedded := a.fixed[propAttachMethod]&0xFFFFFFFF == attachEmbeddedMessage
+	if embedded {
+		e, ok := a.e.children[fmt.Sprintf("__substg1.0_%04X%04X", propAttachData, typeObject)]
+		if !ok {
+			return nil
+		}
+
+		inner, err := convert(newStorage(a.f, e, headerEmbedded))
+		if err != nil {
+			return err
+		}
+
+		data, ct = inner, "message/rfc822"
+	} else {
+		var ok bool
+		if data, ok = a.stream(propAttachData, typeBinary); !ok {
+			return nil
+		}
+	}
+
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	if filename != "" {
+		if t, ps, err := mime.ParseMediaType(ct); err == nil {
+			ps["name"] = filename
+			ct = mime.FormatMediaType(t, ps)
+		}
+	}
+
+	// the parts referenced by the HTML body are inline
+	cid := a.str(propAttachContentID)
+	disposition := "attachment"
+	if cid != "" {
+		disposition = "inline"
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", ct)
+	if filename != "" {
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	} else {
+		h.Set("Content-Disposition", disposition)
+	}
+	if cid != "" {
+		h.Set("Content-ID", "<"+strings.Trim(cid, "<>")+">")
+	}
+
+	// the messages can't be encoded (RFC 2046 section 5.2.1), the attached
+	// .eml files included
+	if t, _, _ := mime.ParseMediaType(ct); embedded || strings.EqualFold(t, "message/rfc822") {
+		return writeIdentity(mw, h, data)
+	}
+	return writeEncoded(mw, h, data)
+}
+
+// write a base64 encoded body part
+func writePart(mw *multipart.Writer, ct string, data []byte) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", ct)
+	return writeEncoded(mw, h, data)
+}
+
+func writeEncoded(mw *multipart.Writer, h textproto.MIMEHeader, data []byte) error {
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(eml.EncodeBase64(data))
+	return err
+}
+
+// write a body part as it is, with the identity encoding it fits
+func writeIdentity(mw *multipart.Writer, h textproto.MIMEHeader, data []byte) error {
+	h.Set("Content-Transfer-Encoding", eml.DetectTransferEncoding(data))
+
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,132 @@
+package outlook
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// a fixed properties stream, the values by their property tag
+func msgProperties(headerSize int, values map[uint32]uint64) *cfbNode {
+	data := make([]byte, headerSize)
+	for tag, v := range values {
+		p := make([]byte, 16)
+		binary.LittleEndian.PutUint32(p, tag)
+		binary.LittleEndian.PutUint64(p[8:], v)
+		data = append(data, p...)
+	}
+	return cfbStream("__properties_version1.0", data)
+}
+
+// a Unicode string property stream
+func msgString(id uint16, s string) *cfbNode {
+	u := utf16.Encode([]rune(s + "\x00"))
+	data := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(data[i*2:], c)
+	}
+	return cfbStream(fmt.Sprintf("__substg1.0_%04X%04X", id, typeUnicode), data)
+}
+
+func msgBinary(id uint16, data []byte) *cfbNode {
+	return cfbStream(fmt.Sprintf("__substg1.0_%04X%04X", id, typeBinary), data)
+}
+
+func testMsg() []byte {
+	embedded := cfbStorage(fmt.Sprintf("__substg1.0_%04X%04X", propAttachData, typeObject),
+		msgProperties(headerEmbedded, nil),
+		msgString(propSubject, "Inner"),
+		msgString(propBody, "inner body"),
+		msgString(propInternetMessageID, "<inner@example.com>"),
+	)
+
+	return buildCFB(
+		msgProperties(headerTopLevel, nil),
+		msgString(propSubject, "Café report"),
+		msgString(propSenderName, "Alice"),
+		msgString(propSenderSMTPAddress, "alice@example.com"),
+		msgString(propBody, "see the attachments"),
+		msgString(propInternetMessageID, "<outer@example.com>"),
+		cfbStorage("__recip_version1.0_#00000000",
+			msgProperties(headerChild, map[uint32]uint64{uint32(propRecipientType)<<16 | typeLong: 1}),
+			msgString(propDisplayName, "Bob"),
+			msgString(propSMTPAddress, "bob@example.com"),
+		),
+		cfbStorage("__attach_version1.0_#00000000",
+			msgProperties(headerChild, map[uint32]uint64{uint32(propAttachMethod)<<16 | typeLong: 1}),
+			msgString(propAttachLongFilename, "report.pdf"),
+			msgString(propAttachMimeTag, "application/pdf"),
+			msgBinary(propAttachData, []byte("%PDF-1.4\n")),
+		),
+		cfbStorage("__attach_version1.0_#00000001",
+			msgProperties(headerChild, map[uint32]uint64{uint32(propAttachMethod)<<16 | typeLong: attachEmbeddedMessage}),
+			msgString(propDisplayName, "Inner"),
+			embedded,
+		),
+		cfbStorage("__attach_version1.0_#00000002",
+			msgProperties(headerChild, map[uint32]uint64{uint32(propAttachMethod)<<16 | typeLong: 1}),
+			msgString(propAttachLongFilename, "saved.eml"),
+			msgString(propAttachMimeTag, "message/rfc822"),
+			msgBinary(propAttachData, []byte("Subject: Saved\r\n\r\nsaved body\r\n")),
+		),
+	)
+}
+
+func TestParse(t *testing.T) {
+	msg, errs := Parse(testMsg())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if msg.Subject != "Café report" || msg.MessageID != "outer@example.com" {
+		t.Errorf("subject = %q, message id = %q", msg.Subject, msg.MessageID)
+	}
+	if len(msg.From) != 1 || msg.From[0].Email() != "alice@example.com" {
+		t.Errorf("from = %v", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0].Email() != "bob@example.com" {
+		t.Errorf("to = %v", msg.To)
+	}
+	if strings.TrimSpace(msg.Text) != "see the attachments" {
+		t.Errorf("text = %q", msg.Text)
+	}
+
+	var pdf bool
+	for _, a := range msg.Attachments {
+		if a.Filename == "report.pdf" && string(a.Data) == "%PDF-1.4\n" {
+			pdf = true
+		}
+	}
+	if !pdf {
+		t.Errorf("missing the pdf attachment at %+v", msg.Attachments)
+	}
+
+	// the messages are not encoded (RFC 2046 section 5.2.1)
+	parts := msg.PartsByType("message/rfc822")
+	if len(parts) != 2 {
+		t.Fatalf("got %d message parts", len(parts))
+	}
+	for i, want := range []string{"Inner", "Saved"} {
+		if te := parts[i].TransferEncoding; te != "7bit" {
+			t.Errorf("message part %d encoded as %q", i, te)
+		}
+
+		inner, errs := parts[i].Message()
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if inner.Subject != want {
+			t.Errorf("message part %d subject = %q, want %q", i, inner.Subject, want)
+		}
+	}
+}
+
+func TestParseNotMsg(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("From: a@example.com\r\n\r\nbody")} {
+		if _, errs := Parse(data); len(errs) == 0 {
+			t.Errorf("no error for %q", data)
+		}
+	}
+}
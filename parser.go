@@ -0,0 +1,101 @@
+// Parser reusing its buffers between the messages.
+
+package eml
+
+import (
+	"context"
+	"sync"
+)
+
+// Parser parses messages with the same options, reusing its scratch
+// buffers, like the header and text lists, between the calls, for the
+// long running services parsing many messages. It's safe for concurrent
+// use.
+type Parser struct {
+	opts ParseOptions
+	pool sync.Pool
+}
+
+// NewParser builds a parser with the given options
+func NewParser(opts ParseOptions) *Parser {
+	p := &Parser{opts: opts}
+	p.pool.New = func() interface{} { return &parseScratch{} }
+	return p
+}
+
+// Parse parses a message like ParseWithOptions
+func (p *Parser) Parse(data []byte) (Message, []error) {
+	return p.ParseContext(context.Background(), data)
+}
+
+// ParseContext parses a message like ParseContextWithOptions
+func (p *Parser) ParseContext(ctx context.Context, data []byte) (Message, []error) {
+	s := p.pool.Get().(*parseScratch)
+	defer func() {
+		s.reset()
+		p.pool.Put(s)
+	}()
+
+	opts := p.opts
+	opts.scratch = s
+	return ParseContextWithOptions(ctx, data, opts)
+}
+
+// buffers used while parsing a message, none of them is referenced by the
+// parsed message
+type parseScratch struct {
+	headers    []RawHeader
+	part       []RawHeader // headers of the multipart entries, one at a time
+	text, html []string
+}
+
+// get the buffer for the message headers, a new one without scratch
+func (s *parseScratch) rawHeaders() []RawHeader {
+	if s == nil || s.headers == nil {
+		return make([]RawHeader, 0, 32)
+	}
+	return s.headers[:0]
+}
+
+// keep the headers buffer, which may have grown, for the next message
+func (s *parseScratch) keepRawHeaders(h []RawHeader) {
+	if s != nil {
+		s.headers = h
+	}
+}
+
+// get the buffer for the headers of a multipart entry
+func (s *parseScratch) partHeaders() []RawHeader {
+	if s == nil || s.part == nil {
+		return make([]RawHeader, 0, 8)
+	}
+	return s.part[:0]
+}
+
+func (s *parseScratch) keepPartHeaders(h []RawHeader) {
+	if s != nil {
+		s.part = h
+	}
+}
+
+func (s *parseScratch) texts() (text, html []string) {
+	if s == nil {
+		return nil, nil
+	}
+	return s.text[:0], s.html[:0]
+}
+
+func (s *parseScratch) keepTexts(text, html []string) {
+	if s != nil {
+		s.text, s.html = text, html
+	}
+}
+
+// drop the references to the last message, so it can be collected
+func (s *parseScratch) reset() {
+	clear(s.headers)
+	clear(s.part)
+	clear(s.text)
+	clear(s.html)
+	s.headers, s.part, s.text, s.html = s.headers[:0], s.part[:0], s.text[:0], s.html[:0]
+}
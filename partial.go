@@ -0,0 +1,121 @@
+// Reassembly of the message/partial (RFC 2046 section 5.2.2) fragments.
+
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// header fields of the reassembled message taken from the encapsulated
+// headers instead of the enclosing ones of the first fragment
+func isEncapsulatedField(name string) bool {
+	switch name {
+	case `subject`, `message-id`, `encrypted`, `mime-version`:
+		return true
+	}
+	return strings.HasPrefix(name, "content-")
+}
+
+// Reassemble joins the fragments of a message split into message/partial
+// messages, in any order, and parses the original message. The fragments
+// must share the same id and be all present.
+func Reassemble(pieces []Message) (Message, error) {
+	if len(pieces) == 0 {
+		return Message{}, errors.New("partial: no fragments")
+	}
+
+	type fragment struct {
+		number int
+		body   []byte
+		msg    Message
+	}
+
+	var id string
+	total := 0
+	frags := []fragment{}
+
+	for i, p := range pieces {
+		ct, _ := p.rawHeader(`content-type`)
+		mt, ps, err := mime.ParseMediaType(ct)
+		if err != nil || mt != "message/partial" {
+			return Message{}, fmt.Errorf("partial: fragment %d is not a message/partial", i+1)
+		}
+
+		if i == 0 {
+			id = ps["id"]
+		} else if ps["id"] != id {
+			return Message{}, fmt.Errorf("partial: fragment %d belongs to a different message", i+1)
+		}
+
+		n, err := strconv.Atoi(ps["number"])
+		if err != nil || n < 1 {
+			return Message{}, fmt.Errorf("partial: invalid number at fragment %d", i+1)
+		}
+
+		// the total is only required at the last fragment
+		if t, err := strconv.Atoi(ps["total"]); err == nil {
+			if total != 0 && t != total {
+				return Message{}, fmt.Errorf("partial: conflicting total at fragment %d", i+1)
+			}
+			total = t
+		}
+
+		frags = append(frags, fragment{n, p.Body, p})
+	}
+
+	sort.Slice(frags, func(i, j int) bool { return frags[i].number < frags[j].number })
+
+	if total == 0 || total != len(frags) {
+		return Message{}, fmt.Errorf("partial: %d of %d fragments present", len(frags), total)
+	}
+
+	var data []byte
+	for i, f := range frags {
+		if f.number != i+1 {
+			return Message{}, fmt.Errorf("partial: fragment %d missing or duplicated", i+1)
+		}
+		data = append(data, f.body...)
+	}
+
+	// the encapsulated message starts at the first fragment
+	inner, err := ParseRaw(data)
+	if err != nil {
+		return Message{}, fmt.Errorf("partial: %v", err)
+	}
+
+	nl := []byte("\r\n")
+	if !bytes.Contains(data[:inner.BodyOffset], nl) {
+		nl = []byte("\n")
+	}
+
+	var out []byte
+	for _, f := range splitHeaderFields(frags[0].msg.Headers) {
+		if !isEncapsulatedField(headerFieldName(f)) {
+			out = append(out, bytes.TrimRight(f, "\r\n")...)
+			out = append(out, nl...)
+		}
+	}
+
+	for _, f := range splitHeaderFields(data[:inner.BodyOffset]) {
+		if isEncapsulatedField(headerFieldName(f)) {
+			out = append(out, bytes.TrimRight(f, "\r\n")...)
+			out = append(out, nl...)
+		}
+	}
+
+	out = append(out, nl...)
+	out = append(out, inner.Body...)
+
+	msg, errs := Parse(out)
+	if len(errs) > 0 {
+		return msg, errors.Join(errs...)
+	}
+
+	return msg, nil
+}
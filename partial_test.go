@@ -0,0 +1,140 @@
+package eml
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// the message split at the example of RFC 2046 section 5.2.2.1
+const partialInner = "Subject: Audio mail (part 1 of 2)\r\n" +
+	"Message-ID: <id1@host.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"X-Dropped: inner\r\n" +
+	"Content-Type: text/plain; charset=us-ascii\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"first half, second half=21\r\n"
+
+// build the fragments of partialInner, the params of each being added to
+// its Content-Type
+func partialFragments(t *testing.T, params ...string) []Message {
+	cut := []int{0, strings.Index(partialInner, "X-Dropped"), strings.Index(partialInner, "second"), len(partialInner)}
+	if len(params) != len(cut)-1 {
+		t.Fatalf("%d fragments", len(params))
+	}
+
+	var frags []Message
+	for i, ps := range params {
+		data := "From: Bill@host.com\r\n" +
+			"To: joe@otherhost.com\r\n" +
+			"Date: Fri, 26 Mar 1993 12:59:38 -0500 (EST)\r\n" +
+			fmt.Sprintf("Subject: Audio mail (part %d)\r\n", i+1) +
+			fmt.Sprintf("Message-ID: <outer%d@host.com>\r\n", i+1) +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: message/partial; " + ps + "\r\n" +
+			"\r\n" +
+			partialInner[cut[i]:cut[i+1]]
+
+		msg, errs := Parse([]byte(data))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		frags = append(frags, msg)
+	}
+
+	return frags
+}
+
+func TestReassemble(t *testing.T) {
+	frags := partialFragments(t,
+		`id="ABC"; number=1`,
+		`id="ABC"; number=2`,
+		`id="ABC"; number=3; total=3`,
+	)
+
+	// in any order
+	for _, order := range [][]int{{0, 1, 2}, {2, 0, 1}, {1, 2, 0}} {
+		var pieces []Message
+		for _, i := range order {
+			pieces = append(pieces, frags[i])
+		}
+
+		msg, err := Reassemble(pieces)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+
+		if strings.TrimSpace(msg.Text) != "first half, second half!" {
+			t.Errorf("%v: text = %q", order, msg.Text)
+		}
+		if msg.Subject != "Audio mail (part 1 of 2)" || msg.MessageID != "id1@host.com" {
+			t.Errorf("%v: subject = %q, message id = %q", order, msg.Subject, msg.MessageID)
+		}
+	}
+}
+
+// the enclosing fields of the first fragment are kept, but the Content-*,
+// Subject, Message-ID, Encrypted and MIME-Version ones come from the
+// encapsulated header, its other fields being dropped (RFC 2046 section
+// 5.2.2.1)
+func TestReassembleHeaders(t *testing.T) {
+	frags := partialFragments(t,
+		`id="ABC"; number=1`,
+		`id="ABC"; number=2`,
+		`id="ABC"; number=3; total=3`,
+	)
+
+	msg, err := Reassemble(frags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range splitHeaderFields(msg.Headers) {
+		names = append(names, headerFieldName(f))
+	}
+
+	want := "from to date subject message-id mime-version content-type content-transfer-encoding"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+
+	if ct, _ := msg.rawHeader("content-type"); ct != "text/plain; charset=us-ascii" {
+		t.Errorf("content type = %q", ct)
+	}
+	if d, _ := msg.rawHeader("date"); d != "Fri, 26 Mar 1993 12:59:38 -0500 (EST)" {
+		t.Errorf("date = %q", d)
+	}
+}
+
+func TestReassembleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []string
+	}{
+		{"missing", []string{`id="ABC"; number=1`, `id="ABC"; number=3`, `id="ABC"; number=4; total=4`}},
+		{"duplicate", []string{`id="ABC"; number=1`, `id="ABC"; number=1`, `id="ABC"; number=3; total=3`}},
+		{"id mismatch", []string{`id="ABC"; number=1`, `id="XYZ"; number=2`, `id="ABC"; number=3; total=3`}},
+		{"no total", []string{`id="ABC"; number=1`, `id="ABC"; number=2`, `id="ABC"; number=3`}},
+		{"total over the fragments", []string{`id="ABC"; number=1`, `id="ABC"; number=2`, `id="ABC"; number=3; total=4`}},
+		{"conflicting totals", []string{`id="ABC"; number=1; total=2`, `id="ABC"; number=2`, `id="ABC"; number=3; total=3`}},
+		{"invalid number", []string{`id="ABC"; number=0`, `id="ABC"; number=2`, `id="ABC"; number=3; total=3`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Reassemble(partialFragments(t, tt.params...)); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+
+	msg, _ := Parse([]byte("Content-Type: text/plain\r\n\r\nbody\r\n"))
+	if _, err := Reassemble([]Message{msg}); err == nil {
+		t.Errorf("no error for a message which is not a fragment")
+	}
+	if _, err := Reassemble(nil); err == nil {
+		t.Errorf("no error without fragments")
+	}
+}
@@ -0,0 +1,232 @@
+// Attachment policies evaluated while parsing, for quarantine decisions.
+
+package eml
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ViolationKind is the rule of an attachment policy that was broken
+type ViolationKind string
+
+const (
+	// ViolationNotAllowed is an attachment out of the allowed extensions
+	// and types
+	ViolationNotAllowed ViolationKind = "not-allowed"
+	// ViolationExtension is a denied filename extension
+	ViolationExtension ViolationKind = "extension"
+	// ViolationType is a denied media type, declared or detected
+	ViolationType ViolationKind = "type"
+	// ViolationSize is an attachment over the size limit
+	ViolationSize ViolationKind = "size"
+	// ViolationExecutable is a program or script, by name or contents,
+	// also inside a zip archive
+	ViolationExecutable ViolationKind = "executable"
+	// ViolationMacro is an Office document with macros
+	ViolationMacro ViolationKind = "macro"
+	// ViolationNestedArchive is an archive holding other archives
+	ViolationNestedArchive ViolationKind = "nested-archive"
+)
+
+// PolicyViolation is an attachment breaking the AttachmentPolicy of the
+// parser
+type PolicyViolation struct {
+	Kind        ViolationKind `json:"kind"`
+	Filename    string        `json:"filename"`
+	ContentType string        `json:"content_type"`
+	Detail      string        `json:"detail"`
+	Stripped    bool          `json:"stripped"` // removed from the message attachments
+}
+
+// AttachmentPolicy tells which attachments are flagged, or stripped, while
+// parsing, see ParseOptions.Policy. The extensions are matched without
+// case and with the dot, like ".exe", and the types accept patterns like
+// "video/*".
+type AttachmentPolicy struct {
+	// AllowExtensions and AllowTypes, when not empty, are the only ones
+	// accepted, either of them being enough
+	AllowExtensions []string
+	AllowTypes      []string
+
+	DenyExtensions []string
+	DenyTypes      []string
+
+	// MaxSize is the maximum size of the decoded contents, no limit when 0
+	MaxSize int
+
+	Executables    bool // deny the programs and scripts
+	Macros         bool // deny the macro enabled Office documents
+	NestedArchives bool // deny the archives holding archives
+
+	// Strip removes the attachments breaking the policy from the message
+	// attachments, the parts and raw data being kept, see StripAttachments
+	Strip bool
+}
+
+// DefaultAttachmentPolicy flags the executables, the macro enabled Office
+// documents and the nested archives, without stripping them
+func DefaultAttachmentPolicy() *AttachmentPolicy {
+	return &AttachmentPolicy{Executables: true, Macros: true, NestedArchives: true}
+}
+
+// extensions of the programs and scripts run when opened on Windows
+var executableExtensions = map[string]bool{
+	".exe": true, ".com": true, ".scr": true, ".pif": true, ".bat": true, ".cmd": true,
+	".vbs": true, ".vbe": true, ".js": true, ".jse": true, ".wsf": true, ".wsh": true,
+	".msi": true, ".msp": true, ".cpl": true, ".hta": true, ".jar": true, ".ps1": true,
+	".lnk": true, ".dll": true, ".reg": true, ".scf": true, ".application": true,
+}
+
+var macroExtensions = map[string]bool{
+	".docm": true, ".dotm": true, ".xlsm": true, ".xltm": true, ".xlam": true,
+	".pptm": true, ".potm": true, ".ppsm": true, ".ppam": true, ".sldm": true,
+}
+
+var archiveExtensions = map[string]bool{
+	".zip": true, ".rar": true, ".7z": true, ".gz": true, ".tgz": true, ".tar": true,
+	".bz2": true, ".xz": true, ".cab": true, ".iso": true, ".img": true, ".arj": true,
+}
+
+// check the attachments, returning the ones kept and the violations found
+func (p *AttachmentPolicy) apply(atts []Attachment) (kept []Attachment, found []PolicyViolation) {
+	for _, a := range atts {
+		v := p.check(a)
+		for i := range v {
+			v[i].Stripped = p.Strip
+		}
+		found = append(found, v...)
+
+		if len(v) == 0 || !p.Strip {
+			kept = append(kept, a)
+		}
+	}
+	return
+}
+
+// find the rules broken by an attachment
+func (p *AttachmentPolicy) check(a Attachment) (found []PolicyViolation) {
+	add := func(k ViolationKind, format string, args ...interface{}) {
+		found = append(found, PolicyViolation{Kind: k, Filename: a.Filename, ContentType: a.ContentType, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	ext := strings.ToLower(path.Ext(a.Filename))
+
+	// the skipped attachments have no contents to look at
+	detected := a.DetectedType
+	if detected == "" && !a.Skipped {
+		detected = DetectContentType(a.Data)
+	}
+	types := []string{a.ContentType, detected}
+
+	if len(p.AllowExtensions) > 0 || len(p.AllowTypes) > 0 {
+		if !containsFold(p.AllowExtensions, ext) && !matchesAny(types, p.AllowTypes) {
+			add(ViolationNotAllowed, "extension %q and type %q not allowed", ext, a.ContentType)
+		}
+	}
+
+	if ext != "" && containsFold(p.DenyExtensions, ext) {
+		add(ViolationExtension, "denied extension %q", ext)
+	}
+	for _, t := range types {
+		if matchesAny([]string{t}, p.DenyTypes) {
+			add(ViolationType, "denied type %q", t)
+			break
+		}
+	}
+
+	if p.MaxSize > 0 && len(a.Data) > p.MaxSize {
+		add(ViolationSize, "%d bytes over the limit of %d", len(a.Data), p.MaxSize)
+	}
+
+	if p.Executables {
+		switch {
+		case executableExtensions[ext]:
+			add(ViolationExecutable, "executable extension %q", ext)
+		case mediaTypeMatches(detected, "application/vnd.microsoft.portable-executable"), mediaTypeMatches(detected, "application/x-executable"):
+			add(ViolationExecutable, "executable contents (%s)", detected)
+		}
+	}
+
+	if p.Macros {
+		switch {
+		case macroExtensions[ext]:
+			add(ViolationMacro, "macro enabled extension %q", ext)
+		case hasMacros(a.Data, detected):
+			add(ViolationMacro, "document with a VBA project")
+		}
+	}
+
+	// look inside the zip archives for what they hide
+	if (p.Executables || p.NestedArchives) && mediaTypeMatches(detected, "application/zip") {
+		zr, err := zip.NewReader(bytes.NewReader(a.Data), int64(len(a.Data)))
+		if err != nil {
+			return
+		}
+
+		// each rule is reported once, for the first entry breaking it
+		exe, arc := p.Executables, p.NestedArchives
+		for _, f := range zr.File {
+			e := strings.ToLower(path.Ext(f.Name))
+			if exe && executableExtensions[e] {
+				add(ViolationExecutable, "executable %q inside the archive", f.Name)
+				exe = false
+			}
+			if arc && archiveExtensions[e] {
+				add(ViolationNestedArchive, "archive %q inside the archive", f.Name)
+				arc = false
+			}
+		}
+	}
+
+	return
+}
+
+// check if an Office document carries a VBA project: a vbaProject.bin
+// entry of the OOXML ones, or the _VBA_PROJECT stream of the OLE ones
+func hasMacros(data []byte, detected string) bool {
+	if strings.HasPrefix(detected, "application/vnd.openxmlformats-officedocument.") {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return false
+		}
+		for _, f := range zr.File {
+			if strings.EqualFold(path.Base(f.Name), "vbaProject.bin") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if detected == "application/x-ole-storage" {
+		// the stream names are UTF-16LE at the directory entries
+		name := []byte("_\x00V\x00B\x00A\x00_\x00P\x00R\x00O\x00J\x00E\x00C\x00T\x00")
+		return bytes.Contains(data, name)
+	}
+
+	return false
+}
+
+func containsFold(l []string, s string) bool {
+	for _, v := range l {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// check if any of the types matches any of the patterns
+func matchesAny(types, patterns []string) bool {
+	for _, t := range types {
+		for _, p := range patterns {
+			if t != "" && mediaTypeMatches(t, strings.ToLower(p)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Priority and importance headers normalization.
+
+package eml
+
+import (
+	"strings"
+)
+
+// Priority is the normalized urgency the sender assigned to the message
+type Priority int
+
+const (
+	PriorityNone Priority = iota // no priority header found
+	PriorityHighest
+	PriorityHigh
+	PriorityNormal
+	PriorityLow
+	PriorityLowest
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHighest:
+		return "highest"
+	case PriorityHigh:
+		return "high"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	case PriorityLowest:
+		return "lowest"
+	}
+	return "none"
+}
+
+// headers carrying a priority, from the most to the least precise one
+var priorityHeaders = []string{`x-priority`, `importance`, `x-msmail-priority`, `priority`}
+
+// parse the value of one of the priority headers
+func parsePriority(key string, v string) Priority {
+	v = strings.ToLower(strings.TrimSpace(v))
+
+	switch key {
+	case `x-priority`:
+		// a number from 1 to 5, usually followed by a comment
+		if len(v) > 0 && v[0] >= '1' && v[0] <= '5' {
+			return Priority(v[0]-'1') + PriorityHighest
+		}
+	case `priority`:
+		switch v {
+		case "urgent":
+			return PriorityHigh
+		case "normal":
+			return PriorityNormal
+		case "non-urgent":
+			return PriorityLow
+		}
+	case `importance`, `x-msmail-priority`:
+		switch v {
+		case "high":
+			return PriorityHigh
+		case "normal", "medium":
+			return PriorityNormal
+		case "low":
+			return PriorityLow
+		}
+	}
+
+	return PriorityNone
+}
+
+// pick the priority from the most precise header present
+func messagePriority(headers []RawHeader) Priority {
+	found := make(map[string]Priority)
+	for _, rh := range headers {
+		key := strings.ToLower(string(rh.Key))
+		if p := parsePriority(key, string(rh.Value)); p != PriorityNone {
+			if _, ok := found[key]; !ok {
+				found[key] = p
+			}
+		}
+	}
+
+	for _, k := range priorityHeaders {
+		if p, ok := found[k]; ok {
+			return p
+		}
+	}
+
+	return PriorityNone
+}
@@ -12,6 +12,7 @@ type RawHeader struct {
 type RawMessage struct {
 	RawHeaders []RawHeader
 	Body       []byte
+	BodyOffset int // position of the body at the parsed data
 }
 
 func isWSP(b byte) bool {
@@ -19,6 +20,11 @@ func isWSP(b byte) bool {
 }
 
 func ParseRaw(s []byte) (m RawMessage, e error) {
+	return parseRaw(s, make([]RawHeader, 0, 32))
+}
+
+// split the headers and the body, appending the headers to the given slice
+func parseRaw(s []byte, headers []RawHeader) (m RawMessage, e error) {
 	// parser states
 	const (
 		READY = iota
@@ -32,13 +38,11 @@ func ParseRaw(s []byte) (m RawMessage, e error) {
 		LF = '\n'
 	)
 
-	CRLF := []byte{CR, LF}
-
 	state := READY
 	kstart, kend, vstart := 0, 0, 0
 	done := false
 
-	m.RawHeaders = []RawHeader{}
+	m.RawHeaders = headers
 
 	for i := 0; i < len(s); i++ {
 		b := s[i]
@@ -47,11 +51,13 @@ func ParseRaw(s []byte) (m RawMessage, e error) {
 			if b == CR && i < len(s)-1 && s[i+1] == LF {
 				// we are at the beginning of an empty header
 				m.Body = s[i+2:]
+				m.BodyOffset = i + 2
 				done = true
 				goto Done
 			}
 			if b == LF {
 				m.Body = s[i+1:]
+				m.BodyOffset = i + 1
 				done = true
 				goto Done
 			}
@@ -71,14 +77,12 @@ func ParseRaw(s []byte) (m RawMessage, e error) {
 			}
 		case HVAL:
 			if b == CR && i < len(s)-2 && s[i+1] == LF && !isWSP(s[i+2]) {
-				v := bytes.Replace(s[vstart:i], CRLF, nil, -1)
-				hdr := RawHeader{s[kstart:kend], v}
+				hdr := RawHeader{s[kstart:kend:kend], rawValue(s[vstart:i:i])}
 				m.RawHeaders = append(m.RawHeaders, hdr)
 				state = READY
 				i++
 			} else if b == LF && i < len(s)-1 && !isWSP(s[i+1]) {
-				v := bytes.Replace(s[vstart:i], CRLF, nil, -1)
-				hdr := RawHeader{s[kstart:kend], v}
+				hdr := RawHeader{s[kstart:kend:kend], rawValue(s[vstart:i:i])}
 				m.RawHeaders = append(m.RawHeaders, hdr)
 				state = READY
 			}
@@ -90,3 +94,48 @@ Done:
 	}
 	return
 }
+
+// remove the CRLF of the folded header values, the unfolded ones being
+// kept as slices of the data, limited to their length so appending to
+// them can't overwrite it
+func rawValue(v []byte) []byte {
+	if bytes.Contains(v, []byte("\r\n")) {
+		return bytes.ReplaceAll(v, []byte("\r\n"), nil)
+	}
+	return v
+}
+
+// LineEndings selects how the line endings of the data are handled before
+// parsing
+type LineEndings int
+
+const (
+	// PreserveLineEndings parses the data as it is, accepting both CRLF
+	// and bare LF line endings
+	PreserveLineEndings LineEndings = iota
+
+	// NormalizeCRLF turns the bare LF and bare CR line endings into CRLF
+	// before parsing, the offsets referring to the normalized data
+	NormalizeCRLF
+)
+
+// convert every line ending (CRLF, bare LF or bare CR) into CRLF
+func normalizeLineEndings(s []byte) []byte {
+	out := make([]byte, 0, len(s)+len(s)/32)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			out = append(out, '\r', '\n')
+		case '\n':
+			out = append(out, '\r', '\n')
+		default:
+			out = append(out, s[i])
+		}
+	}
+
+	return out
+}
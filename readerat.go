@@ -0,0 +1,319 @@
+// Indexing of the messages stored behind an io.ReaderAt, like mmap'd files.
+
+package eml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// maximum size of the header block of a message or part at an index
+const maxIndexHeaderSize = 1 << 20
+
+// ErrHeaderTooLarge is returned by IndexReaderAt for the messages with a
+// header block, of the message or of a part, over 1 MiB
+var ErrHeaderTooLarge = errors.New("header block too large")
+
+// Index is the MIME tree of a message stored behind an io.ReaderAt, with
+// the positions of the parts but without their contents, which are read
+// and decoded on demand. Only the header blocks are kept in memory, the
+// contents are streamed, so huge spool files can be scanned without
+// loading them.
+type Index struct {
+	Headers    []RawHeader // message headers, unfolded
+	BodyOffset int64       // position of the body at the data
+	Root       Part        // MIME tree, the parts Data being always nil
+	Parts      []Part      // leaf parts of the tree, in order
+
+	r io.ReaderAt
+}
+
+// IndexReaderAt reads the structure of the message of the given size
+// stored at r. The parts offsets and lengths refer to r, and Open reads
+// their contents.
+func IndexReaderAt(r io.ReaderAt, size int64) (*Index, error) {
+	x := &Index{r: r}
+
+	raw, n, err := x.readHeaders(0, size)
+	if err != nil {
+		return nil, err
+	}
+	x.Headers, x.BodyOffset = raw.RawHeaders, n
+
+	mh := textproto.MIMEHeader{}
+	for _, rh := range raw.RawHeaders {
+		mh.Add(string(rh.Key), string(rh.Value))
+	}
+
+	ct := mh.Get("Content-Type")
+	if ct == "" {
+		ct = "text/plain; charset=us-ascii"
+	}
+
+	x.Root, err = x.indexBody(ct, mh, n, size, 0)
+	if err != nil {
+		return nil, err
+	}
+	x.Parts = x.Root.leaves()
+
+	return x, nil
+}
+
+// Raw gives the still encoded contents of a part of the index
+func (x *Index) Raw(p Part) io.Reader {
+	return io.NewSectionReader(x.r, int64(p.Offset), int64(p.Length))
+}
+
+// Open gives the contents of a part of the index with the transfer
+// encoding decoded. The charset is not converted, see UTF8.
+func (x *Index) Open(p Part) io.Reader {
+	r := x.Raw(p)
+
+	switch p.TransferEncoding {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Filter{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// ReadPart reads the decoded contents of a part of the index, the text
+// parts converted to UTF-8, the same as the Data of the parsed parts
+func (x *Index) ReadPart(p Part) ([]byte, error) {
+	data, err := io.ReadAll(x.Open(p))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(p.Type, "text/plain") || strings.Contains(p.Type, "text/html") {
+		if d, e := UTF8(p.Charset, data); e == nil {
+			data = d
+		}
+	}
+
+	return data, nil
+}
+
+// index the body at [start, end) with the given type, mirroring parseBody,
+// the multiparts nested deeper than the default limit being kept as leaves
+func (x *Index) indexBody(ct string, ph textproto.MIMEHeader, start, end int64, depth int) (root Part, err error) {
+	mt, ps, err := mime.ParseMediaType(ct)
+	if err != nil {
+		if mt, ps, err = mime.ParseMediaType(repairContentType(ct)); err != nil {
+			// keep the undecodable body as a single leaf
+			mt, ps, err = "text/plain", map[string]string{}, nil
+		}
+	}
+
+	headers := make(map[string][]string, len(ph))
+	for k, v := range ph {
+		headers[k] = v
+	}
+
+	root = newPart(mt, ps["charset"], nil, headers)
+	root.MediaType = newMediaType(mt, ps, ph.Get("Content-Type"))
+	root.Offset, root.Length, root.HeaderOffset = int(start), int(end-start), int(start)
+
+	boundary, ok := ps["boundary"]
+	if !ok || depth >= defaultMaxDepth {
+		if !ok && strings.HasPrefix(mt, "multipart") {
+			return root, errors.New("multipart specified without boundary")
+		}
+		return root, nil
+	}
+
+	bounds, err := x.splitMultipart(start, end, boundary)
+	if err != nil {
+		return root, err
+	}
+
+	root.Children = []Part{}
+	for _, b := range bounds {
+		raw, n, e := x.readHeaders(b[0], b[1])
+		if errors.Is(e, ErrHeaderTooLarge) {
+			return root, e
+		}
+		if e != nil {
+			raw, n = RawMessage{}, b[1]
+		}
+
+		header := textproto.MIMEHeader{}
+		for _, rh := range raw.RawHeaders {
+			header.Add(string(rh.Key), string(unfold(rh.Value)))
+		}
+
+		// skip the empty parts, without headers or contents
+		if len(header) == 0 && n == b[1] {
+			continue
+		}
+
+		ct := header.Get("Content-Type")
+		if ct == "" {
+			ct = "text/plain; charset=us-ascii"
+			if mt == "multipart/digest" {
+				ct = "message/rfc822"
+			}
+		}
+
+		sub, e := x.indexBody(ct, header, n, b[1], depth+1)
+		if errors.Is(e, ErrHeaderTooLarge) {
+			return root, e
+		}
+		if e != nil {
+			sub = newPart(ct, "UTF-8", nil, header)
+			sub.Offset, sub.Length = int(n), int(b[1]-n)
+		}
+
+		sub.HeaderOffset = int(b[0])
+		root.Children = append(root.Children, sub)
+	}
+
+	return root, nil
+}
+
+// read the header block starting at the given position, returning the
+// position of the body
+func (x *Index) readHeaders(start, end int64) (RawMessage, int64, error) {
+	var block []byte
+	pos := start
+	over := false
+
+	err := scanLines(x.r, start, end, func(line []byte, lineStart, lineEnd int64, complete bool) bool {
+		if int64(len(block))+int64(len(line)) > maxIndexHeaderSize {
+			over = true
+			return false
+		}
+
+		block = append(block, line...)
+		pos = lineEnd
+		return !(complete && len(bytes.TrimRight(line, "\r\n")) == 0)
+	})
+	if err != nil {
+		return RawMessage{}, 0, err
+	}
+
+	// a truncated block would give the rest of the headers as contents
+	if over {
+		return RawMessage{}, 0, ErrHeaderTooLarge
+	}
+
+	raw, err := ParseRaw(block)
+	if err != nil {
+		return raw, 0, err
+	}
+
+	return raw, pos, nil
+}
+
+// find the parts of the multipart body at [start, end), returning the
+// positions of each one, headers included, like splitMultipart
+func (x *Index) splitMultipart(start, end int64, boundary string) (parts [][2]int64, err error) {
+	delim := []byte("--" + boundary)
+	partStart := int64(-1)
+	eol := int64(0) // length of the line ending before the current line
+
+	err = scanLines(x.r, start, end, func(line []byte, lineStart, lineEnd int64, complete bool) bool {
+		defer func() {
+			switch {
+			case bytes.HasSuffix(line, []byte("\r\n")):
+				eol = 2
+			case bytes.HasSuffix(line, []byte("\n")):
+				eol = 1
+			default:
+				eol = 0
+			}
+		}()
+
+		// only the line starts can be delimiters
+		if lineEnd-int64(len(line)) != lineStart || !bytes.HasPrefix(line, delim) {
+			return true
+		}
+
+		rest := bytes.TrimRight(line[len(delim):], " \t\r\n")
+		if len(rest) != 0 && string(rest) != "--" {
+			return true
+		}
+
+		if partStart >= 0 {
+			partEnd := max(lineStart-eol, partStart)
+			parts = append(parts, [2]int64{partStart, partEnd})
+		}
+
+		// close delimiter
+		if len(rest) > 0 {
+			partStart = -1
+			return false
+		}
+
+		partStart = lineEnd
+		return true
+	})
+
+	if partStart >= 0 && partStart < end {
+		parts = append(parts, [2]int64{partStart, end})
+	}
+
+	return
+}
+
+// call fn with each line of [start, end), line ending included, until it
+// returns false. The lines over the buffer size are given in pieces, only
+// the last one being complete.
+func scanLines(r io.ReaderAt, start, end int64, fn func(line []byte, lineStart, lineEnd int64, complete bool) bool) error {
+	br := bufio.NewReaderSize(io.NewSectionReader(r, start, end-start), 64*1024)
+
+	pos, lineStart := start, start
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(chunk) > 0 {
+			complete := err != bufio.ErrBufferFull
+			if !fn(chunk, lineStart, pos+int64(len(chunk)), complete) {
+				return nil
+			}
+			pos += int64(len(chunk))
+			if complete {
+				lineStart = pos
+			}
+		}
+
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// drop the characters which are not part of the base64 alphabet, like the
+// line breaks and the whitespace, so the decoder accepts them
+type base64Filter struct {
+	r io.Reader
+}
+
+func (f *base64Filter) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+
+		k := 0
+		for _, c := range p[:n] {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '+' || c == '/' || c == '=' {
+				p[k] = c
+				k++
+			}
+		}
+
+		if k > 0 || err != nil {
+			return k, err
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var indexTests = []struct {
+	name string
+	data string
+}{
+	{
+		name: "single part",
+		data: "From: a@example.com\r\n" +
+			"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"caf=E9\r\n",
+	},
+	{
+		name: "nested with folded headers",
+		data: "From: a@example.com\r\n" +
+			"Subject: folded\r\n" +
+			" subject\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			"\tboundary=\"XX\"\r\n" +
+			"\r\n" +
+			"preamble\r\n" +
+			"--XX\r\n" +
+			"Content-Type: multipart/alternative;\r\n" +
+			" boundary=\"YY\"\r\n" +
+			"\r\n" +
+			"--YY\r\n" +
+			"Content-Type: text/plain;\r\n" +
+			" charset=utf-8\r\n" +
+			"\r\n" +
+			"plain\r\n" +
+			"--YY\r\n" +
+			"Content-Type: text/html\r\n" +
+			"\r\n" +
+			"<p>html</p>\r\n" +
+			"--YY--\r\n" +
+			"--XX\r\n" +
+			"Content-Type: application/octet-stream\r\n" +
+			"Content-Disposition: attachment;\r\n" +
+			" filename=\"a.bin\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			"aGVs\r\n" +
+			"bG8=\r\n" +
+			"--XX--\r\n" +
+			"epilogue\r\n",
+	},
+	{
+		name: "lines over the buffer",
+		data: "From: a@example.com\r\n" +
+			"X-Long: " + strings.Repeat("h", 70*1024) + "\r\n" +
+			"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+			"\r\n" +
+			"--XX\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"X-Long: " + strings.Repeat("p", 70*1024) + "\r\n" +
+			"\r\n" +
+			strings.Repeat("a", 64*1024) + "--XX\r\n" +
+			strings.Repeat("b", 200*1024) + "\r\n" +
+			"--XX\r\n" +
+			"Content-Type: application/octet-stream\r\n" +
+			"\r\n" +
+			"data\r\n" +
+			"--XX--\r\n",
+	},
+	{
+		name: "missing close delimiter",
+		data: "Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+			"\r\n" +
+			"--XX\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"first\r\n" +
+			"--XX\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"last\r\n",
+	},
+	{
+		name: "bare line feeds",
+		data: "Content-Type: multipart/mixed; boundary=\"XX\"\n" +
+			"\n" +
+			"--XX\n" +
+			"Content-Type: text/plain\n" +
+			"\n" +
+			"first\n" +
+			"--XX  \n" +
+			"\n" +
+			"no headers\n" +
+			"--XX--\n",
+	},
+}
+
+// the index has the same tree as the parser
+func TestIndexReaderAt(t *testing.T) {
+	for _, tt := range indexTests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+
+			msg, errs := Parse(data)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			x, err := IndexReaderAt(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if x.BodyOffset != int64(msg.BodyOffset) {
+				t.Errorf("body offset = %d, want %d", x.BodyOffset, msg.BodyOffset)
+			}
+			if len(x.Parts) != len(msg.Parts) {
+				t.Fatalf("got %d parts, want %d", len(x.Parts), len(msg.Parts))
+			}
+
+			for i, p := range x.Parts {
+				want := msg.Parts[i]
+				if p.Type != want.Type || p.Offset != want.Offset || p.Length != want.Length || p.HeaderOffset != want.HeaderOffset {
+					t.Errorf("part %d = %s at %d+%d (headers at %d), want %s at %d+%d (headers at %d)", i,
+						p.Type, p.Offset, p.Length, p.HeaderOffset, want.Type, want.Offset, want.Length, want.HeaderOffset)
+				}
+
+				got, err := x.ReadPart(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want.Data) {
+					t.Errorf("part %d data = %.40q, want %.40q", i, got, want.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexHeaderTooLarge(t *testing.T) {
+	long := "X-Long: " + strings.Repeat("a", maxIndexHeaderSize) + "\r\n"
+
+	for name, data := range map[string]string{
+		"message": "From: a@example.com\r\n" + long + "\r\nbody\r\n",
+		"part": "Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+			"\r\n" +
+			"--XX\r\n" +
+			long +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"body\r\n" +
+			"--XX--\r\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := IndexReaderAt(strings.NewReader(data), int64(len(data)))
+			if !errors.Is(err, ErrHeaderTooLarge) {
+				t.Errorf("got %v, want ErrHeaderTooLarge", err)
+			}
+		})
+	}
+}
+
+// the multiparts are split like splitMultipart does at the whole body
+func TestIndexSplitMultipart(t *testing.T) {
+	bodies := []string{
+		"--XX\r\nA: b\r\n\r\nfirst\r\n--XX\r\n\r\nsecond\r\n--XX--\r\nepilogue",
+		"preamble\r\n--XX\r\n\r\nfirst\r\n--XX--",
+		"--XX\r\n\r\nunclosed\r\n",
+		"--XX\n\nfirst\n--XX\t\n\nsecond\n--XX--\n",
+		"--XX\r\n\r\n" + strings.Repeat("a", 64*1024) + "--XX\r\nstill first\r\n--XX--\r\n",
+		"--XX\r\n\r\nfirst\r\n--XXY\r\nnot a delimiter\r\n--XX--\r\n",
+		"no delimiters",
+		"",
+	}
+
+	for _, body := range bodies {
+		want, _, _ := splitMultipart([]byte(body), "XX")
+
+		x := &Index{r: strings.NewReader(body)}
+		got, err := x.splitMultipart(0, int64(len(body)), "XX")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(want) {
+			t.Errorf("%.40q: got %v, want %v", body, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i][0] != int64(want[i][0]) || got[i][1] != int64(want[i][1]) {
+				t.Errorf("%.40q: got %v, want %v", body, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	data := "short\r\n" + strings.Repeat("x", 150*1024) + "\n\nlast"
+
+	type line struct {
+		start, end int64
+		complete   bool
+	}
+
+	var got []line
+	var joined []byte
+	err := scanLines(strings.NewReader("ignored"+data), 7, int64(7+len(data)), func(l []byte, start, end int64, complete bool) bool {
+		got = append(got, line{start, end, complete})
+		joined = append(joined, l...)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(joined) != data {
+		t.Errorf("lines do not add up to the data")
+	}
+
+	// the long line comes in three pieces sharing its start
+	long := int64(7 + 7)
+	want := []line{
+		{7, 14, true},
+		{long, long + 64*1024, false},
+		{long, long + 128*1024, false},
+		{long, long + 150*1024 + 1, true},
+		{long + 150*1024 + 1, long + 150*1024 + 2, true},
+		{long + 150*1024 + 2, long + 150*1024 + 6, true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// stops when asked
+	n := 0
+	scanLines(strings.NewReader(data), 0, int64(len(data)), func([]byte, int64, int64, bool) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("called %d times after stopping", n)
+	}
+}
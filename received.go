@@ -0,0 +1,168 @@
+// Received header (RFC 5321 section 4.4) parsing and delivery timelines.
+
+package eml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Received is the trace left by a relay of the message
+type Received struct {
+	From     string    `json:"from"`      // name given by the client at the greeting
+	FromInfo string    `json:"from_info"` // comment after From, usually the reverse DNS name and the client IP
+	By       string    `json:"by"`        // name of the receiving host
+	Via      string    `json:"via"`
+	With     string    `json:"with"` // protocol, like "ESMTPS"
+	ID       string    `json:"id"`
+	For      string    `json:"for"`
+	Date     time.Time `json:"date"` // zero when missing or unparseable
+}
+
+// clauses of the Received values
+var receivedKeys = map[string]bool{
+	"from": true, "by": true, "via": true, "with": true, "id": true, "for": true,
+}
+
+// ParseReceived parses the value of a Received header. The clauses are
+// taken in any order, as some relays don't follow the RFC one, and an
+// error is returned when the date is missing or can't be parsed.
+func ParseReceived(v []byte) (r Received, err error) {
+	s := string(unfold(v))
+
+	// the date goes after the last semicolon
+	clauses, date := s, ""
+	if i := strings.LastIndexByte(s, ';'); i >= 0 {
+		clauses, date = s[:i], s[i+1:]
+	}
+
+	key := ""
+	values := make(map[string][]string)
+	for _, t := range receivedTokens(clauses) {
+		switch {
+		case strings.HasPrefix(t, "("):
+			if key == "from" {
+				r.FromInfo = strings.TrimSpace(strings.Join([]string{r.FromInfo, t[1 : len(t)-1]}, " "))
+			}
+		case receivedKeys[strings.ToLower(t)] && (key == "" || len(values[key]) > 0):
+			key = strings.ToLower(t)
+		case key != "":
+			values[key] = append(values[key], t)
+		}
+	}
+
+	r.From = strings.Join(values["from"], " ")
+	r.By = strings.Join(values["by"], " ")
+	r.Via = strings.Join(values["via"], " ")
+	r.With = strings.Join(values["with"], " ")
+	r.ID = strings.Join(values["id"], " ")
+	r.For = strings.Trim(strings.Join(values["for"], " "), "<>")
+
+	if strings.TrimSpace(date) == "" {
+		return r, errors.New("received without date")
+	}
+	r.Date, err = ParseDateErr(date)
+	return
+}
+
+// split the clauses of a Received value into words and whole comments
+func receivedTokens(s string) (l []string) {
+	start, depth := -1, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case depth > 0:
+			if c == '\\' {
+				i++
+			} else if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth--; depth == 0 {
+					l = append(l, s[start:i+1])
+					start = -1
+				}
+			}
+		case c == '(':
+			if start >= 0 {
+				l = append(l, s[start:i])
+			}
+			start, depth = i, 1
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if start >= 0 {
+				l = append(l, s[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+
+	// a comment left open runs to the end
+	if start >= 0 {
+		if depth > 0 {
+			l = append(l, s[start:]+")")
+		} else {
+			l = append(l, s[start:])
+		}
+	}
+	return
+}
+
+// TimelineHop is a relay of the message at its DeliveryTimeline
+type TimelineHop struct {
+	Received Received      `json:"received"`
+	Delay    time.Duration `json:"delay"`  // since the previous hop, or since the Date for the first one
+	Skewed   bool          `json:"skewed"` // earlier than the previous hop, the clocks disagreeing
+}
+
+// DeliveryTimeline is the path of a message through its relays
+type DeliveryTimeline struct {
+	Sent      time.Time     `json:"sent"`      // from the Date header, zero when missing or unparseable
+	Hops      []TimelineHop `json:"hops"`      // the oldest first
+	Transit   time.Duration `json:"transit"`   // from the Date to the last Received
+	Anomalies []string      `json:"anomalies"` // clock skews and dates missing
+}
+
+// DeliveryTimeline orders the Received headers from the first relay to the
+// last one, timing each hop and the whole transit from the Date. The hops
+// going back in time reveal a relay with a wrong clock, or forged headers.
+func (msg Message) DeliveryTimeline() (t DeliveryTimeline) {
+	if d, err := ParseDateErr(msg.Header("Date")); err == nil {
+		t.Sent = d
+	} else {
+		t.Anomalies = append(t.Anomalies, "missing or unparseable Date")
+	}
+
+	// the relays add their header at the top
+	prev := t.Sent
+	for i := len(msg.Received) - 1; i >= 0; i-- {
+		h := TimelineHop{Received: msg.Received[i]}
+		n := len(t.Hops) + 1
+
+		switch {
+		case h.Received.Date.IsZero():
+			t.Anomalies = append(t.Anomalies, fmt.Sprintf("hop %d by %q without date", n, h.Received.By))
+		case !prev.IsZero():
+			h.Delay = h.Received.Date.Sub(prev)
+			if h.Delay < 0 {
+				h.Skewed = true
+				t.Anomalies = append(t.Anomalies, fmt.Sprintf("hop %d by %q is %s earlier than the previous one", n, h.Received.By, -h.Delay))
+			}
+		}
+
+		if !h.Received.Date.IsZero() {
+			prev = h.Received.Date
+		}
+		t.Hops = append(t.Hops, h)
+	}
+
+	if !t.Sent.IsZero() && !prev.IsZero() {
+		t.Transit = prev.Sub(t.Sent)
+	}
+
+	return
+}
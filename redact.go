@@ -0,0 +1,236 @@
+// Personal data redaction of the raw messages.
+
+package eml
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// RedactMode selects how the personal data is hidden
+type RedactMode int
+
+const (
+	// RedactBlank replaces the data by fixed placeholders
+	RedactBlank RedactMode = iota
+	// RedactPseudonymize replaces the data by pseudonyms derived from it,
+	// the same value getting always the same pseudonym
+	RedactPseudonymize
+)
+
+// RedactOptions configures Redact
+type RedactOptions struct {
+	Mode RedactMode
+
+	// Secret is the key of the pseudonyms, so they can't be reversed by
+	// guessing the values
+	Secret []byte
+
+	// Headers are the fields redacted, the recipients, Received and the
+	// originating IP ones when empty. The address lists are replaced as a
+	// whole, the other fields get their addresses and IPs replaced.
+	Headers []string
+
+	// ScrubBodies replaces the addresses and phone numbers at the text
+	// parts
+	ScrubBodies bool
+}
+
+// header fields redacted by default
+var redactedHeaders = []string{
+	`to`, `cc`, `bcc`, `delivered-to`, `x-original-to`, `received`,
+	`x-originating-ip`, `x-sender-ip`, `x-forwarded-for`,
+}
+
+// headers holding address lists
+var addressHeaders = map[string]bool{
+	`from`: true, `sender`: true, `reply-to`: true, `to`: true, `cc`: true, `bcc`: true,
+	`resent-from`: true, `resent-sender`: true, `resent-to`: true, `resent-cc`: true, `resent-bcc`: true,
+	`disposition-notification-to`: true, `return-receipt-to`: true,
+}
+
+var (
+	redactEmailR = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+`)
+	redactIPv4R  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	redactIPv6R  = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}`)
+	redactPhoneR = regexp.MustCompile(`\+?\(?\d[\d ().\-]{6,}\d`)
+	redactDateR  = regexp.MustCompile(`^\d{1,4}[-./]\d{1,2}[-./]\d{1,4}$`)
+)
+
+// Redact builds a copy of the raw message with the personal data hidden,
+// to share samples. The untouched header fields and parts are kept byte by
+// byte.
+func (msg Message) Redact(opts RedactOptions) []byte {
+	r := redactor{opts}
+
+	names := opts.Headers
+	if len(names) == 0 {
+		names = redactedHeaders
+	}
+
+	// work on a copy, only the raw data is needed
+	m := msg
+	m.ParsedHeaders = nil
+
+	fields := m.headerFields()
+	for i, f := range fields {
+		name := headerFieldName(f)
+		found := false
+		for _, n := range names {
+			found = found || strings.EqualFold(n, name)
+		}
+		if !found {
+			continue
+		}
+
+		k, v, _ := strings.Cut(string(f), ":")
+		v = strings.TrimSpace(string(unfold([]byte(v))))
+
+		if addressHeaders[name] {
+			v = r.addresses(v)
+		} else {
+			v = r.text(v, false)
+		}
+
+		if nf, err := newField(k, v, m.lineEnding()); err == nil {
+			fields[i] = nf
+		}
+	}
+	m.setHeaderFields(fields)
+
+	if !opts.ScrubBodies {
+		return m.Raw()
+	}
+
+	// the text parts are written back as UTF-8
+	edits := make(map[int]partEdit)
+	m.Walk(func(p *Part, depth int) error {
+		if p.Children != nil || !(mediaTypeMatches(p.Type, "text/plain") || mediaTypeMatches(p.Type, "text/html")) {
+			return nil
+		}
+		if _, ok := p.attachment(); ok {
+			return nil
+		}
+
+		encoding, data := EncodeBody([]byte(r.text(string(p.Data), true)), false)
+		edits[p.HeaderOffset] = partEdit{
+			set: [][2]string{
+				{"Content-Type", mime.FormatMediaType(strings.ToLower(p.Type), map[string]string{"charset": "utf-8"})},
+				{"Content-Transfer-Encoding", encoding},
+			},
+			body: data,
+		}
+		return nil
+	})
+
+	return m.editParts(edits)
+}
+
+type redactor struct {
+	opts RedactOptions
+}
+
+// get the pseudonym of a value
+func (r redactor) hash(v string) []byte {
+	h := hmac.New(sha256.New, r.opts.Secret)
+	h.Write([]byte(strings.ToLower(v)))
+	return h.Sum(nil)
+}
+
+func (r redactor) email(v string) string {
+	if r.opts.Mode == RedactBlank {
+		return "redacted@redacted.invalid"
+	}
+	return "user-" + hex.EncodeToString(r.hash(v)[:4]) + "@redacted.invalid"
+}
+
+func (r redactor) ip(v string) string {
+	ip := net.ParseIP(v)
+	if r.opts.Mode == RedactBlank {
+		if ip.To4() != nil {
+			return "0.0.0.0"
+		}
+		return "::"
+	}
+
+	h := r.hash(v)
+	if ip.To4() != nil {
+		return fmt.Sprintf("10.%d.%d.%d", h[0], h[1], h[2])
+	}
+	return fmt.Sprintf("fd00::%x:%x", uint16(h[0])<<8|uint16(h[1]), uint16(h[2])<<8|uint16(h[3]))
+}
+
+func (r redactor) phone(v string) string {
+	if r.opts.Mode == RedactBlank {
+		return "[phone]"
+	}
+	return "[phone-" + hex.EncodeToString(r.hash(v)[:4]) + "]"
+}
+
+// replace a whole address list, keeping only the pseudonyms of the
+// mailboxes
+func (r redactor) addresses(v string) string {
+	al, _ := parseAddressList([]byte(v))
+
+	var l []string
+	for _, a := range al {
+		switch a := a.(type) {
+		case MailboxAddr:
+			l = append(l, r.email(a.Email()))
+		case GroupAddr:
+			for _, b := range a.boxes {
+				l = append(l, r.email(b.Email()))
+			}
+		}
+	}
+
+	if len(l) == 0 || r.opts.Mode == RedactBlank {
+		return "undisclosed-recipients:;"
+	}
+	return strings.Join(l, ", ")
+}
+
+// replace the addresses, IPs and optionally phone numbers of a text
+func (r redactor) text(v string, phones bool) string {
+	v = redactEmailR.ReplaceAllStringFunc(v, r.email)
+	v = redactIPv4R.ReplaceAllStringFunc(v, func(s string) string {
+		if net.ParseIP(s) == nil {
+			return s
+		}
+		return r.ip(s)
+	})
+	v = redactIPv6R.ReplaceAllStringFunc(v, func(s string) string {
+		if net.ParseIP(s) == nil {
+			return s
+		}
+		return r.ip(s)
+	})
+
+	if phones {
+		v = redactPhoneR.ReplaceAllStringFunc(v, func(s string) string {
+			if redactDateR.MatchString(s) {
+				return s
+			}
+
+			// too few digits for a phone number
+			digits := 0
+			for _, c := range s {
+				if c >= '0' && c <= '9' {
+					digits++
+				}
+			}
+			if digits < 7 {
+				return s
+			}
+			return r.phone(s)
+		})
+	}
+
+	return v
+}
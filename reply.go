@@ -0,0 +1,287 @@
+// Reply and forward messages builders.
+
+package eml
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ReplyOptions configures the messages built by Reply and ReplyAll
+type ReplyOptions struct {
+	From    Address          // address of the one replying, left out of the recipients
+	Text    string           // reply text, placed before the quoted original
+	NoQuote bool             // do not quote the original text
+	Now     func() time.Time // clock for the reply date, time.Now when nil
+}
+
+// the reply and forward prefixes used by the mail clients in several
+// languages, with the optional counters some of them add ("Re[2]:"). The
+// single letter ones ("R:", "I:") must be followed by the colon.
+const (
+	replyPrefixes   = `re|aw|sv|vs|antw|ref|réf|rif|odp|ynt|atb|vá|回复|回覆|答复`
+	forwardPrefixes = `fwd?|wg|tr|rv|enc|doorst|vb|vl|转发|轉寄`
+)
+
+var (
+	subjectPrefixR = prefixRegexp(replyPrefixes+`|`+forwardPrefixes, `r|i`)
+	replyPrefixR   = prefixRegexp(replyPrefixes, `r`)
+	forwardPrefixR = prefixRegexp(forwardPrefixes, `i`)
+)
+
+// match a run of subject prefixes
+func prefixRegexp(prefixes, letters string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^(?:\s*(?:(?:` + prefixes + `)\s*(?:\[\d+\]|\(\d+\))?\s*|(?:` + letters + `))[:：])+\s*`)
+}
+
+// Reply builds the reply to the message author, sent to the Reply-To
+// addresses when present. The reply is composed, Raw giving its data, with
+// a new Message-ID (see Compose), the composition errors being returned.
+func (msg Message) Reply(opts ReplyOptions) (Message, error) {
+	r := msg.replyBase(opts)
+	r.To = msg.replyRecipients(opts.From)
+
+	if err := r.compose(); err != nil {
+		return Message{}, err
+	}
+	return r, nil
+}
+
+// ReplyAll builds the reply to the author and all the other recipients of
+// the message, the ones at To going to To and the ones at Cc to Cc. The
+// reply is composed like at Reply.
+func (msg Message) ReplyAll(opts ReplyOptions) (Message, error) {
+	r := msg.replyBase(opts)
+
+	var seen []Address
+	add := func(dst []Address, al []Address) []Address {
+		for _, a := range al {
+			if isDuplicate(a, seen) || (opts.From != nil && AddressesEqual(a, opts.From)) {
+				continue
+			}
+			seen = append(seen, a)
+			dst = append(dst, a)
+		}
+		return dst
+	}
+
+	r.To = add(r.To, msg.replyRecipients(opts.From))
+	r.To = add(r.To, msg.To)
+	r.Cc = add(r.Cc, msg.Cc)
+
+	if err := r.compose(); err != nil {
+		return Message{}, err
+	}
+	return r, nil
+}
+
+// the addresses the author wants the replies sent to
+func (msg Message) replyRecipients(self Address) []Address {
+	// replying to an own message goes to the original recipients
+	if self != nil && len(msg.ReplyTo) == 0 && len(msg.From) > 0 && AddressesEqual(msg.From[0], self) {
+		return msg.To
+	}
+
+	if len(msg.ReplyTo) > 0 {
+		return msg.ReplyTo
+	}
+	return msg.From
+}
+
+// build the subject, threading headers and text shared by the replies
+func (msg Message) replyBase(opts ReplyOptions) (r Message) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	r.Date = now()
+	r.Subject = "Re: " + replyPrefixR.ReplaceAllString(msg.Subject, "")
+
+	if opts.From != nil {
+		r.From = []Address{opts.From}
+		r.Sender = opts.From
+	}
+
+	// the references chain falls back to In-Reply-To (RFC 5322 section
+	// 3.6.4) and ends with the message being replied
+	refs := msg.References
+	if len(refs) == 0 && len(msg.InReply) == 1 {
+		refs = msg.InReply
+	}
+	r.References = append([]string{}, refs...)
+
+	if msg.MessageID != "" {
+		r.InReply = []string{msg.MessageID}
+		r.References = append(r.References, msg.MessageID)
+	}
+
+	r.Text = opts.Text
+	if !opts.NoQuote {
+		if r.Text != "" && !strings.HasSuffix(r.Text, "\n") {
+			r.Text += "\n"
+		}
+		r.Text += "\n" + msg.attribution() + "\n" + quoteText(msg.Text)
+	}
+
+	return
+}
+
+// the line introducing the quoted original
+func (msg Message) attribution() string {
+	who := "someone"
+	if len(msg.From) > 0 {
+		who = msg.From[0].String()
+	}
+
+	if msg.Date.IsZero() {
+		return fmt.Sprintf("%s wrote:", who)
+	}
+	return fmt.Sprintf("On %s, %s wrote:", msg.Date.Format("Mon, 2 Jan 2006 at 15:04"), who)
+}
+
+// StripSubjectPrefixes removes the reply and forward prefixes ("Re:",
+// "AW:", "Fwd:", "WG:", etc.) from the start of a subject
+func StripSubjectPrefixes(subject string) string {
+	return subjectPrefixR.ReplaceAllString(subject, "")
+}
+
+// quote each line of a text with ">"
+func quoteText(t string) string {
+	t = strings.TrimRight(strings.ReplaceAll(t, "\r\n", "\n"), "\n")
+
+	var b strings.Builder
+	for _, l := range strings.Split(t, "\n") {
+		if strings.HasPrefix(l, ">") || l == "" {
+			b.WriteString(">" + l + "\n")
+		} else {
+			b.WriteString("> " + l + "\n")
+		}
+	}
+	return b.String()
+}
+
+// check if the address is already at the list
+func isDuplicate(a Address, al []Address) bool {
+	for _, o := range al {
+		if AddressesEqual(a, o) || (a.Email() == "" && a.String() == o.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardOptions configures the messages built by Forward
+type ForwardOptions struct {
+	From         Address          // address of the one forwarding
+	To           []Address        // recipients of the forwarded message
+	Text         string           // text placed before the forwarded contents
+	AsAttachment bool             // embed the original as a message/rfc822 part instead of inline
+	Now          func() time.Time // clock for the message date, time.Now when nil
+}
+
+// Forward builds a message that forwards this one, either inline, with a
+// summary of the original headers followed by its text and attachments, or
+// with the whole original message attached. The message is composed like
+// at Reply.
+func (msg Message) Forward(opts ForwardOptions) (Message, error) {
+	var f Message
+
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	f.Date = now()
+	f.Subject = "Fwd: " + forwardPrefixR.ReplaceAllString(msg.Subject, "")
+	f.To = opts.To
+	if opts.From != nil {
+		f.From = []Address{opts.From}
+		f.Sender = opts.From
+	}
+
+	f.Text = opts.Text
+
+	if opts.AsAttachment {
+		p := Part{
+			Type:        "message/rfc822",
+			MediaType:   newMediaType("message/rfc822", map[string]string{}, "message/rfc822"),
+			Data:        msg.Raw(),
+			Disposition: "attachment",
+			Filename:    StripSubjectPrefixes(msg.Subject) + ".eml",
+		}
+		if p.Filename == ".eml" {
+			p.Filename = "forwarded.eml"
+		}
+		p.Headers = map[string][]string{
+			"Content-Type":        {"message/rfc822"},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": p.Filename})},
+		}
+
+		f.Parts = []Part{p}
+		f.Attachments = []Attachment{{Filename: p.Filename, Data: p.Data, ContentType: p.Type}}
+		if err := f.compose(); err != nil {
+			return Message{}, err
+		}
+		return f, nil
+	}
+
+	if f.Text != "" && !strings.HasSuffix(f.Text, "\n") {
+		f.Text += "\n"
+	}
+	f.Text += "\n" + msg.forwardSummary() + "\n" + strings.ReplaceAll(msg.Text, "\r\n", "\n")
+
+	if msg.Html != "" {
+		summary := html.EscapeString(msg.forwardSummary())
+		f.Html = html.EscapeString(opts.Text) + "<br><br><div>" +
+			strings.ReplaceAll(summary, "\n", "<br>") + "</div><br>" + msg.Html
+	}
+
+	// the original attachments go along
+	for _, a := range msg.Attachments {
+		a.Data = append([]byte{}, a.Data...)
+		f.Attachments = append(f.Attachments, a)
+	}
+
+	if err := f.compose(); err != nil {
+		return Message{}, err
+	}
+	return f, nil
+}
+
+// the block of original headers shown at the inline forwards
+func (msg Message) forwardSummary() string {
+	list := func(al []Address) string {
+		l := []string{}
+		for _, a := range al {
+			l = append(l, displayAddress(a))
+		}
+		return strings.Join(l, ", ")
+	}
+
+	var b strings.Builder
+	b.WriteString("---------- Forwarded message ---------\n")
+	fmt.Fprintf(&b, "From: %s\n", list(msg.From))
+	if !msg.Date.IsZero() {
+		fmt.Fprintf(&b, "Date: %s\n", msg.Date.Format("Mon, 2 Jan 2006 at 15:04"))
+	}
+	fmt.Fprintf(&b, "Subject: %s\n", msg.Subject)
+	fmt.Fprintf(&b, "To: %s\n", list(msg.To))
+	if len(msg.Cc) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\n", list(msg.Cc))
+	}
+
+	return b.String()
+}
+
+// format an address for reading, with the display name decoded
+func displayAddress(a Address) string {
+	if a.Email() == "" || a.Name() == a.Email() {
+		return a.String()
+	}
+	return fmt.Sprintf("%s <%s>", a.Name(), a.Email())
+}
@@ -0,0 +1,219 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+const replyOriginal = "From: Alice <alice@example.com>\r\n" +
+	"To: Bob <bob@example.com>, carol@example.com\r\n" +
+	"Cc: dave@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9?= test\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"References: <root@example.com>\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+	"\r\n" +
+	"Caf\xc3\xa9 plain\r\n"
+
+func TestReplyCompose(t *testing.T) {
+	orig, errs := Parse([]byte(replyOriginal))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	bob := orig.To[0]
+
+	tests := []struct {
+		name  string
+		reply func(ReplyOptions) (Message, error)
+		to    []string
+		cc    []string
+	}{
+		{"reply", orig.Reply, []string{"alice@example.com"}, nil},
+		{"reply all", orig.ReplyAll, []string{"alice@example.com", "carol@example.com"}, []string{"dave@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.reply(ReplyOptions{From: bob, Text: "ça va"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, errs := Parse(r.Raw())
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			if p.Subject != "Re: Café test" {
+				t.Errorf("subject = %q", p.Subject)
+			}
+			if p.MessageID == "" || p.MessageID != r.MessageID {
+				t.Errorf("message id = %q, want %q", p.MessageID, r.MessageID)
+			}
+			if strings.Join(p.InReply, " ") != "abc@example.com" {
+				t.Errorf("in-reply-to = %v", p.InReply)
+			}
+			if strings.Join(p.References, " ") != "root@example.com abc@example.com" {
+				t.Errorf("references = %v", p.References)
+			}
+			if len(p.From) != 1 || p.From[0].Email() != "bob@example.com" {
+				t.Errorf("from = %v", p.From)
+			}
+			if got := emails(p.To); got != strings.Join(tt.to, " ") {
+				t.Errorf("to = %q, want %q", got, tt.to)
+			}
+			if got := emails(p.Cc); got != strings.Join(tt.cc, " ") {
+				t.Errorf("cc = %q, want %q", got, tt.cc)
+			}
+			if !strings.HasPrefix(p.Text, "ça va") || !strings.Contains(p.Text, "> Café plain") {
+				t.Errorf("text = %q", p.Text)
+			}
+		})
+	}
+}
+
+func TestReplySubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		reply   string
+		forward string
+	}{
+		{"hello", "Re: hello", "Fwd: hello"},
+		{"Re: hello", "Re: hello", "Fwd: Re: hello"},
+		{"RE[2]: AW: hello", "Re: hello", "Fwd: RE[2]: AW: hello"},
+		{"Fwd: hello", "Re: Fwd: hello", "Fwd: hello"},
+		{"WG: TR: hello", "Re: WG: TR: hello", "Fwd: hello"},
+		{"R: hello", "Re: hello", "Fwd: R: hello"},
+		{"I: hello", "Re: I: hello", "Fwd: hello"},
+		{"I want this", "Re: I want this", "Fwd: I want this"},
+		{"R [2]: hello", "Re: R [2]: hello", "Fwd: R [2]: hello"},
+		{"Re: Fwd: hello", "Re: Fwd: hello", "Fwd: Re: Fwd: hello"},
+		{"回复：hello", "Re: hello", "Fwd: 回复：hello"},
+	}
+
+	for _, tt := range tests {
+		orig := Message{Subject: tt.subject, From: []Address{MailboxAddr{local: "a", domain: "example.com"}}}
+
+		r, err := orig.Reply(ReplyOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Subject != tt.reply {
+			t.Errorf("reply to %q = %q, want %q", tt.subject, r.Subject, tt.reply)
+		}
+
+		f, err := orig.Forward(ForwardOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Subject != tt.forward {
+			t.Errorf("forward of %q = %q, want %q", tt.subject, f.Subject, tt.forward)
+		}
+	}
+}
+
+// the composition errors are returned, not an empty message
+func TestReplyComposeError(t *testing.T) {
+	orig, errs := Parse([]byte(replyOriginal))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	bad := MailboxAddr{local: "bob", domain: "bad_domain..example"}
+
+	if r, err := orig.Reply(ReplyOptions{From: bad}); err == nil {
+		t.Errorf("reply: no error, got %q", r.Raw())
+	}
+	if r, err := orig.ReplyAll(ReplyOptions{From: bad}); err == nil {
+		t.Errorf("reply all: no error, got %q", r.Raw())
+	}
+	if f, err := orig.Forward(ForwardOptions{From: bad}); err == nil {
+		t.Errorf("forward: no error, got %q", f.Raw())
+	}
+	if f, err := orig.Forward(ForwardOptions{From: bad, AsAttachment: true}); err == nil {
+		t.Errorf("forward as attachment: no error, got %q", f.Raw())
+	}
+}
+
+func emails(al []Address) string {
+	l := []string{}
+	for _, a := range al {
+		l = append(l, a.Email())
+	}
+	return strings.Join(l, " ")
+}
+
+const forwardOriginal = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: Report\r\n" +
+	"Message-ID: <report@example.com>\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	".see the report\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--XX--\r\n"
+
+func TestForwardCompose(t *testing.T) {
+	orig, errs := Parse([]byte(forwardOriginal))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	to, _ := ParseAddress([]byte("carol@example.com"))
+
+	t.Run("inline", func(t *testing.T) {
+		f, err := orig.Forward(ForwardOptions{From: orig.To[0], To: []Address{to}, Text: "FYI"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, errs := Parse(f.Raw())
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if p.Subject != "Fwd: Report" || emails(p.To) != "carol@example.com" {
+			t.Errorf("subject = %q, to = %v", p.Subject, p.To)
+		}
+		if !strings.HasPrefix(p.Text, "FYI") || !strings.Contains(p.Text, ".see the report") {
+			t.Errorf("text = %q", p.Text)
+		}
+		if len(p.Attachments) != 1 || p.Attachments[0].Filename != "report.pdf" || string(p.Attachments[0].Data) != "%PDF-1.4\n" {
+			t.Errorf("attachments = %+v", p.Attachments)
+		}
+	})
+
+	t.Run("as attachment", func(t *testing.T) {
+		f, err := orig.Forward(ForwardOptions{From: orig.To[0], To: []Address{to}, Text: "FYI", AsAttachment: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, errs := Parse(f.Raw())
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		parts := p.PartsByType("message/rfc822")
+		if len(parts) != 1 {
+			t.Fatalf("got %d message parts", len(parts))
+		}
+		if te := parts[0].TransferEncoding; te != "7bit" {
+			t.Errorf("message part encoded as %q", te)
+		}
+
+		inner, errs := parts[0].Message()
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if inner.MessageID != "report@example.com" || len(inner.Attachments) != 1 {
+			t.Errorf("inner message id = %q, %d attachments", inner.MessageID, len(inner.Attachments))
+		}
+	})
+}
@@ -0,0 +1,50 @@
+// Preparation of the received messages to be sent again.
+
+package eml
+
+import (
+	"time"
+)
+
+// PrepareForResend removes the header fields added during the transport,
+// like Received, Return-Path, Delivered-To, the DKIM and ARC signatures
+// and the spam filter results, and sets a new Date and Message-ID. The
+// message data to inject again over SMTP is returned, the Bcc fields being
+// kept, see Serialize to remove them. The domain of the new ID is the one
+// of the first From address, or the host name.
+//
+// The other fields and the body are kept byte by byte. Like SetHeader,
+// only the raw headers and the fields of the transport are updated, the
+// message must be parsed again for the rest.
+func (msg *Message) PrepareForResend() ([]byte, error) {
+	var kept [][]byte
+	for _, f := range msg.headerFields() {
+		if name := headerFieldName(f); isTransportHeader(name) {
+			msg.removeParsedHeader(name)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	msg.setHeaderFields(kept)
+	msg.Received, msg.Envelope = nil, Envelope{}
+
+	domain := ""
+	if len(msg.From) > 0 {
+		domain = msg.From[0].Domain()
+	}
+	id, err := GenerateMessageID(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	date := time.Now()
+	if err := msg.SetHeader(`Date`, date.Format(time.RFC1123Z)); err != nil {
+		return nil, err
+	}
+	if err := msg.SetHeader(`Message-ID`, "<"+id+">"); err != nil {
+		return nil, err
+	}
+	msg.Date, msg.MessageID = date, id
+
+	return msg.Raw(), nil
+}
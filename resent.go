@@ -0,0 +1,77 @@
+// Resent-* headers (RFC 5322 section 3.6.6) handling.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResentBlock groups the Resent-* headers added by a single redistribution
+// of the message
+type ResentBlock struct {
+	Date      time.Time `json:"date"`
+	From      []Address `json:"from"`
+	Sender    Address   `json:"sender"`
+	To        []Address `json:"to"`
+	Cc        []Address `json:"cc"`
+	Bcc       []Address `json:"bcc"`
+	MessageID string    `json:"message_id"`
+}
+
+// group the Resent-* headers into blocks. Each redistribution prepends its
+// own block, so a block ends when a non resent header shows up or when one
+// of its fields repeats.
+func parseResentBlocks(headers []RawHeader, opts ParseOptions) (blocks []ResentBlock, errors []error) {
+	var seen map[string]bool
+	inBlock := false
+
+	for _, rh := range headers {
+		key := strings.ToLower(string(rh.Key))
+		if !strings.HasPrefix(key, `resent-`) {
+			inBlock = false
+			continue
+		}
+
+		if !inBlock || seen[key] {
+			blocks = append(blocks, ResentBlock{})
+			seen = make(map[string]bool)
+			inBlock = true
+		}
+		seen[key] = true
+
+		b := &blocks[len(blocks)-1]
+
+		var err error
+		switch key {
+		case `resent-date`:
+			b.Date, err = parseDate(string(rh.Value), opts.location())
+			if err != nil {
+				b.Date = opts.now()
+			}
+		case `resent-from`:
+			b.From, err = parseAddressList(rh.Value)
+		case `resent-sender`:
+			b.Sender, err = ParseAddress(rh.Value)
+			if err != nil {
+				b.Sender = RawAddress{raw: string(bytes.TrimSpace(rh.Value))}
+			}
+		case `resent-to`:
+			b.To, err = parseAddressList(rh.Value)
+		case `resent-cc`:
+			b.Cc, err = parseAddressList(rh.Value)
+		case `resent-bcc`:
+			b.Bcc, err = parseAddressList(rh.Value)
+		case `resent-message-id`:
+			b.MessageID = string(bytes.Trim(bytes.TrimSpace(rh.Value), `<>`))
+		}
+
+		if err != nil {
+			errors = append(errors, fmt.Errorf("header parser: %v", err))
+		}
+	}
+
+	return
+}
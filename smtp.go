@@ -0,0 +1,170 @@
+// Submission of the messages over SMTP.
+
+package eml
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPConfig tells Send where and how to submit the messages
+type SMTPConfig struct {
+	Addr      string      // host and port of the server, like "smtp.example.com:587"
+	Auth      smtp.Auth   // authentication after STARTTLS, none when nil
+	TLSConfig *tls.Config // for STARTTLS, checking the host of Addr when nil
+	LocalName string      // name given at the greeting, "localhost" when empty
+
+	// From is the envelope sender, the Sender or the first From address
+	// of the message when empty
+	From string
+
+	// Bcc tells how the Bcc recipients get the message, see Serialize
+	Bcc BccPolicy
+
+	// DKIM signs each copy of the message when set, see SignData
+	DKIM *DKIMOptions
+
+	// AllowPlaintext sends the message, and the credentials, without TLS
+	// when the server doesn't offer STARTTLS
+	AllowPlaintext bool
+}
+
+// Send submits the message to the recipients of its To, Cc and Bcc
+// addresses, in a mail transaction for each copy composed by Serialize with
+// the Bcc policy of the config. The lines starting by a dot are escaped by
+// the SMTP client. The context bounds the whole session.
+func Send(ctx context.Context, msg Message, cfg SMTPConfig) error {
+	if msg.Text == "" && msg.Html == "" && len(msg.Attachments) == 0 {
+		return errors.New("smtp: empty message")
+	}
+
+	copies, err := msg.Serialize(cfg.Bcc)
+	if err != nil {
+		return err
+	}
+	if cfg.DKIM != nil {
+		for i := range copies {
+			if copies[i].Data, err = SignData(copies[i].Data, *cfg.DKIM); err != nil {
+				return err
+			}
+		}
+	}
+
+	from := cfg.From
+	if from == "" {
+		from = envelopeSender(msg)
+	}
+	if from == "" {
+		return errors.New("smtp: missing envelope sender")
+	}
+
+	rcpts := 0
+	for _, c := range copies {
+		rcpts += len(c.Recipients)
+	}
+	if rcpts == 0 {
+		return errors.New("smtp: no recipients")
+	}
+
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := sendSMTP(conn, host, from, copies, cfg); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// run the SMTP session over the connection
+func sendSMTP(conn net.Conn, host, from string, copies []SerializedMessage, cfg SMTPConfig) error {
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.LocalName != "" {
+		if err := c.Hello(cfg.LocalName); err != nil {
+			return err
+		}
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tc := cfg.TLSConfig
+		if tc == nil {
+			tc = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(tc); err != nil {
+			return err
+		}
+	} else if !cfg.AllowPlaintext {
+		return errors.New("server doesn't support STARTTLS")
+	}
+
+	if cfg.Auth != nil {
+		if err := c.Auth(cfg.Auth); err != nil {
+			return err
+		}
+	}
+
+	for _, cp := range copies {
+		if len(cp.Recipients) == 0 {
+			continue
+		}
+
+		if err := c.Mail(from); err != nil {
+			return err
+		}
+		for _, r := range cp.Recipients {
+			if err := c.Rcpt(r.Email()); err != nil {
+				return fmt.Errorf("recipient %s: %w", r.Email(), err)
+			}
+		}
+
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(cp.Data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return c.Quit()
+}
+
+// get the envelope sender of a message, from the Sender or the first From
+// address
+func envelopeSender(msg Message) string {
+	if msg.Sender != nil && msg.Sender.Email() != "" {
+		return msg.Sender.Email()
+	}
+	if l := mailboxes(msg.From); len(l) > 0 {
+		return l[0].Email()
+	}
+	return ""
+}
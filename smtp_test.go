@@ -0,0 +1,118 @@
+package eml
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake SMTP server recording the transactions, without STARTTLS
+type smtpRecorder struct {
+	mu           sync.Mutex
+	transactions []string // recipients and data of each one
+}
+
+func (s *smtpRecorder) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	fmt.Fprintf(c, "220 test\r\n")
+
+	var rcpts []string
+	var data strings.Builder
+	inData := false
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if inData {
+			if l != ".\r\n" {
+				data.WriteString(l)
+				continue
+			}
+			s.mu.Lock()
+			s.transactions = append(s.transactions, strings.Join(rcpts, " ")+"\n"+data.String())
+			s.mu.Unlock()
+			rcpts, inData = nil, false
+			data.Reset()
+			fmt.Fprintf(c, "250 queued\r\n")
+			continue
+		}
+
+		switch cmd := strings.ToUpper(l[:4]); cmd {
+		case "EHLO":
+			fmt.Fprintf(c, "250-test\r\n250 8BITMIME\r\n")
+		case "RCPT":
+			rcpts = append(rcpts, strings.Trim(strings.TrimSpace(l[8:]), "<>"))
+			fmt.Fprintf(c, "250 ok\r\n")
+		case "DATA":
+			inData = true
+			fmt.Fprintf(c, "354 go on\r\n")
+		case "QUIT":
+			fmt.Fprintf(c, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprintf(c, "250 ok\r\n")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	rec := &smtpRecorder{}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go rec.serve(c)
+		}
+	}()
+
+	orig, _ := Parse([]byte(replyOriginal))
+	reply, err := orig.Reply(ReplyOptions{From: orig.To[0], Text: ".leading dot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := SMTPConfig{Addr: ln.Addr().String()}
+	if err := Send(ctx, reply, cfg); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("plaintext send: %v", err)
+	}
+
+	cfg.AllowPlaintext = true
+	if err := Send(ctx, Message{From: orig.From, To: orig.To}, cfg); err == nil {
+		t.Errorf("empty message sent")
+	}
+	if err := Send(ctx, reply, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.transactions) != 1 {
+		t.Fatalf("got %d transactions", len(rec.transactions))
+	}
+	rcpts, data, _ := strings.Cut(rec.transactions[0], "\n")
+	if rcpts != "alice@example.com" {
+		t.Errorf("recipients = %q", rcpts)
+	}
+	if !strings.Contains(data, "Subject: =?UTF-8?Q?Re=3A_Caf=C3=A9_test?=") || !strings.Contains(data, "\r\n..leading dot\r\n") {
+		t.Errorf("data = %q", data)
+	}
+}
@@ -0,0 +1,111 @@
+// Content based media type detection.
+
+package eml
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// magic numbers of the common attachment formats, checked in order
+var magicTypes = []struct {
+	offset int
+	magic  []byte
+	t      string
+}{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{0, []byte("BM"), "image/bmp"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{8, []byte("WEBP"), "image/webp"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{0, []byte("\x00\x00\x01\x00"), "image/vnd.microsoft.icon"},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("PK\x05\x06"), "application/zip"},
+	{0, []byte("\x1f\x8b"), "application/gzip"},
+	{0, []byte("Rar!\x1a\x07"), "application/vnd.rar"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("{\\rtf"), "application/rtf"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("\x7fELF"), "application/x-executable"},
+	{0, []byte("BEGIN:VCALENDAR"), "text/calendar"},
+	{0, []byte("BEGIN:VCARD"), "text/vcard"},
+}
+
+// the Office Open XML documents are zip files told apart by their contents
+var ooxmlTypes = []struct {
+	prefix string
+	t      string
+}{
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+}
+
+// DetectContentType finds the media type of the data by its magic bytes,
+// telling apart the Office Open XML documents from the plain zip files.
+// Unknown data falls back to http.DetectContentType, which returns
+// "application/octet-stream" when nothing matches.
+func DetectContentType(data []byte) string {
+	for _, m := range magicTypes {
+		if len(data) < m.offset+len(m.magic) || !bytes.Equal(data[m.offset:m.offset+len(m.magic)], m.magic) {
+			continue
+		}
+
+		// RIFF containers other than WebP are not images
+		if m.t == "image/webp" && !bytes.HasPrefix(data, []byte("RIFF")) {
+			continue
+		}
+
+		if m.t == "application/zip" {
+			return zipContentType(data)
+		}
+
+		return m.t
+	}
+
+	return http.DetectContentType(data)
+}
+
+// look inside a zip archive for the Office Open XML parts
+func zipContentType(data []byte) string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "application/zip"
+	}
+
+	ooxml := false
+	for _, f := range zr.File {
+		if f.Name == "[Content_Types].xml" {
+			ooxml = true
+			break
+		}
+	}
+
+	if ooxml {
+		for _, f := range zr.File {
+			for _, o := range ooxmlTypes {
+				if strings.HasPrefix(f.Name, o.prefix) {
+					return o.t
+				}
+			}
+		}
+	}
+
+	return "application/zip"
+}
+
+// check if a declared media type says nothing about the contents
+func isGenericType(t string) bool {
+	t, _, _ = strings.Cut(t, ";")
+	t = strings.ToLower(strings.TrimSpace(t))
+	return t == "" || t == "application/octet-stream"
+}
@@ -0,0 +1,133 @@
+// Spam filter (SpamAssassin X-Spam-*) headers parsing.
+
+package eml
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SpamInfo is the verdict of the spam filter that checked the message
+type SpamInfo struct {
+	Flag      bool       `json:"flag"`      // classified as spam
+	Score     float64    `json:"score"`     // total points
+	Required  float64    `json:"required"`  // threshold of points to be spam
+	Tests     []SpamTest `json:"tests"`     // rules hit
+	Autolearn string     `json:"autolearn"` // Bayes auto-learning outcome, like "no" or "spam"
+	Version   string     `json:"version"`   // version of the filter
+}
+
+// SpamTest is a spam filter rule hit by the message
+type SpamTest struct {
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description"` // from the X-Spam-Report, if present
+}
+
+var (
+	// the rule lines of the X-Spam-Report, like "*  3.5 BAYES_99 BODY: ..."
+	spamReportR = regexp.MustCompile(`^[\s*]*(-?\d+(?:\.\d+)?)\s+([A-Za-z0-9_]+)\s*(.*)$`)
+	spamCommaR  = regexp.MustCompile(`,\s+`)
+)
+
+// collect the spam filter verdict from the X-Spam-* headers, nil if none.
+// Only the first header of each kind is used, being the last added.
+func parseSpamHeaders(headers []RawHeader) *SpamInfo {
+	var status, score, flag, report string
+	set := func(dst *string, v []byte) {
+		if *dst == "" {
+			*dst = strings.TrimSpace(string(v))
+		}
+	}
+
+	for _, rh := range headers {
+		switch strings.ToLower(string(rh.Key)) {
+		case `x-spam-status`:
+			set(&status, unfold(rh.Value))
+		case `x-spam-score`:
+			set(&score, rh.Value)
+		case `x-spam-flag`:
+			set(&flag, rh.Value)
+		case `x-spam-report`:
+			if report == "" {
+				report = string(rh.Value)
+			}
+		}
+	}
+
+	if status == "" && score == "" && flag == "" && report == "" {
+		return nil
+	}
+
+	si := &SpamInfo{Tests: []SpamTest{}}
+
+	// Yes, score=5.2 required=5.0 tests=BAYES_99=3.5,HTML_MESSAGE=0.001
+	// autolearn=no version=3.4.2, older versions using hits= for the score
+	if status != "" {
+		verdict, rest, _ := strings.Cut(status, ",")
+		si.Flag = strings.EqualFold(strings.TrimSpace(verdict), "yes")
+
+		// the tests list may be broken by spaces after the commas
+		rest = spamCommaR.ReplaceAllString(rest, ",")
+		for _, f := range strings.Fields(rest) {
+			k, v, _ := strings.Cut(f, "=")
+			switch strings.ToLower(k) {
+			case "score", "hits":
+				si.Score, _ = strconv.ParseFloat(v, 64)
+			case "required":
+				si.Required, _ = strconv.ParseFloat(v, 64)
+			case "autolearn":
+				si.Autolearn = v
+			case "version":
+				si.Version = v
+			case "tests":
+				for _, t := range strings.Split(v, ",") {
+					if t == "" || t == "none" {
+						continue
+					}
+					name, s, _ := strings.Cut(t, "=")
+					st := SpamTest{Name: name}
+					st.Score, _ = strconv.ParseFloat(s, 64)
+					si.Tests = append(si.Tests, st)
+				}
+			}
+		}
+	}
+
+	if score != "" {
+		if s, err := strconv.ParseFloat(score, 64); err == nil {
+			si.Score = s
+		}
+	}
+
+	if flag != "" {
+		si.Flag = strings.EqualFold(flag, "yes")
+	}
+
+	// the report has the score and description of each rule
+	for _, l := range strings.Split(report, "\n") {
+		m := spamReportR.FindStringSubmatch(strings.TrimRight(l, "\r"))
+		if m == nil {
+			continue
+		}
+
+		s, _ := strconv.ParseFloat(m[1], 64)
+		found := false
+		for k := range si.Tests {
+			if si.Tests[k].Name == m[2] {
+				// the report scores are rounded, keep the status ones
+				if si.Tests[k].Score == 0 {
+					si.Tests[k].Score = s
+				}
+				si.Tests[k].Description = m[3]
+				found = true
+			}
+		}
+		if !found {
+			si.Tests = append(si.Tests, SpamTest{Name: m[2], Score: s, Description: m[3]})
+		}
+	}
+
+	return si
+}
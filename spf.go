@@ -0,0 +1,116 @@
+// Received-SPF header (RFC 7208 section 9.1) parsing.
+
+package eml
+
+import (
+	"errors"
+	"strings"
+)
+
+// ReceivedSPF is the SPF check result recorded by a receiver
+type ReceivedSPF struct {
+	Result       string            `json:"result"` // lowercase: "pass", "fail", "softfail", "neutral", "none", "temperror" or "permerror"
+	Comment      string            `json:"comment"`
+	ClientIP     string            `json:"client_ip"`
+	EnvelopeFrom string            `json:"envelope_from"`
+	Helo         string            `json:"helo"`
+	Receiver     string            `json:"receiver"`
+	Identity     string            `json:"identity"` // "mailfrom" or "helo"
+	Mechanism    string            `json:"mechanism"`
+	Params       map[string]string `json:"params"` // all the key-value pairs, lowercase keys
+}
+
+var spfResults = map[string]bool{
+	"pass": true, "fail": true, "softfail": true, "neutral": true,
+	"none": true, "temperror": true, "permerror": true,
+}
+
+// ParseReceivedSPF parses the value of a Received-SPF header
+func ParseReceivedSPF(v []byte) (r ReceivedSPF, err error) {
+	s := strings.TrimSpace(string(unfold(v)))
+
+	result, rest, _ := strings.Cut(s, " ")
+	r.Result = strings.ToLower(strings.TrimSpace(result))
+	if !spfResults[r.Result] {
+		return r, errors.New("invalid Received-SPF result")
+	}
+
+	// the comment goes before the key-value pairs
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "(") {
+		depth := 0
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == '(' {
+				depth++
+			} else if rest[i] == ')' {
+				if depth--; depth == 0 {
+					r.Comment = rest[1:i]
+					rest = rest[i+1:]
+					break
+				}
+			}
+		}
+	}
+
+	r.Params = make(map[string]string)
+	for _, kv := range splitQuoted(rest, ';') {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = unquote(v)
+		}
+		r.Params[k] = v
+	}
+
+	r.ClientIP = r.Params["client-ip"]
+	r.EnvelopeFrom = r.Params["envelope-from"]
+	r.Helo = r.Params["helo"]
+	r.Receiver = r.Params["receiver"]
+	r.Identity = strings.ToLower(r.Params["identity"])
+	r.Mechanism = r.Params["mechanism"]
+
+	return
+}
+
+// SPFResult gets the checked domain and outcome, as used by the DMARC
+// evaluation
+func (r ReceivedSPF) SPFResult() SPFResult {
+	domain := r.EnvelopeFrom
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	domain = strings.Trim(domain, "<> ")
+	if domain == "" || r.Identity == "helo" {
+		domain = r.Helo
+	}
+
+	return SPFResult{Domain: domain, Pass: r.Result == "pass"}
+}
+
+// split a value by the separator out of the quoted strings
+func splitQuoted(s string, sep byte) (l []string) {
+	last, quoted := 0, false
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				l = append(l, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+
+	return append(l, s[last:])
+}
@@ -0,0 +1,130 @@
+// Sender spoofing heuristics over the parsed headers.
+
+package eml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpoofKind is the kind of a spoofing indicator
+type SpoofKind string
+
+const (
+	// SpoofDisplayNameAddress is a From display name holding an address
+	// other than the From one, like "ceo@company.com <x@free.mail>"
+	SpoofDisplayNameAddress SpoofKind = "display-name-address"
+	// SpoofLookalikeDomain is a Reply-To domain looking like the From one
+	// without being the same, like "examp1e.com" for "example.com"
+	SpoofLookalikeDomain SpoofKind = "lookalike-domain"
+	// SpoofReplyToMismatch is a Reply-To of another organization than the
+	// From address
+	SpoofReplyToMismatch SpoofKind = "reply-to-mismatch"
+	// SpoofReturnPathMismatch is an envelope sender of another
+	// organization than the From address
+	SpoofReturnPathMismatch SpoofKind = "return-path-mismatch"
+)
+
+// SpoofIndicator is a sign of a forged sender, found by SpoofIndicators
+type SpoofIndicator struct {
+	Kind   SpoofKind `json:"kind"`
+	Detail string    `json:"detail"`
+}
+
+// characters of other scripts, and sequences, looking like the latin ones
+var confusables = strings.NewReplacer(
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "х", "x", "у", "y",
+	"і", "i", "ј", "j", "ѕ", "s", "ԁ", "d", "һ", "h", "ӏ", "l", "ԛ", "q", "ԝ", "w",
+	"α", "a", "ο", "o", "ν", "v", "ρ", "p", "τ", "t", "ι", "i", "κ", "k",
+	"0", "o", "1", "l", "rn", "m", "vv", "w", "cl", "d",
+)
+
+// SpoofIndicators checks the sender fields for the signs commonly left by
+// the impersonation (BEC) messages. They are heuristics, legitimate
+// messages from mailing lists or services may raise them too.
+func (msg Message) SpoofIndicators() (found []SpoofIndicator) {
+	if len(msg.From) == 0 || msg.From[0].Email() == "" {
+		return
+	}
+
+	from := msg.From[0]
+	fromDomain := strings.ToLower(from.DomainUnicode())
+	fromOrg := organizationalDomain(strings.ToLower(from.DomainASCII()))
+
+	for _, e := range redactEmailR.FindAllString(from.Name(), -1) {
+		if from.Name() != from.Email() && !strings.EqualFold(e, from.Email()) {
+			found = append(found, SpoofIndicator{SpoofDisplayNameAddress,
+				fmt.Sprintf("display name shows %s but the address is %s", e, from.Email())})
+		}
+	}
+
+	for _, rt := range msg.ReplyTo {
+		if rt.Email() == "" {
+			continue
+		}
+
+		org := organizationalDomain(strings.ToLower(rt.DomainASCII()))
+		if org == fromOrg {
+			continue
+		}
+
+		if lookalikeDomains(strings.ToLower(rt.DomainUnicode()), fromDomain) {
+			found = append(found, SpoofIndicator{SpoofLookalikeDomain,
+				fmt.Sprintf("Reply-To domain %s looks like the From domain %s", rt.DomainUnicode(), from.DomainUnicode())})
+		} else {
+			found = append(found, SpoofIndicator{SpoofReplyToMismatch,
+				fmt.Sprintf("Reply-To %s is not at the From domain %s", rt.Email(), from.DomainUnicode())})
+		}
+	}
+
+	if rp := msg.Envelope.ReturnPath; rp != "" {
+		if i := strings.LastIndex(rp, "@"); i >= 0 {
+			d := strings.ToLower(rp[i+1:])
+			if organizationalDomain(d) != fromOrg {
+				found = append(found, SpoofIndicator{SpoofReturnPathMismatch,
+					fmt.Sprintf("Return-Path domain %s is not the From domain %s", d, from.DomainUnicode())})
+			}
+		}
+	}
+
+	return
+}
+
+// check if two different domains look alike: the same once the confusable
+// characters are replaced, or a single character apart
+func lookalikeDomains(a, b string) bool {
+	if a == b {
+		return false
+	}
+
+	if confusables.Replace(a) == confusables.Replace(b) {
+		return true
+	}
+
+	return len([]rune(a)) >= 5 && editDistance(a, b) == 1
+}
+
+// get the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(rb)]
+}
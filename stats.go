@@ -0,0 +1,58 @@
+// Message size statistics.
+
+package eml
+
+// Stats holds the sizes of a message and its parts, in bytes
+type Stats struct {
+	TotalSize       int         `json:"total_size"`        // headers and body as parsed
+	HeaderSize      int         `json:"header_size"`       // headers, separator line included
+	BodySize        int         `json:"body_size"`         // raw (still encoded) body
+	DecodedBodySize int         `json:"decoded_body_size"` // decoded contents of all the leaf parts
+	Parts           []PartStats `json:"parts"`             // one entry per leaf part, in order
+
+	AttachmentCount       int    `json:"attachment_count"`
+	LargestAttachment     string `json:"largest_attachment"` // filename of the largest attachment
+	LargestAttachmentSize int    `json:"largest_attachment_size"`
+}
+
+// PartStats holds the sizes of a leaf part
+type PartStats struct {
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	RawSize     int    `json:"raw_size"`
+	DecodedSize int    `json:"decoded_size"`
+}
+
+// Stats computes the sizes of the message, its parts and attachments
+func (msg Message) Stats() (s Stats) {
+	s.HeaderSize = msg.BodyOffset
+	s.BodySize = len(msg.Body)
+	s.TotalSize = s.HeaderSize + s.BodySize
+
+	if msg.Root.Type == "" {
+		// messages without Content-Type are a single text part
+		s.Parts = []PartStats{{Type: "text/plain", RawSize: len(msg.Body), DecodedSize: len(msg.Text)}}
+	} else {
+		for _, p := range msg.Parts {
+			s.Parts = append(s.Parts, PartStats{
+				Type:        p.Type,
+				Filename:    p.Filename,
+				RawSize:     len(msg.rawPart(p)),
+				DecodedSize: len(p.Data),
+			})
+		}
+	}
+
+	for _, p := range s.Parts {
+		s.DecodedBodySize += p.DecodedSize
+	}
+
+	s.AttachmentCount = len(msg.Attachments)
+	for _, a := range msg.Attachments {
+		if len(a.Data) > s.LargestAttachmentSize || s.LargestAttachment == "" {
+			s.LargestAttachment, s.LargestAttachmentSize = a.Filename, len(a.Data)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,148 @@
+// Attachments removal over the raw message data.
+
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StripAttachments rewrites the message replacing the attachments selected
+// by the filter by a short text/plain part naming the removed file. The
+// rest of the message is kept byte by byte.
+func (msg Message) StripAttachments(filter func(Attachment) bool) []byte {
+	edits := make(map[int]partEdit)
+
+	msg.Walk(func(p *Part, depth int) error {
+		if a, ok := p.attachment(); ok && filter(a) {
+			edits[p.HeaderOffset] = removalPlaceholder(*p)
+		}
+		return nil
+	})
+
+	return msg.editParts(edits)
+}
+
+// get the attachment of a leaf part: files named or referenced by the
+// HTML body
+func (p Part) attachment() (Attachment, bool) {
+	if p.Children != nil {
+		return Attachment{}, false
+	}
+
+	if p.Disposition != "attachment" && p.Filename == "" && (p.ContentID == "" || strings.HasPrefix(p.Type, "text/")) {
+		return Attachment{}, false
+	}
+
+	return Attachment{
+		Filename:    p.Filename,
+		Data:        p.Data,
+		ContentType: p.Type,
+		ContentID:   p.ContentID,
+		Inline:      p.Disposition != "attachment",
+	}, true
+}
+
+// build the part noting the removal of an attachment
+func removalPlaceholder(p Part) partEdit {
+	name := p.Filename
+	if name == "" {
+		name = "unnamed"
+	}
+
+	text := fmt.Sprintf("[attachment removed: %s, %s, %d bytes]", name, p.Type, len(p.Data))
+	encoding, data := EncodeBody([]byte(text), false)
+
+	return partEdit{
+		set: [][2]string{
+			{"Content-Type", "text/plain; charset=utf-8"},
+			{"Content-Transfer-Encoding", encoding},
+		},
+		remove: []string{"Content-Disposition", "Content-Id", "Content-Description"},
+		body:   data,
+	}
+}
+
+// new contents of a leaf part, with CRLF line endings, and the changes to
+// its header fields
+type partEdit struct {
+	set    [][2]string
+	remove []string
+	body   []byte
+}
+
+// rewrite the message data replacing the leaf parts, by the position of
+// their headers, keeping everything else byte by byte
+func (msg Message) editParts(edits map[int]partEdit) []byte {
+	eol := msg.lineEnding()
+
+	// the whole body is the part, its headers are the message ones
+	if msg.Root.Children == nil {
+		e, ok := edits[msg.Root.HeaderOffset]
+		if !ok {
+			return msg.Raw()
+		}
+
+		// work on a copy, only the raw data is needed
+		m := msg
+		m.ParsedHeaders = nil
+		for _, k := range e.remove {
+			m.RemoveHeader(k)
+		}
+		for _, h := range e.set {
+			m.SetHeader(h[0], h[1])
+		}
+		m.Body = append(bytes.ReplaceAll(e.body, []byte("\r\n"), []byte(eol)), eol...)
+
+		return m.Raw()
+	}
+
+	type cut struct {
+		start, body, end int // body positions of the part headers, contents and end
+		edit             partEdit
+	}
+	var cuts []cut
+
+	msg.Walk(func(p *Part, depth int) error {
+		if e, ok := edits[p.HeaderOffset]; ok && p.Children == nil {
+			cuts = append(cuts, cut{p.HeaderOffset - msg.BodyOffset, p.Offset - msg.BodyOffset, p.Offset + p.Length - msg.BodyOffset, e})
+		}
+		return nil
+	})
+
+	// replace from the end to keep the positions valid
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].start > cuts[j].start })
+
+	body := append([]byte{}, msg.Body...)
+	for _, c := range cuts {
+		if c.start < 0 || c.end > len(body) || c.start > c.body || c.body > c.end {
+			continue
+		}
+
+		fields := splitHeaderFields(bytes.TrimRight(body[c.start:c.body], "\r\n"))
+		if n := len(fields); n > 0 && !bytes.HasSuffix(fields[n-1], []byte("\n")) {
+			fields[n-1] = append(append([]byte{}, fields[n-1]...), eol...)
+		}
+		for _, k := range c.edit.remove {
+			fields = removeField(fields, k)
+		}
+		for _, h := range c.edit.set {
+			if f, err := newField(h[0], h[1], eol); err == nil {
+				fields = setField(fields, h[0], f)
+			}
+		}
+
+		var b bytes.Buffer
+		b.Write(bytes.Join(fields, nil))
+		b.WriteString(eol)
+		b.Write(bytes.ReplaceAll(c.edit.body, []byte("\r\n"), []byte(eol)))
+
+		body = append(body[:c.start], append(b.Bytes(), body[c.end:]...)...)
+	}
+
+	m := msg
+	m.Body = body
+	return m.Raw()
+}
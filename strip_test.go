@@ -0,0 +1,100 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripAttachments(t *testing.T) {
+	all := func(Attachment) bool { return true }
+
+	t.Run("multipart", func(t *testing.T) {
+		msg, errs := Parse([]byte(forwardOriginal))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		out := string(msg.StripAttachments(all))
+		want := "--XX\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"Content-Transfer-Encoding: 7bit\r\n" +
+			"\r\n" +
+			"[attachment removed: report.pdf, application/pdf, 9 bytes]\r\n" +
+			"--XX--\r\n"
+		if !strings.HasSuffix(out, want) {
+			t.Errorf("stripped = %q", out)
+		}
+
+		// the text part is kept byte by byte
+		i := strings.Index(forwardOriginal, "--XX\r\nContent-Type: application/pdf")
+		if !strings.HasPrefix(out, forwardOriginal[:i]) {
+			t.Errorf("the message start changed: %q", out)
+		}
+	})
+
+	t.Run("part headers kept", func(t *testing.T) {
+		data := "Content-Type: multipart/mixed; boundary=\"XX\"\n" +
+			"\n" +
+			"--XX\n" +
+			"Content-Type: text/plain\n" +
+			"\n" +
+			"text\n" +
+			"--XX\n" +
+			"Content-Type: image/png; name=\"a.png\"\n" +
+			"X-Attachment-Id: f_1\n" +
+			"Content-ID: <a@example.com>\n" +
+			"Content-Transfer-Encoding: base64\n" +
+			"\n" +
+			"iVBORw==\n" +
+			"--XX--\n"
+		msg, errs := Parse([]byte(data))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		out := string(msg.StripAttachments(all))
+		want := "--XX\n" +
+			"Content-Type: text/plain; charset=utf-8\n" +
+			"X-Attachment-Id: f_1\n" +
+			"Content-Transfer-Encoding: 7bit\n" +
+			"\n" +
+			"[attachment removed: a.png, image/png, 4 bytes]\n" +
+			"--XX--\n"
+		if !strings.HasSuffix(out, want) {
+			t.Errorf("stripped = %q", out)
+		}
+	})
+
+	t.Run("single part", func(t *testing.T) {
+		data := "From: a@example.com\r\n" +
+			"Content-Type: application/pdf\r\n" +
+			"Content-Disposition: attachment; filename=\"a.pdf\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			"JVBERi0xLjQK\r\n"
+		msg, errs := Parse([]byte(data))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		want := "From: a@example.com\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"Content-Transfer-Encoding: 7bit\r\n" +
+			"\r\n" +
+			"[attachment removed: a.pdf, application/pdf, 9 bytes]\r\n"
+		if got := string(msg.StripAttachments(all)); got != want {
+			t.Errorf("stripped = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("nothing selected", func(t *testing.T) {
+		msg, errs := Parse([]byte(forwardOriginal))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if got := string(msg.StripAttachments(func(Attachment) bool { return false })); got != forwardOriginal {
+			t.Errorf("stripped = %q", got)
+		}
+	})
+}
@@ -8,13 +8,14 @@ import (
 
 // Regular expressions that correspond roughly to the syntax described by
 // RFC5322. We're a bit loose here, so we might succeed in parsing material
-// that the RFC considers invalid.
+// that the RFC considers invalid. The atoms also accept the UTF-8 characters
+// allowed by RFC6532 for internationalized addresses.
 var (
-	dotAtomR = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~][a-zA-Z0-9.!#$%&`*+\\-/=?^_'{|}~]+")
-	atomR    = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~]+")
+	dotAtomR = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~\\x{80}-\\x{10FFFF}][a-zA-Z0-9.!#$%&`*+\\-/=?^_'{|}~\\x{80}-\\x{10FFFF}]+")
+	atomR    = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~\\x{80}-\\x{10FFFF}]+")
 	specialR = regexp.MustCompile(`^[()<>\[\]:;@\,."]`)
-	qStringR = regexp.MustCompilePOSIX(`^"([^"]|\\")*"`)
-	uniCodes = regexp.MustCompile(`[^\x00-\x7F]+`)
+	qStringR = regexp.MustCompile(`^"(?:[^"\\]|\\.)*"`)
+	dLitR    = regexp.MustCompile(`^\[(?:[^\[\]\\]|\\.)*\]`)
 )
 
 type token []byte
@@ -36,7 +37,7 @@ Next:
 	if len(s) == 0 {
 		return
 	}
-	for _, r := range []*regexp.Regexp{dotAtomR, atomR, uniCodes, qStringR, specialR} {
+	for _, r := range []*regexp.Regexp{dotAtomR, atomR, qStringR, dLitR, specialR} {
 		i := try(r, s)
 		if i > 0 {
 			ts = append(ts, s[0:i])
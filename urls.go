@@ -0,0 +1,179 @@
+// URLs extraction from the bodies and headers.
+
+package eml
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link is an URL found at the message
+type Link struct {
+	URL    string `json:"url"`
+	Source string `json:"source"` // where it was first found: "text", "html" or the header name
+
+	// Text is the visible text of the HTML anchor, and Mismatch tells if it
+	// shows another site than the one linked, like a text of
+	// "https://bank.com" linking to "https://evil.example"
+	Text     string `json:"text"`
+	Mismatch bool   `json:"mismatch"`
+}
+
+var (
+	textURLR  = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"'` + "`" + `]+`)
+	hostLikeR = regexp.MustCompile(`(?i)^(?:[a-z][a-z0-9+.\-]*://)?(?:[a-z0-9\-]+\.)+[a-z]{2,}(?:[:/?#]\S*)?$`)
+)
+
+// HTML attributes holding URLs, by element
+var urlAttributes = map[string]string{
+	`a`: `href`, `area`: `href`, `link`: `href`, `base`: `href`,
+	`img`: `src`, `script`: `src`, `iframe`: `src`, `frame`: `src`, `embed`: `src`,
+	`source`: `src`, `video`: `src`, `audio`: `src`, `input`: `src`, `form`: `action`,
+}
+
+// headers holding lists of URLs between angle brackets (RFC 2369)
+var urlHeaders = []string{`List-Unsubscribe`, `List-Subscribe`, `List-Help`, `List-Post`, `List-Archive`, `List-Owner`}
+
+// URLs gets the URLs of the text and HTML bodies and of the list headers,
+// without duplicates, in the order they are found. The references to the
+// message parts (cid:) and the page anchors are skipped.
+func (msg Message) URLs() (links []Link) {
+	seen := make(map[string]int)
+	add := func(l Link) {
+		l.URL = strings.TrimSpace(l.URL)
+		if l.URL == "" || strings.HasPrefix(l.URL, "#") || strings.HasPrefix(strings.ToLower(l.URL), "cid:") {
+			return
+		}
+
+		if i, ok := seen[l.URL]; ok {
+			if links[i].Text == "" {
+				links[i].Text = l.Text
+			}
+			links[i].Mismatch = links[i].Mismatch || l.Mismatch
+			return
+		}
+
+		seen[l.URL] = len(links)
+		links = append(links, l)
+	}
+
+	for _, u := range textURLs(msg.Text) {
+		add(Link{URL: u, Source: "text"})
+	}
+
+	for _, l := range htmlURLs(msg.Html) {
+		add(l)
+	}
+
+	for _, name := range urlHeaders {
+		for _, v := range msg.HeaderAll(name) {
+			for _, item := range strings.Split(v, ",") {
+				item = strings.TrimSpace(item)
+				if strings.HasPrefix(item, "<") && strings.HasSuffix(item, ">") {
+					add(Link{URL: strings.Join(strings.Fields(item[1:len(item)-1]), ""), Source: name})
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// find the URLs of a plain text
+func textURLs(text string) (l []string) {
+	for _, u := range textURLR.FindAllString(text, -1) {
+		// the punctuation ending a sentence isn't part of the URL
+		u = strings.TrimRight(u, ".,;:!?")
+		if strings.HasSuffix(u, ")") && !strings.Contains(u, "(") {
+			u = strings.TrimRight(u, ")")
+		}
+		l = append(l, u)
+	}
+	return
+}
+
+// find the URLs of the HTML elements, with the text of the anchors
+func htmlURLs(doc string) (links []Link) {
+	z := html.NewTokenizer(strings.NewReader(doc))
+
+	anchor := -1 // index of the open anchor
+	var text bytes.Buffer
+
+	closeAnchor := func() {
+		if anchor >= 0 {
+			links[anchor].Text = strings.Join(strings.Fields(text.String()), " ")
+			links[anchor].Mismatch = linkMismatch(links[anchor].Text, links[anchor].URL)
+		}
+		anchor = -1
+		text.Reset()
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			closeAnchor()
+			return
+
+		case html.TextToken:
+			if anchor >= 0 {
+				text.Write(z.Text())
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tag == `a` {
+				closeAnchor()
+			}
+
+			want := urlAttributes[tag]
+			for hasAttr && want != "" {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				if string(k) != want {
+					continue
+				}
+
+				links = append(links, Link{URL: strings.TrimSpace(string(v)), Source: "html"})
+				if tag == `a` && tt == html.StartTagToken {
+					anchor = len(links) - 1
+				}
+				break
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == `a` {
+				closeAnchor()
+			}
+		}
+	}
+}
+
+// check if the visible text of a link shows another host than the linked one
+func linkMismatch(text, href string) bool {
+	if !hostLikeR.MatchString(text) {
+		return false
+	}
+
+	th, hh := linkHost(text), linkHost(href)
+	return th != "" && hh != "" && th != hh
+}
+
+// get the host of an URL, or of a text like "www.example.com/page"
+func linkHost(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
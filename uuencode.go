@@ -0,0 +1,97 @@
+// Extraction of the uuencoded files embedded at text bodies.
+
+package eml
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// header line of an uuencoded block: "begin <mode> <filename>"
+var uuBeginR = regexp.MustCompile(`^begin [0-7]{3,4} (.+)$`)
+
+// find the uuencoded blocks of a text, returning the text without them and
+// the decoded files
+func extractUUEncoded(text string, opts ParseOptions) (clean string, atts []Attachment, errors []error) {
+	lines := strings.SplitAfter(text, "\n")
+
+	var out strings.Builder
+	for i := 0; i < len(lines); i++ {
+		m := uuBeginR.FindStringSubmatch(strings.TrimRight(lines[i], "\r\n"))
+		if m == nil {
+			out.WriteString(lines[i])
+			continue
+		}
+
+		// find the end of the block, keeping the text when there's none
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimRight(lines[j], " \r\n") == "end" {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			out.WriteString(lines[i])
+			continue
+		}
+
+		data, err := decodeUULines(lines[i+1 : end])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("body parser: failed decode uuencoded %s [msg: %v]", m[1], err))
+			out.WriteString(lines[i])
+			continue
+		}
+
+		a := Attachment{Filename: strings.TrimSpace(m[1]), Data: data}
+		if opts.SniffTypes {
+			a.DetectedType = DetectContentType(data)
+		}
+
+		atts = append(atts, a)
+		i = end
+	}
+
+	return out.String(), atts, errors
+}
+
+// decode the lines of an uuencoded block, each one starting with the
+// character holding the count of bytes it encodes
+func decodeUULines(lines []string) (data []byte, err error) {
+	for n, l := range lines {
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			continue
+		}
+
+		count := int(l[0]-' ') & 0x3f
+		if count == 0 {
+			// the zero length line ("`") closes the data
+			break
+		}
+
+		l = l[1:]
+		if len(l) < (count+2)/3*4 {
+			// some encoders strip the trailing spaces, which are zeros
+			l += strings.Repeat(" ", (count+2)/3*4-len(l))
+		}
+
+		var line []byte
+		for i := 0; i+4 <= len(l) && len(line) < count; i += 4 {
+			var c [4]byte
+			for k := 0; k < 4; k++ {
+				if l[i+k] < ' ' || l[i+k] > '`' {
+					return nil, fmt.Errorf("invalid character at line %d", n+1)
+				}
+				c[k] = (l[i+k] - ' ') & 0x3f
+			}
+
+			line = append(line, c[0]<<2|c[1]>>4, c[1]<<4|c[2]>>2, c[2]<<6|c[3])
+		}
+
+		data = append(data, line[:min(count, len(line))]...)
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+// vCard (RFC 6350, and the older 2.1 and 3.0 versions) contacts parsing.
+
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// Contact is a person or organization described by a vCard
+type Contact struct {
+	Name   string   `json:"name"` // formatted name, built from the N property when missing
+	Emails []string `json:"emails"`
+	Phones []string `json:"phones"`
+	Org    string   `json:"org"` // organization units are joined by ", "
+	Title  string   `json:"title"`
+}
+
+// check if a media type is a vCard one
+func isVCardType(t string) bool {
+	return mediaTypeMatches(t, "text/vcard") || mediaTypeMatches(t, "text/x-vcard") || mediaTypeMatches(t, "text/directory")
+}
+
+// ParseVCard parses the contacts of a vCard file, which can hold several
+// BEGIN:VCARD to END:VCARD blocks. The data must be UTF-8, except for the
+// 2.1 quoted-printable values which are kept as they are decoded.
+func ParseVCard(data []byte) (contacts []Contact, err error) {
+	var c *Contact
+	var family, given string
+
+	for _, line := range unfoldVCard(data) {
+		name, params, value := splitVCardLine(line)
+		if name == "" {
+			continue
+		}
+
+		switch name {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				c = &Contact{}
+				family, given = "", ""
+			}
+			continue
+		case "END":
+			if c != nil && strings.EqualFold(value, "VCARD") {
+				if c.Name == "" {
+					c.Name = strings.TrimSpace(given + " " + family)
+				}
+				contacts = append(contacts, *c)
+				c = nil
+			}
+			continue
+		}
+
+		if c == nil {
+			continue
+		}
+
+		if strings.EqualFold(params["ENCODING"], "QUOTED-PRINTABLE") {
+			if d, e := io.ReadAll(quotedprintable.NewReader(strings.NewReader(value))); e == nil {
+				value = string(d)
+			}
+		}
+
+		switch name {
+		case "FN":
+			c.Name = unescapeVCard(value)
+		case "N":
+			n := splitVCardValue(value)
+			if len(n) > 0 {
+				family = n[0]
+			}
+			if len(n) > 1 {
+				given = n[1]
+			}
+		case "EMAIL":
+			if v := unescapeVCard(value); v != "" {
+				c.Emails = append(c.Emails, v)
+			}
+		case "TEL":
+			if v := strings.TrimPrefix(unescapeVCard(value), "tel:"); v != "" {
+				c.Phones = append(c.Phones, v)
+			}
+		case "ORG":
+			var units []string
+			for _, u := range splitVCardValue(value) {
+				if u != "" {
+					units = append(units, u)
+				}
+			}
+			c.Org = strings.Join(units, ", ")
+		case "TITLE":
+			c.Title = unescapeVCard(value)
+		}
+	}
+
+	if len(contacts) == 0 {
+		return nil, errors.New("no vCard found")
+	}
+
+	return
+}
+
+// join the folded lines of a vCard, and the quoted-printable soft line
+// breaks of the 2.1 version
+func unfoldVCard(data []byte) (lines []string) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	for _, l := range strings.Split(string(data), "\n") {
+		n := len(lines)
+		switch {
+		case n > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")):
+			lines[n-1] += l[1:]
+		case n > 0 && strings.HasSuffix(lines[n-1], "=") && strings.Contains(strings.ToUpper(lines[n-1]), "QUOTED-PRINTABLE"):
+			lines[n-1] = lines[n-1][:len(lines[n-1])-1] + l
+		default:
+			lines = append(lines, l)
+		}
+	}
+	return
+}
+
+// split a content line into the uppercase property name, without group,
+// the parameters and the value
+func splitVCardLine(line string) (name string, params map[string]string, value string) {
+	// the colon may appear quoted at the parameters
+	quoted := false
+	i := -1
+	for j := 0; j < len(line) && i < 0; j++ {
+		switch line[j] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				i = j
+			}
+		}
+	}
+	if i < 0 {
+		return "", nil, ""
+	}
+
+	fields := strings.Split(line[:i], ";")
+	name = strings.ToUpper(strings.TrimSpace(fields[0]))
+	if _, n, ok := strings.Cut(name, "."); ok {
+		name = n
+	}
+
+	params = make(map[string]string)
+	for _, p := range fields[1:] {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			// 2.1 bare parameters, like "TEL;WORK;QUOTED-PRINTABLE:"
+			if strings.EqualFold(p, "QUOTED-PRINTABLE") {
+				k, v = "ENCODING", p
+			} else {
+				k, v = "TYPE", p
+			}
+		}
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return name, params, strings.TrimSpace(line[i+1:])
+}
+
+// split a structured value by the unescaped semicolons
+func splitVCardValue(v string) (l []string) {
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case ';':
+			l = append(l, unescapeVCard(v[start:i]))
+			start = i + 1
+		}
+	}
+	return append(l, unescapeVCard(v[start:]))
+}
+
+var vcardUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescapeVCard(v string) string {
+	return strings.TrimSpace(vcardUnescaper.Replace(v))
+}
@@ -0,0 +1,138 @@
+// Extraction of the yEnc encoded files embedded at bodies.
+
+package eml
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// YEncInfo holds the framing data of a yEnc decoded attachment and the
+// result of its validation
+type YEncInfo struct {
+	Part      int    `json:"part"`       // part number of multipart files, 0 otherwise
+	Size      int64  `json:"size"`       // size declared at =yend
+	CRC32     uint32 `json:"crc32"`      // checksum declared at =yend, part one for multipart files
+	SizeValid bool   `json:"size_valid"` // the decoded data has the declared size
+	CRCValid  bool   `json:"crc_valid"`  // the decoded data matches the declared checksum, false when missing
+}
+
+// parse the "key=value" parameters of a yEnc control line, the name being
+// the last one and able to hold spaces
+func yencParams(l string) map[string]string {
+	ps := make(map[string]string)
+
+	if i := strings.Index(l, " name="); i >= 0 {
+		ps["name"] = strings.TrimSpace(l[i+6:])
+		l = l[:i]
+	}
+
+	for _, f := range strings.Fields(l)[1:] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			ps[k] = v
+		}
+	}
+
+	return ps
+}
+
+// find the yEnc blocks of a text, returning the text without them and the
+// decoded files
+func extractYEnc(text string, opts ParseOptions) (clean string, atts []Attachment, errors []error) {
+	lines := strings.SplitAfter(text, "\n")
+
+	var out strings.Builder
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "=ybegin ") {
+			out.WriteString(lines[i])
+			continue
+		}
+
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if strings.HasPrefix(lines[j], "=yend") {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			out.WriteString(lines[i])
+			continue
+		}
+
+		a, err := decodeYEnc(lines[i : end+1])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("body parser: failed decode yEnc data [msg: %v]", err))
+			out.WriteString(lines[i])
+			continue
+		}
+
+		if !a.YEnc.SizeValid || !a.YEnc.CRCValid {
+			errors = append(errors, fmt.Errorf("body parser: yEnc data of %s failed validation", a.Filename))
+		}
+
+		if opts.SniffTypes {
+			a.DetectedType = DetectContentType(a.Data)
+		}
+
+		atts = append(atts, a)
+		i = end
+	}
+
+	return out.String(), atts, errors
+}
+
+// decode a yEnc block, from the =ybegin to the =yend lines
+func decodeYEnc(lines []string) (a Attachment, err error) {
+	begin := yencParams(strings.TrimRight(lines[0], "\r\n"))
+	end := yencParams(strings.TrimRight(lines[len(lines)-1], "\r\n"))
+
+	a.Filename = begin["name"]
+	a.YEnc = &YEncInfo{}
+	a.YEnc.Part, _ = strconv.Atoi(begin["part"])
+
+	var data []byte
+	for _, l := range lines[1 : len(lines)-1] {
+		l = strings.TrimRight(l, "\r\n")
+		if strings.HasPrefix(l, "=ypart ") {
+			continue
+		}
+
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			if c == '=' {
+				if i++; i >= len(l) {
+					return a, fmt.Errorf("dangling escape character")
+				}
+				c = l[i] - 64
+			}
+			data = append(data, c-42)
+		}
+	}
+	a.Data = data
+
+	a.YEnc.Size, err = strconv.ParseInt(end["size"], 10, 64)
+	if err != nil {
+		return a, fmt.Errorf("invalid size at =yend")
+	}
+	a.YEnc.SizeValid = a.YEnc.Size == int64(len(data))
+
+	// the multipart files carry the checksum of the part at pcrc32
+	crc := end["crc32"]
+	if a.YEnc.Part > 0 && end["pcrc32"] != "" {
+		crc = end["pcrc32"]
+	}
+
+	if crc != "" {
+		v, err := strconv.ParseUint(crc, 16, 32)
+		if err != nil {
+			return a, fmt.Errorf("invalid checksum at =yend")
+		}
+		a.YEnc.CRC32 = uint32(v)
+		a.YEnc.CRCValid = a.YEnc.CRC32 == crc32.ChecksumIEEE(data)
+	}
+
+	return a, nil
+}